@@ -2,6 +2,7 @@ package poker
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"strings"
 )
@@ -20,10 +21,16 @@ func NewCLI(store PlayerStore, in io.Reader) *CLI {
 	}
 }
 
-// PlayPoker starts the game.
-func (cli *CLI) PlayPoker() {
+// PlayPoker starts the game, returning an error if the win could not be stored.
+func (cli *CLI) PlayPoker() error {
 	userInput := cli.readLine()
-	cli.playerStore.RecordWin(extractWinner(userInput))
+	winner := extractWinner(userInput)
+
+	if err := cli.playerStore.RecordWin(winner); err != nil {
+		return fmt.Errorf("could not record a win for %s, %v", winner, err)
+	}
+
+	return nil
 }
 
 func extractWinner(userInput string) string {
@@ -33,4 +40,4 @@ func extractWinner(userInput string) string {
 func (cli *CLI) readLine() string {
 	cli.in.Scan()
 	return cli.in.Text()
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package poker_test
 
 import (
+	"errors"
 	"go-learn/build-app/command-line"
 	"io"
 	"strings"
@@ -41,6 +42,22 @@ func TestCLI(t *testing.T) {
 		cli.PlayPoker()
 	})
 
+	t.Run("report a win that could not be stored", func(t *testing.T) {
+		in := strings.NewReader("Chris wins\n")
+		playerStore := &poker.FailingPlayerStore{Err: errors.New("disk full")}
+
+		cli := poker.NewCLI(playerStore, in)
+		err := cli.PlayPoker()
+
+		if err == nil {
+			t.Fatal("expected an error but didn't get one")
+		}
+
+		if !strings.Contains(err.Error(), "Chris") || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("error %q should mention the winner and the cause", err)
+		}
+	})
+
 }
 
 type failOnEndReader struct {
@@ -57,4 +74,4 @@ func (m failOnEndReader) Read(p []byte) (n int, err error) {
 	}
 
 	return n, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,323 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// AdminDelete removes a player, along with the games they won.
+	AdminDelete = "delete"
+	// AdminRename gives a player a new name, in every game they played too.
+	AdminRename = "rename"
+	// AdminMerge makes the players in From one player with the player's name.
+	AdminMerge = "merge"
+	// AdminAdjustWins adds Delta, which may be negative, to a player's wins.
+	// Wins are added as games the player won alone, played now in the
+	// DefaultLeague, and taken away by removing the player's latest wins.
+	AdminAdjustWins = "adjust-wins"
+	// AdminReset sets a player's wins back to zero, removing every game they won.
+	AdminReset = "reset"
+	// AdminImport is a league loaded by an import, as recorded in the audit
+	// log. It isn't one of the AdminActions, as it isn't made to one player.
+	AdminImport = "import"
+)
+
+// maxWinsAdjustment is the most wins adjust-wins adds in one go, as each is a game.
+const maxWinsAdjustment = 10_000
+
+// AdminActions are the changes an administrator can make to players.
+var AdminActions = []string{AdminDelete, AdminRename, AdminMerge, AdminAdjustWins, AdminReset}
+
+// AdminAction is a correction an administrator makes to the players of a store.
+type AdminAction struct {
+	Action string `json:"action"`
+	Player string `json:"player"`
+	// To is the new name of a renamed player.
+	To string `json:"to,omitempty"`
+	// From lists the players merged into Player.
+	From []string `json:"from,omitempty"`
+	// Delta is added to the wins of Player by adjust-wins.
+	Delta int `json:"delta,omitempty"`
+	// Mode is how an import loaded the league, ImportMerge or ImportReplace.
+	Mode string `json:"mode,omitempty"`
+}
+
+// AdminResult is how the players an AdminAction touched were before and
+// after it. Players that didn't exist at the time are left out.
+type AdminResult struct {
+	Before League `json:"before"`
+	After  League `json:"after"`
+	// GamesDropped counts the games removed because their winner was deleted,
+	// or had their wins taken away, or that an import replaced.
+	GamesDropped int `json:"games_dropped,omitempty"`
+	// GamesAdded counts the games recorded to add wins.
+	GamesAdded int `json:"games_added,omitempty"`
+}
+
+// AdminStore is implemented by stores whose players an administrator can correct.
+type AdminStore interface {
+	// Administer makes action, calling audit with the result before the change
+	// is saved. The change is abandoned when audit fails, and may still fail to
+	// save after audit succeeds.
+	Administer(action AdminAction, audit func(AdminResult) error) (AdminResult, error)
+}
+
+var errNoDelta = errors.New("adjust-wins needs a delta other than zero")
+
+// administer makes action in db, dating any games it adds with now. Names are
+// put in the canonical form of the file's name policy first, so they can be
+// given as the players typed them.
+func (db *database) administer(action AdminAction, now func() time.Time) (AdminResult, error) {
+	var result AdminResult
+
+	player, err := db.Names.Canonical(action.Player)
+
+	if err != nil {
+		return result, err
+	}
+
+	touched := []string{player}
+	renamed := map[string]string{}
+
+	switch action.Action {
+	case AdminDelete:
+		renamed[player] = ""
+	case AdminRename:
+		to, err := db.Names.Canonical(action.To)
+
+		if err != nil {
+			return result, err
+		}
+
+		if db.Players.Find(to) != nil {
+			return result, StatusError{http.StatusConflict, fmt.Errorf("there is already a player called %q, merge them instead", to)}
+		}
+
+		renamed[player] = to
+		touched = append(touched, to)
+	case AdminMerge:
+		if len(action.From) == 0 {
+			return result, StatusError{http.StatusBadRequest, fmt.Errorf("name the players to merge into %s", player)}
+		}
+
+		for _, name := range action.From {
+			from, err := db.Names.Canonical(name)
+
+			if err != nil {
+				return result, err
+			}
+
+			if from == player {
+				return result, StatusError{http.StatusBadRequest, fmt.Errorf("can't merge %s into itself", player)}
+			}
+
+			if db.Players.Find(from) == nil {
+				return result, StatusError{http.StatusNotFound, fmt.Errorf("no player called %q", from)}
+			}
+
+			renamed[from] = player
+			touched = append(touched, from)
+		}
+	case AdminAdjustWins:
+		if action.Delta == 0 {
+			return result, StatusError{http.StatusBadRequest, errNoDelta}
+		}
+
+		if action.Delta > maxWinsAdjustment {
+			return result, StatusError{http.StatusBadRequest, fmt.Errorf("can add at most %d wins at a time, got %d", maxWinsAdjustment, action.Delta)}
+		}
+	case AdminReset:
+	default:
+		return result, StatusError{http.StatusBadRequest, fmt.Errorf("unknown action %q, use one of %v", action.Action, AdminActions)}
+	}
+
+	if action.Action != AdminMerge && db.Players.Find(player) == nil {
+		return result, StatusError{http.StatusNotFound, fmt.Errorf("no player called %q", player)}
+	}
+
+	result.Before = db.Players.pick(touched)
+
+	if len(renamed) > 0 {
+		result.GamesDropped = db.renamePlayers(func(name string) string {
+			if to, ok := renamed[name]; ok {
+				return to
+			}
+			return name
+		})
+	}
+
+	switch action.Action {
+	case AdminAdjustWins:
+		entry := db.Players.Find(player)
+
+		if entry.Wins+action.Delta < 0 {
+			return result, StatusError{http.StatusBadRequest, fmt.Errorf("%s has %d wins, can't take away %d", player, entry.Wins, -action.Delta)}
+		}
+
+		if action.Delta < 0 {
+			result.GamesDropped = db.dropWins(player, -action.Delta)
+			db.Players.Find(player).Wins += action.Delta
+		}
+
+		for range action.Delta {
+			db.addGame(winGame(player), now)
+			result.GamesAdded++
+		}
+	case AdminReset:
+		result.GamesDropped = db.dropWins(player, -1)
+		db.Players.Find(player).Wins = 0
+	}
+
+	result.After = db.Players.pick(touched)
+
+	return result, nil
+}
+
+// dropWins removes the latest n games won by player, or all of them when n is
+// negative, and returns how many were removed. The league is left to the caller,
+// as wins from before games were recorded have no game to remove.
+func (db *database) dropWins(player string, n int) int {
+	won := []int{}
+
+	for i, game := range db.Games {
+		if game.Winner == player {
+			won = append(won, i)
+		}
+	}
+
+	sort.SliceStable(won, func(i, j int) bool {
+		return db.Games[won[i]].Time.Before(db.Games[won[j]].Time)
+	})
+
+	if n >= 0 && n < len(won) {
+		won = won[len(won)-n:]
+	}
+
+	dropped := map[int]bool{}
+
+	for _, i := range won {
+		dropped[i] = true
+	}
+
+	games := []Game{}
+
+	for i, game := range db.Games {
+		if !dropped[i] {
+			games = append(games, game)
+		}
+	}
+
+	db.Games = games
+
+	return len(won)
+}
+
+// pick returns the players in l called one of names, in the order of names.
+func (l League) pick(names []string) League {
+	picked := League{}
+
+	for _, name := range names {
+		if player := l.Find(name); player != nil && picked.Find(name) == nil {
+			picked = append(picked, *player)
+		}
+	}
+
+	return picked
+}
+
+// WithAuditLog enables the /admin/ endpoints, recording every change made through them in audit.
+func WithAuditLog(audit *AuditLog) ServerOption {
+	return func(p *PlayerServer) {
+		p.audit = audit
+	}
+}
+
+// adminPlayerHandler deletes the player named in the path, the same as POST /admin/players/{name}/delete.
+func (p *PlayerServer) adminPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, r, "DELETE")
+		return
+	}
+
+	p.administer(w, r, AdminAction{Action: AdminDelete, Player: r.PathValue("name")})
+}
+
+// adminActionHandler makes the action named in the path to a player. Rename,
+// merge and adjust-wins take the rest of the AdminAction as a JSON body.
+func (p *PlayerServer) adminActionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var action AdminAction
+
+	if err := json.NewDecoder(r.Body).Decode(&action); err != nil && !errors.Is(err, io.EOF) {
+		writeErrorStatus(w, http.StatusBadRequest, fmt.Sprintf("problem parsing %s, %v", r.PathValue("action"), err))
+		return
+	}
+
+	action.Action = r.PathValue("action")
+	action.Player = r.PathValue("name")
+
+	p.administer(w, r, action)
+}
+
+func (p *PlayerServer) administer(w http.ResponseWriter, r *http.Request, action AdminAction) {
+	store, ok := p.store.(AdminStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not support administering players")
+		return
+	}
+
+	if p.audit == nil {
+		writeErrorStatus(w, http.StatusNotImplemented, "administering players needs an audit log")
+		return
+	}
+
+	entry, err := p.audit.Administer(store, actor(r), action)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (p *PlayerServer) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	if p.audit == nil {
+		writeErrorStatus(w, http.StatusNotImplemented, "this server does not keep an audit log")
+		return
+	}
+
+	entries, err := p.audit.Entries()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// actor describes who made a request, for the audit log.
+func actor(r *http.Request) string {
+	if token, ok := TokenFromContext(r.Context()); ok {
+		return fmt.Sprintf("%s (token %s)", token.Name, token.ID)
+	}
+
+	return "anonymous"
+}
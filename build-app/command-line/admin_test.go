@@ -0,0 +1,322 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createAdminStore returns a store where Cris, a typo of Chris, has won a game against Cleo.
+func createAdminStore(t *testing.T) *FileSystemPlayerStore {
+	t.Helper()
+
+	store := createSeasonStore(t)
+	store.RecordWin("Chris")
+	store.RecordWin("Chris")
+	store.RecordWin("Cleo")
+	store.RecordGame(Game{Players: []string{"Cris", "Cleo"}, Winner: "Cris"})
+
+	return store
+}
+
+func createAuditLog(t *testing.T) *AuditLog {
+	t.Helper()
+	return NewAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+}
+
+func TestAdminActions(t *testing.T) {
+	cases := []struct {
+		action AdminAction
+		result AdminResult
+		league []Player
+	}{
+		{
+			AdminAction{Action: AdminRename, Player: "Cris", To: "Christopher"},
+			AdminResult{Before: League{{"Cris", 1}}, After: League{{"Christopher", 1}}},
+			[]Player{{"Chris", 2}, {"Christopher", 1}, {"Cleo", 1}},
+		},
+		{
+			AdminAction{Action: AdminMerge, Player: "Chris", From: []string{" Cris"}},
+			AdminResult{Before: League{{"Chris", 2}, {"Cris", 1}}, After: League{{"Chris", 3}}},
+			[]Player{{"Chris", 3}, {"Cleo", 1}},
+		},
+		{
+			AdminAction{Action: AdminDelete, Player: "Cris"},
+			AdminResult{Before: League{{"Cris", 1}}, After: League{}, GamesDropped: 1},
+			[]Player{{"Chris", 2}, {"Cleo", 1}},
+		},
+		{
+			AdminAction{Action: AdminAdjustWins, Player: "Cleo", Delta: 4},
+			AdminResult{Before: League{{"Cleo", 1}}, After: League{{"Cleo", 5}}, GamesAdded: 4},
+			[]Player{{"Cleo", 5}, {"Chris", 2}, {"Cris", 1}},
+		},
+		{
+			AdminAction{Action: AdminReset, Player: "Chris"},
+			AdminResult{Before: League{{"Chris", 2}}, After: League{{"Chris", 0}}, GamesDropped: 2},
+			[]Player{{"Cris", 1}, {"Cleo", 1}, {"Chris", 0}},
+		},
+		{
+			AdminAction{Action: AdminAdjustWins, Player: "Chris", Delta: -1},
+			AdminResult{Before: League{{"Chris", 2}}, After: League{{"Chris", 1}}, GamesDropped: 1},
+			[]Player{{"Chris", 1}, {"Cris", 1}, {"Cleo", 1}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.action.Action, func(t *testing.T) {
+			store := createAdminStore(t)
+
+			result, err := store.Administer(c.action, func(AdminResult) error { return nil })
+			assertNoError(t, err)
+
+			if !reflect.DeepEqual(result, c.result) {
+				t.Errorf("got %+v want %+v", result, c.result)
+			}
+
+			assertStoreLeague(t, store, c.league)
+		})
+	}
+
+	t.Run("renames players in the games they played", func(t *testing.T) {
+		store := createAdminStore(t)
+
+		_, err := store.Administer(AdminAction{Action: AdminRename, Player: "Cris", To: "Chris P"}, func(AdminResult) error { return nil })
+		assertNoError(t, err)
+
+		games, _ := store.GetGames(GameFilter{Player: "Chris P"})
+
+		if len(games) != 1 || games[0].Winner != "Chris P" {
+			t.Errorf("got games %+v", games)
+		}
+	})
+
+	t.Run("changes the standings of an open season", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.now = func() time.Time { return monday }
+
+		_, err := store.StartSeason(DefaultLeague, "spring")
+		assertNoError(t, err)
+
+		store.RecordWin("Chris")
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+
+		administer := func(action AdminAction) {
+			t.Helper()
+			_, err := store.Administer(action, func(AdminResult) error { return nil })
+			assertNoError(t, err)
+		}
+
+		standings := func() League {
+			t.Helper()
+			seasons, _ := store.GetSeasons(DefaultLeague)
+			league, err := Standings(seasons[0], store)
+			assertNoError(t, err)
+			return league
+		}
+
+		administer(AdminAction{Action: AdminReset, Player: "Chris"})
+		assertLeague(t, standings(), []Player{{"Cleo", 1}})
+
+		administer(AdminAction{Action: AdminAdjustWins, Player: "Chris", Delta: 3})
+		assertLeague(t, standings(), []Player{{"Chris", 3}, {"Cleo", 1}})
+
+		administer(AdminAction{Action: AdminAdjustWins, Player: "Chris", Delta: -2})
+		assertLeague(t, standings(), []Player{{"Chris", 1}, {"Cleo", 1}})
+
+		stats, _ := store.GetPlayerStats("Chris")
+
+		if stats.Wins != 1 {
+			t.Errorf("got %d wins in Chris's stats want 1", stats.Wins)
+		}
+	})
+
+	t.Run("rejects changes that can't be made", func(t *testing.T) {
+		store := createAdminStore(t)
+
+		cases := map[string]struct {
+			action AdminAction
+			want   int
+		}{
+			"unknown player":       {AdminAction{Action: AdminReset, Player: "Pepper"}, http.StatusNotFound},
+			"rename onto a player": {AdminAction{Action: AdminRename, Player: "Cris", To: "Chris"}, http.StatusConflict},
+			"merge nobody":         {AdminAction{Action: AdminMerge, Player: "Chris"}, http.StatusBadRequest},
+			"merge into itself":    {AdminAction{Action: AdminMerge, Player: "Chris", From: []string{"Chris"}}, http.StatusBadRequest},
+			"negative wins":        {AdminAction{Action: AdminAdjustWins, Player: "Cleo", Delta: -2}, http.StatusBadRequest},
+			"too many wins":        {AdminAction{Action: AdminAdjustWins, Player: "Cleo", Delta: maxWinsAdjustment + 1}, http.StatusBadRequest},
+			"unknown action":       {AdminAction{Action: "promote", Player: "Cleo"}, http.StatusBadRequest},
+		}
+
+		for name, c := range cases {
+			_, err := store.Administer(c.action, func(AdminResult) error { return nil })
+
+			if got := statusFor(err); got != c.want {
+				t.Errorf("%s: got status %d want %d, %v", name, got, c.want, err)
+			}
+		}
+
+		assertStoreLeague(t, store, []Player{{"Chris", 2}, {"Cris", 1}, {"Cleo", 1}})
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+
+	t.Run("records who changed what", func(t *testing.T) {
+		store := createAdminStore(t)
+		audit := createAuditLog(t)
+
+		_, err := audit.Administer(store, "ops", AdminAction{Action: AdminReset, Player: "Chris"})
+		assertNoError(t, err)
+
+		entries, err := audit.Entries()
+		assertNoError(t, err)
+
+		if len(entries) != 1 {
+			t.Fatalf("got %d entries want 1", len(entries))
+		}
+
+		entry := entries[0]
+
+		if entry.Actor != "ops" || entry.Time.IsZero() || entry.Action.Action != AdminReset {
+			t.Errorf("got %+v", entry)
+		}
+
+		if !reflect.DeepEqual(entry.Before, League{{"Chris", 2}}) || !reflect.DeepEqual(entry.After, League{{"Chris", 0}}) {
+			t.Errorf("got before %v after %v", entry.Before, entry.After)
+		}
+
+		if entry.State != AuditCommitted {
+			t.Errorf("got state %q want %q", entry.State, AuditCommitted)
+		}
+	})
+
+	t.Run("marks a change that fails to save as aborted", func(t *testing.T) {
+		audit := createAuditLog(t)
+		store := failingSaveStore{createAdminStore(t)}
+
+		_, err := audit.Administer(store, "ops", AdminAction{Action: AdminDelete, Player: "Cleo"})
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		entries, err := audit.Entries()
+		assertNoError(t, err)
+
+		if len(entries) != 1 || entries[0].State != AuditAborted || entries[0].Error != "disk full" {
+			t.Errorf("got %+v want one aborted entry", entries)
+		}
+	})
+
+	t.Run("abandons a change that can't be audited", func(t *testing.T) {
+		store := createAdminStore(t)
+
+		_, err := store.Administer(AdminAction{Action: AdminDelete, Player: "Cleo"}, func(AdminResult) error {
+			return errors.New("disk full")
+		})
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		assertPlayerScore(t, store, "Cleo", 1)
+	})
+}
+
+// failingSaveStore audits changes and then fails to save them.
+type failingSaveStore struct {
+	AdminStore
+}
+
+func (f failingSaveStore) Administer(action AdminAction, audit func(AdminResult) error) (AdminResult, error) {
+	return f.AdminStore.Administer(action, func(result AdminResult) error {
+		if err := audit(result); err != nil {
+			return err
+		}
+		return errors.New("disk full")
+	})
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	tokens := createTokenStore(t)
+	_, recorder, _ := tokens.Issue("table", RoleRecord)
+	_, admin, _ := tokens.Issue("ops", RoleAdmin)
+
+	newAdminRequest := func(method, path, body, token string) *http.Request {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	t.Run("makes changes and records them", func(t *testing.T) {
+		store := createAdminStore(t)
+		server := NewPlayerServer(store, WithAuth(tokens, RoleRead), WithAuditLog(createAuditLog(t)))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodPost, "/admin/players/Chris/merge", `{"from": ["Cris"]}`, admin))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var entry AuditEntry
+		json.NewDecoder(response.Body).Decode(&entry)
+
+		if !strings.HasPrefix(entry.Actor, "ops ") || !reflect.DeepEqual(entry.After, League{{"Chris", 3}}) {
+			t.Errorf("got %+v", entry)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodDelete, "/admin/players/Cleo", "", admin))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		assertStoreLeague(t, store, []Player{{"Chris", 3}})
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodGet, "/admin/audit", "", admin))
+
+		var entries []AuditEntry
+		json.NewDecoder(response.Body).Decode(&entries)
+
+		if len(entries) != 2 || entries[1].Action.Action != AdminDelete {
+			t.Errorf("got audit log %+v", entries)
+		}
+	})
+
+	t.Run("needs the admin role", func(t *testing.T) {
+		store := createAdminStore(t)
+		server := NewPlayerServer(store, WithAuth(tokens, RoleRead), WithAuditLog(createAuditLog(t)))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodPost, "/admin/players/Chris/reset", "", recorder))
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+		assertPlayerScore(t, store, "Chris", 2)
+	})
+
+	t.Run("reports bad requests", func(t *testing.T) {
+		server := NewPlayerServer(createAdminStore(t), WithAuditLog(createAuditLog(t)))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodPost, "/admin/players/Chris/adjust-wins", `{"delta": "lots"}`, ""))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodGet, "/admin/players/Chris/reset", "", ""))
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("is not implemented without an audit log", func(t *testing.T) {
+		server := NewPlayerServer(createAdminStore(t))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAdminRequest(http.MethodDelete, "/admin/players/Cleo", "", ""))
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+}
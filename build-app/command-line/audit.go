@@ -0,0 +1,186 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// AuditPending is a change written to the log but not yet known to be saved.
+	// An entry left pending was cut off by a crash, or its outcome couldn't
+	// be logged; the players show whether it was saved.
+	AuditPending = "pending"
+	// AuditCommitted is a change that was saved.
+	AuditCommitted = "committed"
+	// AuditAborted is a change that failed to save after it was logged.
+	AuditAborted = "aborted"
+)
+
+// AuditEntry records a change an administrator made to the players, who made it and when.
+type AuditEntry struct {
+	ID     string      `json:"id,omitempty"`
+	Time   time.Time   `json:"time"`
+	Actor  string      `json:"actor"`
+	Action AdminAction `json:"action"`
+	// State is whether the change was saved, one of AuditPending,
+	// AuditCommitted and AuditAborted.
+	State string `json:"state,omitempty"`
+	// Error is why an aborted change failed to save.
+	Error string `json:"error,omitempty"`
+	AdminResult
+}
+
+// AuditLog is an append-only file of AuditEntry, one JSON object per line.
+// Several processes, such as the CLI and a server, may append to the same log.
+// An entry is written before the change it records is saved and written again
+// with the outcome after, so the log never claims a change that didn't happen.
+type AuditLog struct {
+	path string
+	now  func() time.Time
+}
+
+// NewAuditLog appends to the audit log at path, which is created with the first entry.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path, now: time.Now}
+}
+
+// Administer makes action to store on behalf of actor. The change is only
+// saved once it has been written to the log as pending, and is then marked
+// committed or aborted. Failing to mark it doesn't undo a change already
+// saved, so that error is left out; the entry stays pending.
+func (a *AuditLog) Administer(store AdminStore, actor string, action AdminAction) (AuditEntry, error) {
+	return a.record(actor, action, func(audit func(AdminResult) error) error {
+		_, err := store.Administer(action, audit)
+		return err
+	})
+}
+
+// Import loads league into store on behalf of actor, logged the same way as
+// Administer with an AdminImport action.
+func (a *AuditLog) Import(store ImportStore, actor string, league League, mode string) (ImportResult, error) {
+	var result ImportResult
+
+	_, err := a.record(actor, AdminAction{Action: AdminImport, Mode: mode}, func(audit func(AdminResult) error) (err error) {
+		result, err = store.ImportLeague(league, mode, false, audit)
+		return err
+	})
+
+	return result, err
+}
+
+// record makes a change on behalf of actor, passing change the audit callback
+// that logs it as pending, then logs how it went.
+func (a *AuditLog) record(actor string, action AdminAction, change func(audit func(AdminResult) error) error) (AuditEntry, error) {
+	id, err := randomHex(8)
+
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	entry := AuditEntry{ID: id, Time: a.now().UTC(), Actor: actor, Action: action, State: AuditPending}
+	logged := false
+
+	err = change(func(result AdminResult) error {
+		entry.AdminResult = result
+
+		if err := a.append(entry); err != nil {
+			return err
+		}
+
+		logged = true
+		return nil
+	})
+
+	if !logged {
+		return entry, err
+	}
+
+	entry.State = AuditCommitted
+
+	if err != nil {
+		entry.State = AuditAborted
+		entry.Error = err.Error()
+	}
+
+	if a.append(entry) != nil {
+		entry.State = AuditPending
+	}
+
+	return entry, err
+}
+
+func (a *AuditLog) append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return fmt.Errorf("problem encoding audit entry, %v", err)
+	}
+
+	unlock, err := lockFile(a.path)
+
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+
+	if err != nil {
+		return fmt.Errorf("problem opening audit log %s, %v", a.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("problem appending to audit log %s, %w", a.path, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("problem syncing audit log %s, %w", a.path, err)
+	}
+
+	return nil
+}
+
+// Entries returns every change in the log, oldest first, each in the last
+// state it was logged in. Entries from before states were logged are committed.
+func (a *AuditLog) Entries() ([]AuditEntry, error) {
+	data, err := os.ReadFile(a.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return []AuditEntry{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("problem reading audit log %s, %v", a.path, err)
+	}
+
+	entries := []AuditEntry{}
+	index := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	for dec.More() {
+		var entry AuditEntry
+
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("problem parsing audit log %s, %v", a.path, err)
+		}
+
+		if entry.State == "" {
+			entry.State = AuditCommitted
+		}
+
+		if i, ok := index[entry.ID]; ok && entry.ID != "" {
+			entries[i] = entry
+			continue
+		}
+
+		index[entry.ID] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
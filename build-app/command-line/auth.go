@@ -0,0 +1,369 @@
+package poker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role decides what a client of the HTTP API is allowed to do.
+type Role string
+
+const (
+	// RoleNone can't do anything, it is used to turn away anonymous clients.
+	RoleNone Role = ""
+	// RoleRead can look at the league, games, stats and ratings.
+	RoleRead Role = "read"
+	// RoleRecord can also record wins and games.
+	RoleRecord Role = "record"
+	// RoleAdmin can also administer players.
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleNone: 0, RoleRead: 1, RoleRecord: 2, RoleAdmin: 3}
+
+// Allows reports whether the role includes everything required can do.
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// ParseRole checks name is one of the roles a token can be issued with.
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+
+	if _, ok := roleRanks[role]; !ok || role == RoleNone {
+		return RoleNone, fmt.Errorf("unknown role %q, use read, record or admin", name)
+	}
+
+	return role, nil
+}
+
+// Token is an API token as kept on disk. Only a hash of its secret is stored,
+// the secret itself is shown once when the token is issued.
+type Token struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Role    Role       `json:"role"`
+	Hash    string     `json:"hash"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// TokenVerifier looks up the token a client presented.
+type TokenVerifier interface {
+	Verify(secret string) (Token, error)
+}
+
+const tokenPrefix = "poker_"
+
+var errInvalidToken = errors.New("invalid or revoked token")
+
+// TokenStore keeps API tokens in a JSON file, picking up tokens issued or
+// revoked by other processes, such as the CLI, while a server is running.
+type TokenStore struct {
+	path   string
+	lock   sync.Mutex
+	tokens []Token
+	loaded os.FileInfo
+	now    func() time.Time
+}
+
+// NewTokenStore opens the token file at path, which is created on the first issued token.
+func NewTokenStore(path string) (*TokenStore, error) {
+	store := &TokenStore{path: path, now: time.Now}
+
+	if err := store.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *TokenStore) reloadIfChanged() error {
+	current, err := os.Stat(s.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens, s.loaded = nil, nil
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("problem getting file info from file %s, %v", s.path, err)
+	}
+
+	if s.loaded != nil && os.SameFile(current, s.loaded) && current.ModTime().Equal(s.loaded.ModTime()) && current.Size() == s.loaded.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+
+	if err != nil {
+		return fmt.Errorf("problem reading %s, %v", s.path, err)
+	}
+
+	var tokens []Token
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("problem parsing tokens from file %s, %v", s.path, err)
+	}
+
+	s.tokens = tokens
+	s.loaded = current
+
+	return nil
+}
+
+// update applies change to the latest tokens and writes them back, holding
+// the file lock so concurrent CLI runs can't lose each other's changes.
+func (s *TokenStore) update(change func(tokens []Token) ([]Token, error)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	unlock, err := lockFile(s.path)
+
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.reloadIfChanged(); err != nil {
+		return err
+	}
+
+	tokens, err := change(append([]Token{}, s.tokens...))
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+
+	s.tokens = tokens
+	s.loaded, err = os.Stat(s.path)
+
+	return err
+}
+
+// Issue creates a token with role, returning it along with the secret to hand to the client.
+func (s *TokenStore) Issue(name string, role Role) (Token, string, error) {
+	if _, err := ParseRole(string(role)); err != nil {
+		return Token{}, "", err
+	}
+
+	id, err := randomHex(8)
+
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	secret, err := randomHex(32)
+
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	token := Token{ID: id, Name: name, Role: role, Hash: hashSecret(secret), Created: s.now()}
+
+	err = s.update(func(tokens []Token) ([]Token, error) {
+		return append(tokens, token), nil
+	})
+
+	return token, tokenPrefix + id + "_" + secret, err
+}
+
+// Revoke stops the token with id from being accepted.
+func (s *TokenStore) Revoke(id string) (Token, error) {
+	var revoked Token
+
+	err := s.update(func(tokens []Token) ([]Token, error) {
+		for i, token := range tokens {
+			if token.ID != id {
+				continue
+			}
+
+			if token.Revoked == nil {
+				now := s.now()
+				tokens[i].Revoked = &now
+			}
+
+			revoked = tokens[i]
+			return tokens, nil
+		}
+
+		return nil, fmt.Errorf("no token with id %q", id)
+	})
+
+	return revoked, err
+}
+
+// Tokens lists every token ever issued, revoked ones included.
+func (s *TokenStore) Tokens() ([]Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return append([]Token{}, s.tokens...), nil
+}
+
+// Verify returns the live token a client's secret belongs to.
+func (s *TokenStore) Verify(presented string) (Token, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(presented, tokenPrefix), "_")
+
+	if !ok {
+		return Token{}, errInvalidToken
+	}
+
+	tokens, err := s.Tokens()
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	hash := hashSecret(secret)
+
+	for _, token := range tokens {
+		if token.ID == id && token.Revoked == nil && subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token, nil
+		}
+	}
+
+	return Token{}, errInvalidToken
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("problem generating token, %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// requiredRole is the least role allowed to make a request: reads need RoleRead,
+// anything under /admin/ and league imports need RoleAdmin, and every other
+// write needs RoleRecord.
+// WebSocket sessions can record wins, so they count as writes. Health checks
+// are open to anyone, as probes don't carry tokens, and so are signing in and
+// out and the stylesheet and script of the pages doing it.
+func requiredRole(r *http.Request) Role {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		return RoleNone
+	case r.URL.Path == "/login" || r.URL.Path == "/logout" || strings.HasPrefix(r.URL.Path, "/static/"):
+		return RoleNone
+	case strings.HasPrefix(r.URL.Path, "/admin/") || r.URL.Path == "/league/import":
+		return RoleAdmin
+	case headerHasToken(r.Header, "Upgrade", "websocket"):
+		return RoleRecord
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return RoleRead
+	default:
+		return RoleRecord
+	}
+}
+
+type tokenContextKey struct{}
+
+// TokenFromContext returns the token a request was authenticated with.
+func TokenFromContext(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(Token)
+	return token, ok
+}
+
+// authenticate checks the bearer token of every request has the role it needs.
+// Browsers may present the token kept by /login in a session cookie instead,
+// where sessionAllowed lets them; a session whose token is no longer valid is
+// forgotten. Requests without a token are treated as having the anonymous role.
+func authenticate(next http.Handler, tokens TokenVerifier, anonymous Role) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := anonymous
+		header := r.Header.Get("Authorization")
+		presented := ""
+
+		if header != "" {
+			var ok bool
+
+			if presented, ok = strings.CutPrefix(header, "Bearer "); !ok {
+				writeUnauthorized(w, r, "use an Authorization: Bearer token")
+				return
+			}
+		} else if cookie, err := r.Cookie(sessionCookie); err == nil && sessionAllowed(r) {
+			presented = cookie.Value
+		}
+
+		if presented != "" {
+			token, err := tokens.Verify(presented)
+
+			switch {
+			case errors.Is(err, errInvalidToken) && header == "":
+				setCookie(w, r, sessionCookie, "", -1)
+				presented = ""
+			case errors.Is(err, errInvalidToken):
+				writeUnauthorized(w, r, err.Error())
+				return
+			case err != nil:
+				writeError(w, err)
+				return
+			default:
+				role = token.Role
+				r = r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token))
+			}
+		}
+
+		if required := requiredRole(r); !role.Allows(required) {
+			if presented == "" {
+				writeUnauthorized(w, r, fmt.Sprintf("%s %s needs a token with the %s role", r.Method, r.URL.Path, required))
+				return
+			}
+
+			message := fmt.Sprintf("%s %s needs the %s role, token has %s", r.Method, r.URL.Path, required, role)
+
+			if acceptsHTML(r) {
+				renderDenied(w, http.StatusForbidden, message)
+				return
+			}
+
+			writeErrorStatus(w, http.StatusForbidden, message)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	if acceptsHTML(r) {
+		renderDenied(w, http.StatusUnauthorized, message)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="poker"`)
+	writeErrorStatus(w, http.StatusUnauthorized, message)
+}
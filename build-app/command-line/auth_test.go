@@ -0,0 +1,142 @@
+package poker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func createTokenStore(t *testing.T) *TokenStore {
+	t.Helper()
+
+	tokens, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	assertNoError(t, err)
+
+	return tokens
+}
+
+func TestTokenStore(t *testing.T) {
+
+	t.Run("verifies an issued token and stores only its hash", func(t *testing.T) {
+		tokens := createTokenStore(t)
+
+		issued, secret, err := tokens.Issue("ci", RoleRecord)
+		assertNoError(t, err)
+
+		got, err := tokens.Verify(secret)
+		assertNoError(t, err)
+
+		if got.ID != issued.ID || got.Role != RoleRecord {
+			t.Errorf("got %+v want %+v", got, issued)
+		}
+
+		data, _ := os.ReadFile(tokens.path)
+		_, raw, _ := strings.Cut(strings.TrimPrefix(secret, tokenPrefix), "_")
+
+		if strings.Contains(string(data), raw) {
+			t.Error("the token file contains the secret")
+		}
+	})
+
+	t.Run("rejects revoked and unknown tokens", func(t *testing.T) {
+		tokens := createTokenStore(t)
+
+		issued, secret, _ := tokens.Issue("ci", RoleRecord)
+		_, err := tokens.Revoke(issued.ID)
+		assertNoError(t, err)
+
+		if _, err := tokens.Verify(secret); err != errInvalidToken {
+			t.Errorf("got %v want %v for a revoked token", err, errInvalidToken)
+		}
+
+		if _, err := tokens.Verify(tokenPrefix + issued.ID + "_guess"); err != errInvalidToken {
+			t.Errorf("got %v want %v for a wrong secret", err, errInvalidToken)
+		}
+	})
+
+	t.Run("sees tokens issued by another process", func(t *testing.T) {
+		server := createTokenStore(t)
+
+		cli, err := NewTokenStore(server.path)
+		assertNoError(t, err)
+
+		_, secret, _ := cli.Issue("new", RoleRead)
+
+		if _, err := server.Verify(secret); err != nil {
+			t.Errorf("expected the server to accept the new token, got %v", err)
+		}
+	})
+
+	t.Run("can't issue a token without a role", func(t *testing.T) {
+		tokens := createTokenStore(t)
+
+		if _, _, err := tokens.Issue("nobody", RoleNone); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	tokens := createTokenStore(t)
+	_, reader, _ := tokens.Issue("dashboard", RoleRead)
+	_, recorder, _ := tokens.Issue("table", RoleRecord)
+	_, admin, _ := tokens.Issue("ops", RoleAdmin)
+
+	cases := []struct {
+		name      string
+		anonymous Role
+		method    string
+		path      string
+		token     string
+		want      int
+	}{
+		{"anonymous clients can read", RoleRead, http.MethodGet, "/league", "", http.StatusOK},
+		{"anonymous clients can't record wins", RoleRead, http.MethodPost, "/players/Pepper", "", http.StatusUnauthorized},
+		{"anonymous clients can be turned away", RoleNone, http.MethodGet, "/league", "", http.StatusUnauthorized},
+		{"readers can read", RoleNone, http.MethodGet, "/league", reader, http.StatusOK},
+		{"readers can't record wins", RoleNone, http.MethodPost, "/players/Pepper", reader, http.StatusForbidden},
+		{"recorders can record wins", RoleNone, http.MethodPost, "/players/Pepper", recorder, http.StatusAccepted},
+		{"recorders can't administer", RoleNone, http.MethodPost, "/admin/players", recorder, http.StatusForbidden},
+		{"admins can do anything", RoleNone, http.MethodPost, "/players/Pepper", admin, http.StatusAccepted},
+		{"bad tokens are unauthorized", RoleRead, http.MethodGet, "/league", "poker_nope_nope", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := StubPlayerStore{map[string]int{}, nil, nil}
+			server := NewPlayerServer(&store, WithAuth(tokens, c.anonymous))
+
+			request, _ := http.NewRequest(c.method, c.path, nil)
+			if c.token != "" {
+				request.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, c.want)
+
+			if c.want == http.StatusUnauthorized && response.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+
+	t.Run("handlers can see who made the request", func(t *testing.T) {
+		var got Token
+		handler := authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = TokenFromContext(r.Context())
+		}), tokens, RoleNone)
+
+		request := newGetRequest("/league")
+		request.Header.Set("Authorization", "Bearer "+admin)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		if got.Name != "ops" {
+			t.Errorf("got token %+v want the one for ops", got)
+		}
+	})
+}
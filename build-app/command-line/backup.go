@@ -0,0 +1,365 @@
+package poker
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBackupInterval is how often the webserver takes a snapshot by default.
+	DefaultBackupInterval = time.Hour
+	// DefaultBackupKeep is how many snapshots are kept by default.
+	DefaultBackupKeep = 48
+	// DefaultBackupMaxAge is how long snapshots are kept by default.
+	DefaultBackupMaxAge = 30 * 24 * time.Hour
+
+	backupPrefix     = "poker-"
+	backupExt        = ".json"
+	checksumExt      = ".sha256"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// SnapshotStore is implemented by stores that can copy out everything they hold at once.
+type SnapshotStore interface {
+	// Snapshot writes the whole store, as of a single revision, in the format
+	// of its database file, and returns that revision.
+	Snapshot(w io.Writer) (revision int64, err error)
+}
+
+// Backup is a snapshot kept in a backup directory, next to its checksum.
+type Backup struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Time     time.Time `json:"time"`
+	Revision int64     `json:"revision"`
+	Size     int64     `json:"size"`
+	// SHA256 is the checksum recorded when the snapshot was taken, empty if it is missing.
+	SHA256 string `json:"sha256"`
+}
+
+// BackupSummary describes what a verified snapshot holds.
+type BackupSummary struct {
+	Version  int   `json:"version"`
+	Revision int64 `json:"revision"`
+	Players  int   `json:"players"`
+	Games    int   `json:"games"`
+	Seasons  int   `json:"seasons"`
+}
+
+// Backups takes snapshots of a store into a directory, each written next to
+// a checksum file in the format of sha256sum, and prunes the old ones.
+type Backups struct {
+	dir string
+	// keep is how many snapshots are kept at most, 0 for no limit.
+	keep int
+	// maxAge is how old a snapshot may get before it is pruned, 0 for no limit.
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewBackups keeps snapshots in dir, which is created with the first one,
+// pruning all but the newest keep of them and those older than maxAge. Zero
+// turns either limit off, and the newest snapshot is never pruned.
+func NewBackups(dir string, keep int, maxAge time.Duration) *Backups {
+	return &Backups{dir: dir, keep: keep, maxAge: maxAge, now: time.Now}
+}
+
+// Take writes a snapshot of store and its checksum.
+func (b *Backups) Take(store SnapshotStore) (Backup, error) {
+	backup, _, err := b.take(store, false)
+	return backup, err
+}
+
+// take writes a snapshot of store, unless skipUnchanged is set and the newest
+// snapshot already has the same revision, in which case that one is returned
+// with taken false.
+func (b *Backups) take(store SnapshotStore, skipUnchanged bool) (backup Backup, taken bool, err error) {
+	var snapshot bytes.Buffer
+
+	revision, err := store.Snapshot(&snapshot)
+
+	if err != nil {
+		return Backup{}, false, fmt.Errorf("problem taking snapshot, %v", err)
+	}
+
+	if skipUnchanged {
+		backups, err := b.List()
+
+		if err != nil {
+			return Backup{}, false, err
+		}
+
+		if len(backups) > 0 && backups[0].Revision == revision {
+			return backups[0], false, nil
+		}
+	}
+
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return Backup{}, false, fmt.Errorf("problem creating backup directory %s, %v", b.dir, err)
+	}
+
+	sum := sha256.Sum256(snapshot.Bytes())
+
+	backup = Backup{
+		Time:     b.now().UTC().Truncate(time.Second),
+		Revision: revision,
+		Size:     int64(snapshot.Len()),
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+	backup.Name = fmt.Sprintf("%s%s-r%d%s", backupPrefix, backup.Time.Format(backupTimeFormat), revision, backupExt)
+	backup.Path = filepath.Join(b.dir, backup.Name)
+
+	// The checksum is written last, so a snapshot without one was never finished.
+	if err := writeFileAtomic(backup.Path, snapshot.Bytes()); err != nil {
+		return Backup{}, false, err
+	}
+
+	if err := writeFileAtomic(backup.Path+checksumExt, []byte(backup.SHA256+"  "+backup.Name+"\n")); err != nil {
+		return Backup{}, false, err
+	}
+
+	return backup, true, nil
+}
+
+// List returns the snapshots in the backup directory, newest first.
+func (b *Backups) List() ([]Backup, error) {
+	entries, err := os.ReadDir(b.dir)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("problem reading backup directory %s, %v", b.dir, err)
+	}
+
+	backups := []Backup{}
+
+	for _, entry := range entries {
+		backup, ok := parseBackupName(entry.Name())
+
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+
+		backup.Path = filepath.Join(b.dir, backup.Name)
+
+		if info, err := entry.Info(); err == nil {
+			backup.Size = info.Size()
+		}
+
+		backup.SHA256, _ = readChecksum(backup.Path)
+		backups = append(backups, backup)
+	}
+
+	slices.SortFunc(backups, func(a, b Backup) int {
+		if c := b.Time.Compare(a.Time); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(b.Revision, a.Revision)
+	})
+
+	return backups, nil
+}
+
+// Prune deletes the snapshots beyond the newest keep and those older than
+// maxAge, with their checksums, returning those deleted. The newest
+// snapshot is always kept.
+func (b *Backups) Prune() ([]Backup, error) {
+	backups, err := b.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []Backup{}
+	now := b.now()
+
+	for i, backup := range backups {
+		tooMany := b.keep > 0 && i >= b.keep
+		tooOld := b.maxAge > 0 && now.Sub(backup.Time) > b.maxAge
+
+		if i == 0 || (!tooMany && !tooOld) {
+			continue
+		}
+
+		if err := os.Remove(backup.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("problem pruning %s, %v", backup.Path, err)
+		}
+
+		os.Remove(backup.Path + checksumExt)
+		pruned = append(pruned, backup)
+	}
+
+	return pruned, nil
+}
+
+// Run takes a snapshot of store straight away and then every interval until
+// ctx is done, pruning after each one. A snapshot is skipped when nothing has
+// been written since the last one. Errors are passed to logf, as a failed
+// backup shouldn't stop the server.
+func (b *Backups) Run(ctx context.Context, store SnapshotStore, interval time.Duration, logf func(format string, args ...any)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if backup, taken, err := b.take(store, true); err != nil {
+			logf("backup failed: %v", err)
+		} else if taken {
+			logf("backed up revision %d to %s", backup.Revision, backup.Path)
+		}
+
+		if pruned, err := b.Prune(); err != nil {
+			logf("pruning backups failed: %v", err)
+		} else if len(pruned) > 0 {
+			logf("pruned %d old backups", len(pruned))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseBackupName reads the time and revision out of the name of a snapshot.
+func parseBackupName(name string) (Backup, bool) {
+	stem, ok := strings.CutPrefix(name, backupPrefix)
+
+	if !ok {
+		return Backup{}, false
+	}
+
+	if stem, ok = strings.CutSuffix(stem, backupExt); !ok {
+		return Backup{}, false
+	}
+
+	at, rev, ok := strings.Cut(stem, "-r")
+
+	if !ok {
+		return Backup{}, false
+	}
+
+	taken, err := time.Parse(backupTimeFormat, at)
+
+	if err != nil {
+		return Backup{}, false
+	}
+
+	revision, err := strconv.ParseInt(rev, 10, 64)
+
+	if err != nil {
+		return Backup{}, false
+	}
+
+	return Backup{Name: name, Time: taken, Revision: revision}, true
+}
+
+// readChecksum reads the checksum recorded for the snapshot at path.
+func readChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path + checksumExt)
+
+	if err != nil {
+		return "", fmt.Errorf("problem reading checksum of %s, %v", path, err)
+	}
+
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+
+	return sum, nil
+}
+
+// VerifyBackup checks the snapshot at path against its checksum and that it
+// holds a database this version can load.
+func VerifyBackup(path string) (BackupSummary, error) {
+	_, summary, err := verifyBackup(path)
+	return summary, err
+}
+
+func verifyBackup(path string) (database, BackupSummary, error) {
+	want, err := readChecksum(path)
+
+	if err != nil {
+		return database{}, BackupSummary{}, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return database{}, BackupSummary{}, fmt.Errorf("problem reading %s, %v", path, err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return database{}, BackupSummary{}, fmt.Errorf("%s is corrupt: its checksum is %s, recorded as %s", path, got, want)
+	}
+
+	version, err := schemaVersion(data)
+
+	if err != nil {
+		return database{}, BackupSummary{}, fmt.Errorf("%s is not a database, %v", path, err)
+	}
+
+	db, err := decodeDatabase(data)
+
+	if err != nil {
+		return database{}, BackupSummary{}, fmt.Errorf("%s can't be loaded, %v", path, err)
+	}
+
+	return db, BackupSummary{
+		Version:  version,
+		Revision: db.Revision,
+		Players:  len(db.Players),
+		Games:    len(db.Games),
+		Seasons:  len(db.Seasons),
+	}, nil
+}
+
+// RestoreBackup verifies the snapshot at path and swaps it in for the
+// database file at dbPath, holding the file lock, and keeping the file it
+// replaces as the .bak copy. The restored database is given the revision after
+// the one it replaces, so running servers and their caches see it as a new write.
+func RestoreBackup(path, dbPath string) (BackupSummary, error) {
+	db, summary, err := verifyBackup(path)
+
+	if err != nil {
+		return summary, err
+	}
+
+	unlock, err := lockFile(dbPath)
+
+	if err != nil {
+		return summary, err
+	}
+	defer unlock()
+
+	if current, err := os.ReadFile(dbPath); err == nil {
+		if replaced, err := decodeDatabase(current); err == nil && replaced.Revision >= db.Revision {
+			db.Revision = replaced.Revision
+		}
+	}
+
+	db.Revision++
+	summary.Revision = db.Revision
+
+	if err := json.NewEncoder(&tape{dbPath}).Encode(db); err != nil {
+		return summary, fmt.Errorf("problem restoring %s, %v", dbPath, err)
+	}
+
+	return summary, nil
+}
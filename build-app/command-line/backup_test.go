@@ -0,0 +1,246 @@
+package poker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createBackups(t *testing.T, keep int, maxAge time.Duration) *Backups {
+	t.Helper()
+	return NewBackups(filepath.Join(t.TempDir(), "backups"), keep, maxAge)
+}
+
+func TestBackups(t *testing.T) {
+
+	t.Run("takes snapshots with checksums that verify", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+
+		backup, err := createBackups(t, 0, 0).Take(store)
+		assertNoError(t, err)
+
+		if backup.Revision != 2 || !strings.HasSuffix(backup.Name, "-r2.json") {
+			t.Errorf("got %+v want revision 2", backup)
+		}
+
+		checksum, err := os.ReadFile(backup.Path + ".sha256")
+		assertNoError(t, err)
+
+		if want := backup.SHA256 + "  " + backup.Name + "\n"; string(checksum) != want {
+			t.Errorf("got checksum file %q want %q", checksum, want)
+		}
+
+		summary, err := VerifyBackup(backup.Path)
+		assertNoError(t, err)
+
+		if want := (BackupSummary{Version: LatestSchemaVersion(), Revision: 2, Players: 2, Games: 2, Seasons: 0}); summary != want {
+			t.Errorf("got %+v want %+v", summary, want)
+		}
+	})
+
+	t.Run("skips a snapshot when nothing was written since the last", func(t *testing.T) {
+		store := createSeasonStore(t)
+		backups := createBackups(t, 0, 0)
+		store.RecordWin("Cleo")
+
+		for i, want := range []bool{true, false} {
+			if _, taken, err := backups.take(store, true); err != nil || taken != want {
+				t.Errorf("snapshot %d: got taken %v, %v want %v", i+1, taken, err, want)
+			}
+		}
+
+		store.RecordWin("Cleo")
+
+		if _, taken, _ := backups.take(store, true); !taken {
+			t.Error("expected a snapshot after a write")
+		}
+	})
+
+	t.Run("prunes by count and age, keeping the newest", func(t *testing.T) {
+		store := createSeasonStore(t)
+		now := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+
+		backups := createBackups(t, 3, 90*time.Minute)
+		backups.now = func() time.Time { return now }
+
+		for range 5 {
+			store.RecordWin("Cleo")
+			_, err := backups.Take(store)
+			assertNoError(t, err)
+			now = now.Add(30 * time.Minute)
+		}
+
+		pruned, err := backups.Prune()
+		assertNoError(t, err)
+
+		if len(pruned) != 2 || pruned[0].Revision != 2 || pruned[1].Revision != 1 {
+			t.Errorf("got pruned %+v want revisions 2 and 1, beyond the newest 3", pruned)
+		}
+
+		now = now.Add(24 * time.Hour)
+
+		pruned, _ = backups.Prune()
+		kept, _ := backups.List()
+
+		if len(pruned) != 2 || len(kept) != 1 || kept[0].Revision != 5 {
+			t.Errorf("got pruned %+v kept %+v want only the newest left", pruned, kept)
+		}
+
+		if _, err := os.Stat(pruned[0].Path + ".sha256"); !os.IsNotExist(err) {
+			t.Errorf("expected the checksum of %s to be pruned too", pruned[0].Name)
+		}
+	})
+
+	t.Run("backs up on a schedule until stopped", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+		backups := createBackups(t, 0, 0)
+
+		var lock sync.Mutex
+		var logged []string
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+
+		go func() {
+			backups.Run(ctx, store, time.Millisecond, func(format string, args ...any) {
+				lock.Lock()
+				defer lock.Unlock()
+				logged = append(logged, fmt.Sprintf(format, args...))
+			})
+			close(stopped)
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+
+		for {
+			if list, _ := backups.List(); len(list) > 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for a backup")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-stopped
+
+		if list, _ := backups.List(); len(list) != 1 {
+			t.Errorf("got %d backups want 1, as nothing changed", len(list))
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if len(logged) != 1 || !strings.HasPrefix(logged[0], "backed up revision 1") {
+			t.Errorf("got log %q", logged)
+		}
+	})
+}
+
+func TestVerifyBackup(t *testing.T) {
+	store := createSeasonStore(t)
+	store.RecordWin("Cleo")
+
+	take := func(t *testing.T) Backup {
+		t.Helper()
+
+		backup, err := createBackups(t, 0, 0).Take(store)
+		assertNoError(t, err)
+
+		return backup
+	}
+
+	t.Run("rejects a snapshot that doesn't match its checksum", func(t *testing.T) {
+		backup := take(t)
+		os.WriteFile(backup.Path, []byte(`{"version": 2, "players": []}`), 0o644)
+
+		if _, err := VerifyBackup(backup.Path); err == nil || !strings.Contains(err.Error(), "corrupt") {
+			t.Errorf("expected a corrupt snapshot, got %v", err)
+		}
+	})
+
+	t.Run("rejects a snapshot without a checksum", func(t *testing.T) {
+		backup := take(t)
+		os.Remove(backup.Path + ".sha256")
+
+		if _, err := VerifyBackup(backup.Path); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("rejects a snapshot that isn't a database", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "poker-20260301T200000Z-r1.json")
+		sum := sha256.Sum256([]byte("not json"))
+		os.WriteFile(path, []byte("not json"), 0o644)
+		os.WriteFile(path+".sha256", []byte(hex.EncodeToString(sum[:])+"  x\n"), 0o644)
+
+		if _, err := VerifyBackup(path); err == nil || !strings.Contains(err.Error(), "not a database") {
+			t.Errorf("expected it not to be a database, got %v", err)
+		}
+	})
+}
+
+func TestRestoreBackup(t *testing.T) {
+
+	t.Run("swaps a snapshot in for the database", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+
+		backup, err := createBackups(t, 0, 0).Take(store)
+		assertNoError(t, err)
+
+		store.RecordWin("Chris")
+		store.RecordWin("Chris")
+
+		summary, err := RestoreBackup(backup.Path, store.path)
+		assertNoError(t, err)
+
+		if summary.Revision != 4 || summary.Players != 1 {
+			t.Errorf("got %+v want the snapshot's one player at revision 4", summary)
+		}
+
+		assertStoreLeague(t, store, []Player{{"Cleo", 1}})
+
+		if revision, _ := store.Revision(); revision.Number != 4 {
+			t.Errorf("got revision %d want 4, after the 3 before the restore", revision.Number)
+		}
+
+		replaced, err := os.ReadFile(backupPath(store.path))
+		assertNoError(t, err)
+
+		if !strings.Contains(string(replaced), "Chris") {
+			t.Error("expected the replaced database to be kept as the .bak copy")
+		}
+	})
+
+	t.Run("leaves the database alone when the snapshot is corrupt", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+
+		backup, err := createBackups(t, 0, 0).Take(store)
+		assertNoError(t, err)
+
+		os.WriteFile(backup.Path, []byte(`{"version": 2}`), 0o644)
+		store.RecordWin("Chris")
+
+		if _, err := RestoreBackup(backup.Path, store.path); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		assertStoreLeague(t, store, []Player{{"Chris", 1}, {"Cleo", 1}})
+	})
+}
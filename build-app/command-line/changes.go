@@ -0,0 +1,76 @@
+package poker
+
+import "sync"
+
+const (
+	// ChangeGame is published when a game, or a plain win, is recorded.
+	ChangeGame = "game"
+	// ChangeSeason is published when a season starts or closes.
+	ChangeSeason = "season"
+	// ChangePlayers is published when an administrator changes or imports players.
+	ChangePlayers = "players"
+	// ChangeReload is published when a store picks up writes another process
+	// made to the file it shares with it.
+	ChangeReload = "reload"
+)
+
+// Change describes a write to a store that may have changed the standings.
+type Change struct {
+	Type   string       `json:"type"`
+	Game   *Game        `json:"game,omitempty"`
+	Season *Season      `json:"season,omitempty"`
+	Admin  *AdminAction `json:"admin,omitempty"`
+	// Wins is the winner of Game's wins, counting it.
+	Wins int `json:"wins,omitempty"`
+}
+
+// ChangeNotifier is implemented by stores that tell subscribers when their
+// data changes. Writes made through the same store value are seen as they
+// happen; writes by other processes only once the store next reads the file.
+type ChangeNotifier interface {
+	// OnChange calls fn after every successful write, once the store can be
+	// read again, until the returned func is called.
+	OnChange(fn func(Change)) (cancel func())
+}
+
+// changeHooks implements ChangeNotifier for embedding in stores. The zero value is ready to use.
+type changeHooks struct {
+	hooksLock sync.Mutex
+	next      int
+	hooks     map[int]func(Change)
+}
+
+func (h *changeHooks) OnChange(fn func(Change)) func() {
+	h.hooksLock.Lock()
+	defer h.hooksLock.Unlock()
+
+	if h.hooks == nil {
+		h.hooks = map[int]func(Change){}
+	}
+
+	id := h.next
+	h.next++
+	h.hooks[id] = fn
+
+	return func() {
+		h.hooksLock.Lock()
+		defer h.hooksLock.Unlock()
+
+		delete(h.hooks, id)
+	}
+}
+
+// publish calls every hook with change. Stores must not hold their own lock while publishing.
+func (h *changeHooks) publish(change Change) {
+	h.hooksLock.Lock()
+	hooks := make([]func(Change), 0, len(h.hooks))
+
+	for _, fn := range h.hooks {
+		hooks = append(hooks, fn)
+	}
+	h.hooksLock.Unlock()
+
+	for _, fn := range hooks {
+		fn(change)
+	}
+}
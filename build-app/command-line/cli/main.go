@@ -1,17 +1,71 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
 
 	poker "go-learn/build-app/command-line"
+	"go-learn/build-app/command-line/client"
 )
 
 const dbFileName = "game.db.json"
 
 func main() {
-	store, close, err := poker.FileSystemPlayerStoreFromFile(dbFileName)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrate(os.Args[2:])
+			return
+		case "ratings":
+			ratings(os.Args[2:])
+			return
+		case "season":
+			season(os.Args[2:])
+			return
+		case "league":
+			league(os.Args[2:])
+			return
+		case "token":
+			token(os.Args[2:])
+			return
+		case "names":
+			names(os.Args[2:])
+			return
+		case "admin":
+			admin(os.Args[2:])
+			return
+		case "import":
+			importLeague(os.Args[2:])
+			return
+		case "export":
+			exportLeague(os.Args[2:])
+			return
+		case "backup":
+			backup(os.Args[2:])
+			return
+		case "restore":
+			restore(os.Args[2:])
+			return
+		}
+	}
+
+	play(os.Args[1:])
+}
+
+// play records the winner of a game, in the database file or, with -server,
+// on a web server, so results can be typed in away from the machine keeping them.
+func play(args []string) {
+	flags := flag.NewFlagSet("poker", flag.ExitOnError)
+	db, server, token := storeFlags(flags)
+	flags.Parse(args)
+
+	store, close, err := openStore(*db, *server, *token)
 
 	if err != nil {
 		log.Fatal(err)
@@ -20,5 +74,598 @@ func main() {
 
 	fmt.Println("Let's play poker")
 	fmt.Println("Type {Name} wins to record a win")
-	poker.NewCLI(store, os.Stdin).PlayPoker()
+
+	if err := poker.NewCLI(store, os.Stdin).PlayPoker(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		close()
+		os.Exit(1)
+	}
+}
+
+// migrate checks or applies schema migrations to the database file.
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to migrate")
+	check := flags.Bool("check", false, "only report pending migrations")
+	flags.Parse(args)
+
+	doc, err := os.ReadFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pending, version, err := poker.PendingMigrations(doc)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s is at schema version %d, latest is %d\n", *db, version, poker.LatestSchemaVersion())
+
+	for _, m := range pending {
+		fmt.Printf("  pending %d: %s\n", m.Version, m.Description)
+	}
+
+	if *check || len(pending) == 0 {
+		return
+	}
+
+	if _, err := poker.MigrateFile(*db); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("migrated %s to schema version %d\n", *db, poker.LatestSchemaVersion())
+}
+
+// ratings prints everyone's Elo rating.
+func ratings(args []string) {
+	flags := flag.NewFlagSet("ratings", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to read")
+	initial := flags.Float64("initial", poker.DefaultRatingParams.Initial, "rating of a new player")
+	k := flags.Float64("k", poker.DefaultRatingParams.K, "most a rating can move in one game")
+	flags.Parse(args)
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	rated, err := store.GetRatings(poker.RatingParams{Initial: *initial, K: *k})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	poker.WriteRatings(os.Stdout, rated)
+}
+
+// storeFlags registers the flags choosing between the database file and a web server.
+func storeFlags(flags *flag.FlagSet) (db, server, token *string) {
+	db = flags.String("db", dbFileName, "database file to use")
+	server = flags.String("server", "", "URL of a web server to use instead of the database file, such as http://poker.local:5000")
+	token = flags.String("token", os.Getenv("POKER_TOKEN"), "API token for -server, $POKER_TOKEN by default")
+	return db, server, token
+}
+
+// openStore opens the database file at db, or a client of the web server at server when one is given.
+func openStore(db, server, token string) (poker.PlayerStore, func(), error) {
+	if server == "" {
+		return poker.FileSystemPlayerStoreFromFile(db)
+	}
+
+	remote, err := client.New(server, client.WithToken(token))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return remote, func() {}, nil
+}
+
+// league prints the current standings in any of the formats the server offers.
+func league(args []string) {
+	flags := flag.NewFlagSet("league", flag.ExitOnError)
+	db, server, token := storeFlags(flags)
+	format := flags.String("format", "text", "output format, one of "+strings.Join(poker.LeagueFormats(), ", "))
+	flags.Parse(args)
+
+	encoder, err := poker.LeagueEncoderFor(*format)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, close, err := openStore(*db, *server, *token)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	standings, err := poker.DefaultStandings(store)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := encoder.Encode(os.Stdout, standings); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importLeague loads a league from a CSV or JSON file, such as one kept by export.
+func importLeague(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to import into")
+	format := flags.String("format", "", "format of the file, one of "+strings.Join(poker.ImportFormats(), ", ")+", by default taken from its extension")
+	mode := flags.String("mode", poker.ImportMerge, "merge to add the wins to those recorded, replace to make the league exactly the file")
+	dryRun := flags.Bool("dry-run", false, "show what would change without changing it")
+	auditLog := flags.String("audit-log", "audit.log", "append-only log of changes made by administrators")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("usage: import [flags] file")
+	}
+
+	path := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	decoder, err := poker.LeagueDecoderFor(*format)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	league, err := decoder.Decode(file)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	var result poker.ImportResult
+
+	if *dryRun {
+		result, err = store.ImportLeague(league, *mode, true, nil)
+	} else {
+		result, err = poker.NewAuditLog(*auditLog).Import(store, cliActor(), league, *mode)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s %d players with %d wins from %s\n", result.Mode, result.Players, result.Wins, path)
+
+	if len(result.Added) > 0 {
+		fmt.Printf("added %s\n", strings.Join(result.Added, ", "))
+	}
+
+	if len(result.Removed) > 0 {
+		fmt.Printf("removed %s\n", strings.Join(result.Removed, ", "))
+	}
+
+	if result.GamesDropped > 0 {
+		fmt.Printf("dropped %d games recorded before\n", result.GamesDropped)
+	}
+
+	if *dryRun {
+		fmt.Println("dry run, nothing was changed")
+	}
+}
+
+// exportLeague writes every player in a format import can read back.
+func exportLeague(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to export")
+	format := flags.String("format", "csv", "output format, one of "+strings.Join(poker.ImportFormats(), ", "))
+	flags.Parse(args)
+
+	if _, err := poker.LeagueDecoderFor(*format); err != nil {
+		log.Fatal(err)
+	}
+
+	encoder, err := poker.LeagueEncoderFor(*format)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	league, err := store.GetLeague()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := encoder.Encode(os.Stdout, league); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// backup takes a snapshot of the database into the backup directory and
+// prunes the old ones, the same as the webserver does on its schedule.
+func backup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to back up")
+	dir := flags.String("dir", "backups", "directory of snapshots")
+	keep := flags.Int("keep", poker.DefaultBackupKeep, "most snapshots to keep, 0 for no limit")
+	maxAge := flags.Duration("max-age", poker.DefaultBackupMaxAge, "longest time to keep a snapshot, 0 for no limit")
+	list := flags.Bool("list", false, "only list the snapshots, newest first")
+	flags.Parse(args)
+
+	backups := poker.NewBackups(*dir, *keep, *maxAge)
+
+	if *list {
+		kept, err := backups.List()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, b := range kept {
+			fmt.Printf("%s  revision %d  %d bytes  %s\n", b.Name, b.Revision, b.Size, b.Time.Local().Format(time.DateTime))
+		}
+
+		return
+	}
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	taken, err := backups.Take(store)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("backed up revision %d to %s\n", taken.Revision, taken.Path)
+
+	pruned, err := backups.Prune()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, b := range pruned {
+		fmt.Printf("pruned %s\n", b.Name)
+	}
+}
+
+// restore checks a snapshot against its checksum and swaps it in for the database.
+func restore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to restore")
+	check := flags.Bool("check", false, "only verify the snapshot")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("usage: restore [flags] snapshot")
+	}
+
+	snapshot := flags.Arg(0)
+	summary, err := poker.VerifyBackup(snapshot)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s is revision %d with %d players, %d games and %d seasons\n", snapshot, summary.Revision, summary.Players, summary.Games, summary.Seasons)
+
+	if *check {
+		return
+	}
+
+	restored, err := poker.RestoreBackup(snapshot, *db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("restored %s as revision %d, the database it replaced is kept as %s.bak\n", *db, restored.Revision, *db)
+}
+
+// season lists, starts or closes the seasons of a league.
+func season(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: season list|start|close [flags]")
+	}
+
+	flags := flag.NewFlagSet("season "+args[0], flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to use")
+	league := flags.String("league", poker.DefaultLeague, "league the season belongs to")
+	name := flags.String("name", "", "name of the season to start")
+	flags.Parse(args[1:])
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	switch args[0] {
+	case "list":
+		seasons, err := store.GetSeasons(*league)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, s := range seasons {
+			state := "open"
+			if !s.Open() {
+				state = "closed " + s.End.Format("2006-01-02")
+			}
+			fmt.Printf("%s\tstarted %s\t%s\n", s.Name, s.Start.Format("2006-01-02"), state)
+		}
+	case "start":
+		s, err := store.StartSeason(*league, *name)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("started season %s of league %s\n", s.Name, s.League)
+	case "close":
+		s, err := store.CloseSeason(*league)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("closed season %s of league %s, final table:\n", s.Name, s.League)
+		for i, player := range s.Final {
+			fmt.Printf("%d. %s %d\n", i+1, player.Name, player.Wins)
+		}
+	default:
+		log.Fatalf("unknown season command %q", args[0])
+	}
+}
+
+// token issues, revokes or lists the API tokens accepted by the web server.
+func token(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: token issue|revoke|list [flags]")
+	}
+
+	flags := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	file := flags.String("tokens", "tokens.json", "file of API tokens")
+	name := flags.String("name", "", "who the token is for")
+	role := flags.String("role", string(poker.RoleRecord), "role of the token: read, record or admin")
+	id := flags.String("id", "", "id of the token to revoke")
+	flags.Parse(args[1:])
+
+	tokens, err := poker.NewTokenStore(*file)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "issue":
+		r, err := poker.ParseRole(*role)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		t, secret, err := tokens.Issue(*name, r)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("issued token %s for %s with role %s, it won't be shown again:\n%s\n", t.ID, t.Name, t.Role, secret)
+	case "revoke":
+		t, err := tokens.Revoke(*id)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("revoked token %s for %s\n", t.ID, t.Name)
+	case "list":
+		all, err := tokens.Tokens()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, t := range all {
+			state := "active"
+			if t.Revoked != nil {
+				state = "revoked " + t.Revoked.Format("2006-01-02")
+			}
+			fmt.Printf("%s\t%s\t%s\tissued %s\t%s\n", t.ID, t.Name, t.Role, t.Created.Format("2006-01-02"), state)
+		}
+	default:
+		log.Fatalf("unknown token command %q", args[0])
+	}
+}
+
+// names applies a name policy to the database, merging players recorded
+// under names that only differ in case, spacing or Unicode form.
+func names(args []string) {
+	if len(args) == 0 || args[0] != "merge" {
+		log.Fatal("usage: names merge [flags]")
+	}
+
+	flags := flag.NewFlagSet("names merge", flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to tidy")
+	foldCase := flags.Bool("fold-case", false, "keep names in lower case, so names differing only in case are one player")
+	maxLength := flags.Int("max-length", poker.DefaultMaxNameLength, "longest name allowed, in characters")
+	dryRun := flags.Bool("dry-run", false, "show what would change without changing it")
+	flags.Parse(args[1:])
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	cleanup, err := store.ApplyNamePolicy(poker.NamePolicy{FoldCase: *foldCase, MaxLength: *maxLength}, *dryRun)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, merge := range cleanup.Merged {
+		fmt.Printf("%s <- %s (%d wins)\n", merge.Name, strings.Join(quoteAll(merge.From), ", "), merge.Wins)
+	}
+
+	for _, name := range cleanup.Dropped {
+		fmt.Printf("dropped %q\n", name)
+	}
+
+	if cleanup.GamesDropped > 0 {
+		fmt.Printf("dropped %d games without a winner\n", cleanup.GamesDropped)
+	}
+
+	if len(cleanup.Merged) == 0 && len(cleanup.Dropped) == 0 && cleanup.GamesDropped == 0 {
+		fmt.Println("every name already follows the policy")
+	}
+
+	if *dryRun {
+		fmt.Println("dry run, nothing was changed")
+	}
+}
+
+// admin corrects players by hand, recording every change in the audit log
+// shared with the web server, or prints that log.
+func admin(args []string) {
+	usage := "usage: admin " + strings.Join(poker.AdminActions, "|") + "|log [flags]"
+
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	flags := flag.NewFlagSet("admin "+args[0], flag.ExitOnError)
+	db := flags.String("db", dbFileName, "database file to change")
+	auditLog := flags.String("audit-log", "audit.log", "append-only log of changes made by administrators")
+	player := flags.String("player", "", "player to change, or to merge the others into")
+	to := flags.String("to", "", "new name of the player, for rename")
+	from := flags.String("from", "", "comma separated players to merge into -player, for merge")
+	delta := flags.Int("delta", 0, "wins to add to the player, negative to take away, for adjust-wins")
+	flags.Parse(args[1:])
+
+	audit := poker.NewAuditLog(*auditLog)
+
+	if args[0] == "log" {
+		entries, err := audit.Entries()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, entry := range entries {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s -> %s\n", entry.Time.Format(time.RFC3339), entry.State, entry.Actor, describe(entry.Action), players(entry.Before), players(entry.After))
+		}
+		return
+	}
+
+	action := poker.AdminAction{Action: args[0], Player: *player, To: *to, Delta: *delta}
+
+	if *from != "" {
+		action.From = strings.Split(*from, ",")
+	}
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(*db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	entry, err := audit.Administer(store, cliActor(), action)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s: %s -> %s\n", describe(action), players(entry.Before), players(entry.After))
+
+	if entry.GamesAdded > 0 {
+		fmt.Printf("added %d games won by %s\n", entry.GamesAdded, action.Player)
+	}
+
+	if entry.GamesDropped > 0 {
+		fmt.Printf("dropped %d games won by %s\n", entry.GamesDropped, action.Player)
+	}
+}
+
+// describe puts an admin action the way it would be typed.
+func describe(action poker.AdminAction) string {
+	switch action.Action {
+	case poker.AdminRename:
+		return fmt.Sprintf("rename %q to %q", action.Player, action.To)
+	case poker.AdminMerge:
+		return fmt.Sprintf("merge %s into %q", strings.Join(quoteAll(action.From), ", "), action.Player)
+	case poker.AdminAdjustWins:
+		return fmt.Sprintf("adjust-wins %q by %+d", action.Player, action.Delta)
+	case poker.AdminImport:
+		return fmt.Sprintf("import, %s", action.Mode)
+	default:
+		return fmt.Sprintf("%s %q", action.Action, action.Player)
+	}
+}
+
+// players lists the wins of each player, or says there is nobody.
+func players(league poker.League) string {
+	if len(league) == 0 {
+		return "nobody"
+	}
+
+	listed := make([]string, len(league))
+	for i, player := range league {
+		listed[i] = fmt.Sprintf("%s (%d wins)", player.Name, player.Wins)
+	}
+	return strings.Join(listed, ", ")
+}
+
+// cliActor is who the audit log says made a change from the command line.
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+
+	return "cli"
+}
+
+func quoteAll(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return quoted
 }
@@ -0,0 +1,285 @@
+// Package client records wins on and reads the league from a remote
+// PlayerServer, so a CLI can be used away from the machine keeping the scores.
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	poker "go-learn/build-app/command-line"
+)
+
+const (
+	// DefaultTimeout is how long a single request may take by default.
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetries is how many times a failed request is tried again by default.
+	DefaultRetries = 2
+	// DefaultBackoff is how long to wait before the first retry, doubling after each.
+	DefaultBackoff = 200 * time.Millisecond
+
+	// maxErrorBody is how much of an error response is read for its message.
+	maxErrorBody = 64 << 10
+)
+
+// Error is a failure reported by the server.
+type Error struct {
+	// Status is the HTTP status of the response.
+	Status int
+	// Message is the error the server gave.
+	Message string
+	// RetryAfter is how long the server asked to wait before trying again, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server responded %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Client implements poker.PlayerStore by calling a PlayerServer over HTTP.
+// It is safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	token   string
+	retries int
+	backoff time.Duration
+	sleep   func(time.Duration)
+}
+
+var _ poker.PlayerStore = (*Client)(nil)
+
+// Option configures optional behaviour of a Client.
+type Option func(*Client)
+
+// WithToken sends token as a bearer token with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTimeout limits how long a single request, retries aside, may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.http.Timeout = timeout
+	}
+}
+
+// WithRetries tries requests that failed for a reason that may pass, such as
+// the server restarting, up to retries more times, waiting backoff before the
+// first retry and twice as long before each one after.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithHTTPClient makes requests with httpClient, for its transport or cookies.
+// Its timeout is replaced by WithTimeout when that is given after it.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// New creates a Client for the PlayerServer at baseURL, such as http://poker.local:5000.
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("server URL must be http:// or https:// with a host, got %q", baseURL)
+	}
+
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+
+	c := &Client{
+		baseURL: parsed,
+		http:    &http.Client{Timeout: DefaultTimeout},
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+		sleep:   time.Sleep,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c, nil
+}
+
+// GetPlayerScore returns the wins of a player, zero for a player the server doesn't know.
+func (c *Client) GetPlayerScore(name string) (int, error) {
+	var score int
+
+	err := c.do(http.MethodGet, "/players/"+url.PathEscape(name), "", func(response *http.Response) error {
+		// The server answers 404 for a player without wins, with a score of 0.
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+			return errorFrom(response)
+		}
+
+		body, err := io.ReadAll(response.Body)
+
+		if err != nil {
+			return err
+		}
+
+		score, err = strconv.Atoi(strings.TrimSpace(string(body)))
+
+		if err != nil && response.StatusCode == http.StatusNotFound {
+			response.Body = io.NopCloser(bytes.NewReader(body))
+			return errorFrom(response)
+		}
+
+		if err != nil {
+			return fmt.Errorf("problem parsing score of %s, %v", name, err)
+		}
+
+		return nil
+	})
+
+	return score, err
+}
+
+// RecordWin records a win for a player. Retries carry the same Idempotency-Key,
+// so a server that remembers keys records the win once however often it is sent.
+func (c *Client) RecordWin(name string) error {
+	key, err := newIdempotencyKey()
+
+	if err != nil {
+		return err
+	}
+
+	return c.do(http.MethodPost, "/players/"+url.PathEscape(name), key, func(response *http.Response) error {
+		if response.StatusCode != http.StatusAccepted {
+			return errorFrom(response)
+		}
+
+		return nil
+	})
+}
+
+// GetLeague returns the standings the server shows on /league.
+func (c *Client) GetLeague() (poker.League, error) {
+	var league poker.League
+
+	err := c.do(http.MethodGet, "/league", "", func(response *http.Response) error {
+		if response.StatusCode != http.StatusOK {
+			return errorFrom(response)
+		}
+
+		var err error
+		league, err = poker.NewLeague(response.Body)
+		return err
+	})
+
+	return league, err
+}
+
+// do sends a request to path, retrying while it fails for a reason that may
+// pass, and hands the response to handle.
+func (c *Client) do(method, path, idempotencyKey string, handle func(*http.Response) error) error {
+	wait := c.backoff
+
+	for attempt := 0; ; attempt++ {
+		err := c.try(method, path, idempotencyKey, handle)
+
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return err
+		}
+
+		var serverErr *Error
+
+		if errors.As(err, &serverErr) && serverErr.RetryAfter > wait {
+			wait = serverErr.RetryAfter
+		}
+
+		c.sleep(wait)
+		wait *= 2
+	}
+}
+
+func (c *Client) try(method, path, idempotencyKey string, handle func(*http.Response) error) error {
+	request, err := http.NewRequest(method, c.baseURL.String()+path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	if idempotencyKey != "" {
+		request.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	response, err := c.http.Do(request)
+
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return handle(response)
+}
+
+// retryable reports whether err may go away by trying again: the server
+// couldn't be reached, or said it is unavailable for now.
+func retryable(err error) bool {
+	var serverErr *Error
+
+	if errors.As(err, &serverErr) {
+		switch serverErr.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var urlErr *url.Error
+
+	return errors.As(err, &urlErr)
+}
+
+// errorFrom reads the ErrorResponse the server sends with an error status.
+func errorFrom(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+
+	serverErr := &Error{Status: response.StatusCode, Message: strings.TrimSpace(string(body))}
+
+	var decoded poker.ErrorResponse
+
+	if json.Unmarshal(body, &decoded) == nil && decoded.Error != "" {
+		serverErr.Message = decoded.Error
+	}
+
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		serverErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return serverErr
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("problem generating idempotency key, %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	poker "go-learn/build-app/command-line"
+)
+
+func newStore(t *testing.T) *poker.FileSystemPlayerStore {
+	t.Helper()
+
+	store, close, err := poker.FileSystemPlayerStoreFromFile(filepath.Join(t.TempDir(), "game.db.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(close)
+
+	return store
+}
+
+func newClient(t *testing.T, handler http.Handler, options ...Option) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL, options...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.sleep = func(time.Duration) {}
+
+	return c
+}
+
+func assertServerError(t *testing.T, err error, status int) *Error {
+	t.Helper()
+
+	var serverErr *Error
+
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("got %v want an *Error with status %d", err, status)
+	}
+
+	if serverErr.Status != status {
+		t.Errorf("got status %d want %d, %v", serverErr.Status, status, err)
+	}
+
+	return serverErr
+}
+
+func TestClient(t *testing.T) {
+
+	t.Run("records wins and reads them back", func(t *testing.T) {
+		c := newClient(t, poker.NewPlayerServer(newStore(t)))
+
+		for _, name := range []string{"Chris", "Cleo", "Chris van Dam", "Chris"} {
+			if err := c.RecordWin(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		score, err := c.GetPlayerScore("Chris")
+
+		if err != nil || score != 2 {
+			t.Errorf("got score %d, %v want 2", score, err)
+		}
+
+		league, err := c.GetLeague()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := poker.League{{Name: "Chris", Wins: 2}, {Name: "Chris van Dam", Wins: 1}, {Name: "Cleo", Wins: 1}}
+
+		if !reflect.DeepEqual(league, want) {
+			t.Errorf("got %v want %v", league, want)
+		}
+	})
+
+	t.Run("scores a player the server doesn't know as zero", func(t *testing.T) {
+		c := newClient(t, poker.NewPlayerServer(newStore(t)))
+
+		score, err := c.GetPlayerScore("Pepper")
+
+		if err != nil || score != 0 {
+			t.Errorf("got score %d, %v want 0", score, err)
+		}
+	})
+
+	t.Run("reports the server's errors", func(t *testing.T) {
+		c := newClient(t, poker.NewPlayerServer(newStore(t)))
+
+		serverErr := assertServerError(t, c.RecordWin("a/b"), http.StatusBadRequest)
+
+		if serverErr.Message == "" {
+			t.Error("expected the server's message")
+		}
+	})
+
+	t.Run("sends its token", func(t *testing.T) {
+		tokens, err := poker.NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, secret, _ := tokens.Issue("table", poker.RoleRecord)
+		server := poker.NewPlayerServer(newStore(t), poker.WithAuth(tokens, poker.RoleRead))
+
+		assertServerError(t, newClient(t, server).RecordWin("Cleo"), http.StatusUnauthorized)
+
+		if err := newClient(t, server, WithToken(secret)).RecordWin("Cleo"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("passes on Retry-After when a win is too soon", func(t *testing.T) {
+		c := newClient(t, poker.NewPlayerServer(newStore(t), poker.WithWinInterval(time.Minute)))
+
+		c.RecordWin("Cleo")
+		serverErr := assertServerError(t, c.RecordWin("Cleo"), http.StatusTooManyRequests)
+
+		if serverErr.RetryAfter != time.Minute {
+			t.Errorf("got Retry-After %v want %v", serverErr.RetryAfter, time.Minute)
+		}
+	})
+}
+
+// flakyHandler answers the first failures requests with 503 before passing them on.
+type flakyHandler struct {
+	lock     sync.Mutex
+	failures int
+	keys     []string
+	next     http.Handler
+}
+
+func (f *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	f.keys = append(f.keys, r.Header.Get("Idempotency-Key"))
+	fail := len(f.keys) <= f.failures
+	f.lock.Unlock()
+
+	if fail {
+		http.Error(w, "restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	f.next.ServeHTTP(w, r)
+}
+
+func TestClientRetries(t *testing.T) {
+
+	t.Run("retries while the server is unavailable, with the same idempotency key", func(t *testing.T) {
+		store := newStore(t)
+		flaky := &flakyHandler{failures: 2, next: poker.NewPlayerServer(store)}
+		c := newClient(t, flaky)
+
+		if err := c.RecordWin("Cleo"); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(flaky.keys) != 3 || flaky.keys[0] == "" || flaky.keys[0] != flaky.keys[2] {
+			t.Errorf("got idempotency keys %q want the same one three times", flaky.keys)
+		}
+
+		if score, _ := store.GetPlayerScore("Cleo"); score != 1 {
+			t.Errorf("got score %d want 1", score)
+		}
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		flaky := &flakyHandler{failures: 10, next: http.NotFoundHandler()}
+		c := newClient(t, flaky, WithRetries(1, time.Millisecond))
+
+		_, err := c.GetLeague()
+
+		assertServerError(t, err, http.StatusServiceUnavailable)
+
+		if len(flaky.keys) != 2 {
+			t.Errorf("got %d requests want 2", len(flaky.keys))
+		}
+	})
+
+	t.Run("doesn't retry requests the server turned down", func(t *testing.T) {
+		flaky := &flakyHandler{next: poker.NewPlayerServer(newStore(t))}
+		c := newClient(t, flaky)
+
+		c.RecordWin("")
+
+		if len(flaky.keys) != 1 {
+			t.Errorf("got %d requests want 1", len(flaky.keys))
+		}
+	})
+
+	t.Run("times out slow requests", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		})
+		c := newClient(t, slow, WithTimeout(20*time.Millisecond), WithRetries(0, 0))
+		defer close(release)
+
+		_, err := c.GetLeague()
+
+		var timeout interface{ Timeout() bool }
+
+		if !errors.As(err, &timeout) || !timeout.Timeout() {
+			t.Errorf("got %v want a timeout", err)
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, bad := range []string{"", "poker.local:5000", "ftp://poker.local"} {
+		if _, err := New(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
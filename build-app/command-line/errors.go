@@ -0,0 +1,75 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"syscall"
+)
+
+// ErrorResponse is the JSON body PlayerServer sends with every error status.
+type ErrorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// StatusError is an error carrying the HTTP status it should be reported with.
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e StatusError) Unwrap() error {
+	return e.Err
+}
+
+// statusFor maps an error from a PlayerStore to the HTTP status reported to clients.
+func statusFor(err error) int {
+	var statusErr StatusError
+
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Status
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError reports err with the status statusFor gives it. Server errors
+// can carry paths and other internals, so they are logged and the client only
+// gets the status text; client errors are sent as they are.
+func writeError(w http.ResponseWriter, err error) {
+	writeErrorStatus(w, statusFor(err), errorMessage(err))
+}
+
+// errorMessage is what a client is told about err, by the rule writeError
+// follows: server errors are logged and reduced to their status text.
+func errorMessage(err error) string {
+	status := statusFor(err)
+
+	if status >= http.StatusInternalServerError {
+		slog.Error("request failed", slog.Int("status", status), slog.Any("error", err))
+		return http.StatusText(status)
+	}
+
+	return err.Error()
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeErrorStatus(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+}
+
+func writeErrorStatus(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{status, message})
+}
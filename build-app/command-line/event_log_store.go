@@ -0,0 +1,675 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	eventWin  = "win"
+	eventGame = "game"
+
+	snapshotSuffix = ".snapshot"
+	segmentSuffix  = ".segment-"
+
+	// DefaultCompactEvery is how many events are appended to the log before it is compacted.
+	DefaultCompactEvery = 1000
+)
+
+// Event is a single record in the event log.
+type Event struct {
+	Seq  int64     `json:"seq"`
+	Type string    `json:"type"`
+	Name string    `json:"name,omitempty"`
+	Time time.Time `json:"time"`
+	Game *Game     `json:"game,omitempty"`
+}
+
+// asGame returns the game an event recorded. A plain win is a game with a single player.
+func (e Event) asGame() (Game, bool) {
+	var game Game
+
+	switch e.Type {
+	case eventWin:
+		game = winGame(e.Name)
+	case eventGame:
+		if e.Game == nil {
+			return game, false
+		}
+		game = *e.Game
+	default:
+		return game, false
+	}
+
+	game.ID = e.Seq
+
+	if game.Time.IsZero() {
+		game.Time = e.Time
+	}
+
+	return game, true
+}
+
+// snapshot is the league, player statistics and ratings as they were after the event numbered Seq.
+type snapshot struct {
+	Seq     int64                  `json:"seq"`
+	League  League                 `json:"league"`
+	Stats   map[string]PlayerStats `json:"stats,omitempty"`
+	Ratings []Rating               `json:"ratings,omitempty"`
+	// Played is when the latest game counted in Stats was played.
+	Played *time.Time `json:"played,omitempty"`
+}
+
+// EventLogPlayerStore stores players as an append-only log of wins and games.
+// The league is rebuilt by replaying the log on top of the latest snapshot.
+// It is safe for concurrent use within a single process.
+type EventLogPlayerStore struct {
+	lock sync.Mutex
+	path string
+	// log is nil after it failed to be opened again, and is reopened by the next append.
+	log *os.File
+	// end is where the log ended before an append that failed, and is cut
+	// back to when it is reopened, or -1.
+	end    int64
+	league League
+	stats  statsBook
+	// played is when the latest game counted in stats was played. A game
+	// played before it leaves stats stale until they are worked out again.
+	played time.Time
+	stale  bool
+	rater  *Rater
+	seq    int64
+	// modified is the time of the last event applied.
+	modified     time.Time
+	pending      int
+	CompactEvery int
+	// Names is the policy player names are put through. Every process
+	// writing the same log must use the same one.
+	Names NamePolicy
+	now   func() time.Time
+	changeHooks
+}
+
+// NewEventLogPlayerStore opens the event log at path, replaying it to rebuild the league.
+func NewEventLogPlayerStore(path string) (*EventLogPlayerStore, error) {
+	store := &EventLogPlayerStore{
+		path:         path,
+		stats:        statsBook{},
+		rater:        NewRater(DefaultRatingParams),
+		end:          -1,
+		CompactEvery: DefaultCompactEvery,
+		now:          time.Now,
+	}
+
+	rated, err := store.loadSnapshot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.replay()
+
+	if err == nil {
+		err = store.restatIfStale()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !rated {
+		if err := store.rerate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := store.openLog(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// openLog opens the log for appending, first cutting off what a failed append left.
+func (e *EventLogPlayerStore) openLog() error {
+	log, err := os.OpenFile(e.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+
+	if err != nil {
+		return fmt.Errorf("problem opening event log %s, %v", e.path, err)
+	}
+
+	if e.end >= 0 {
+		if err := log.Truncate(e.end); err != nil {
+			log.Close()
+			return fmt.Errorf("problem truncating event log %s, %v", e.path, err)
+		}
+
+		e.end = -1
+	}
+
+	e.log = log
+
+	return nil
+}
+
+// abandon cuts the log back to end after an append failed, so the event is
+// neither left half written before the next one nor kept without being
+// applied. If the log can't be cut now, it is closed and cut when reopened.
+func (e *EventLogPlayerStore) abandon(end int64, err error) error {
+	if e.log.Truncate(end) == nil {
+		return err
+	}
+
+	e.log.Close()
+	e.log = nil
+	e.end = end
+
+	return err
+}
+
+// EventLogPlayerStoreFromFile creates a PlayerStore from the event log found at path.
+func EventLogPlayerStoreFromFile(path string) (*EventLogPlayerStore, func(), error) {
+	store, err := NewEventLogPlayerStore(path)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem creating event log player store, %v", err)
+	}
+
+	return store, func() { store.Close() }, nil
+}
+
+// loadSnapshot starts the store off from the latest snapshot, reporting
+// whether it carried the ratings too. Snapshots written before ratings were
+// kept don't.
+func (e *EventLogPlayerStore) loadSnapshot() (rated bool, err error) {
+	data, err := os.ReadFile(e.path + snapshotSuffix)
+
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("problem reading snapshot of %s, %v", e.path, err)
+	}
+
+	var snap snapshot
+
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return false, fmt.Errorf("problem parsing snapshot of %s, %v", e.path, err)
+	}
+
+	e.seq = snap.Seq
+	e.league = snap.League
+
+	for name, stats := range snap.Stats {
+		stats := stats.copy()
+		e.stats[name] = &stats
+	}
+
+	// Snapshots written before the time of the latest game was kept can't
+	// tell whether the games after them were played later.
+	if snap.Played != nil {
+		e.played = *snap.Played
+	} else {
+		e.stale = len(snap.Stats) > 0
+	}
+
+	e.rater = restoreRater(DefaultRatingParams, snap.Ratings)
+
+	return snap.Ratings != nil || len(snap.League) == 0, nil
+}
+
+// rerate works the ratings out again from the full history, in the order it was recorded.
+func (e *EventLogPlayerStore) rerate() error {
+	history, err := e.history()
+
+	if err != nil {
+		return err
+	}
+
+	e.rater = NewRater(DefaultRatingParams)
+
+	for _, event := range history {
+		if game, ok := event.asGame(); ok {
+			e.rater.Update(game)
+		}
+	}
+
+	return nil
+}
+
+// restatIfStale works the statistics out again from the full history, in the
+// order the games were played, after a game was recorded that was played
+// before one already counted.
+func (e *EventLogPlayerStore) restatIfStale() error {
+	if !e.stale {
+		return nil
+	}
+
+	history, err := e.history()
+
+	if err != nil {
+		return err
+	}
+
+	var games []Game
+
+	for _, event := range history {
+		if game, ok := event.asGame(); ok {
+			games = append(games, game)
+		}
+	}
+
+	e.stats = statsFromGames(games)
+	e.played = time.Time{}
+
+	for _, game := range games {
+		if game.Time.After(e.played) {
+			e.played = game.Time
+		}
+	}
+
+	e.stale = false
+
+	return nil
+}
+
+// replay applies every event in the log newer than the snapshot. A torn record
+// at the end of the log, left by a crash half way through an append, is cut off.
+func (e *EventLogPlayerStore) replay() error {
+	file, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0666)
+
+	if err != nil {
+		return fmt.Errorf("problem opening event log %s, %v", e.path, err)
+	}
+	defer file.Close()
+
+	var good int64
+	rdr := bufio.NewReader(file)
+
+	for {
+		line, err := rdr.ReadBytes('\n')
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("problem reading event log %s, %v", e.path, err)
+		}
+
+		var event Event
+
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("problem parsing event log %s at offset %d, %v", e.path, good, err)
+		}
+
+		good += int64(len(line))
+
+		if event.Seq <= e.seq {
+			continue
+		}
+
+		e.apply(event)
+		e.pending++
+	}
+
+	return file.Truncate(good)
+}
+
+func (e *EventLogPlayerStore) apply(event Event) {
+	e.seq = event.Seq
+	e.modified = event.Time
+
+	if game, ok := event.asGame(); ok {
+		e.league.recordGame(game)
+
+		if game.Time.Before(e.played) {
+			e.stale = true
+		} else if !e.stale {
+			e.stats.record(game)
+			e.played = game.Time
+		}
+
+		e.rater.Update(game)
+	}
+}
+
+// Revision returns the sequence number of the last event, and when it happened.
+func (e *EventLogPlayerStore) Revision() (Revision, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return Revision{e.seq, e.modified}, nil
+}
+
+// GetLeague returns the scores of all the players.
+func (e *EventLogPlayerStore) GetLeague() (League, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if err := e.restatIfStale(); err != nil {
+		return nil, err
+	}
+
+	league := append(League{}, e.league...)
+	league.SortBy(e.stats.snapshot(), DefaultSortKeys...)
+
+	return league, nil
+}
+
+// CanonicalName puts name in the canonical form of the store's name policy.
+func (e *EventLogPlayerStore) CanonicalName(name string) (string, error) {
+	return e.Names.Canonical(name)
+}
+
+// GetPlayerScore retrieves a player's score.
+func (e *EventLogPlayerStore) GetPlayerScore(name string) (int, error) {
+	name, err := e.Names.Canonical(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	player := e.league.Find(name)
+
+	if player != nil {
+		return player.Wins, nil
+	}
+
+	return 0, nil
+}
+
+// GetPlayerStats returns a player's statistics.
+func (e *EventLogPlayerStore) GetPlayerStats(name string) (PlayerStats, error) {
+	name, err := e.Names.Canonical(name)
+
+	if err != nil {
+		return PlayerStats{}, err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if err := e.restatIfStale(); err != nil {
+		return PlayerStats{}, err
+	}
+
+	stats, ok := e.stats.get(name)
+
+	if !ok {
+		return stats, StatusError{http.StatusNotFound, fmt.Errorf("%s hasn't played any games", name)}
+	}
+
+	return stats, nil
+}
+
+// GetRatings returns every player's rating, best first. Ratings for
+// DefaultRatingParams are kept up to date as events are applied.
+func (e *EventLogPlayerStore) GetRatings(params RatingParams) ([]Rating, error) {
+	if params != DefaultRatingParams {
+		games, err := e.GetGames(GameFilter{})
+		return ComputeRatings(games, params), err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.rater.Ratings(), nil
+}
+
+// RecordWin appends a win to the log, compacting the log when it has grown long enough.
+func (e *EventLogPlayerStore) RecordWin(name string) error {
+	name, err := e.Names.Canonical(name)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.record(Event{Type: eventWin, Name: name})
+	return err
+}
+
+// RecordGame appends a game to the log, returning it with its ID and time set.
+func (e *EventLogPlayerStore) RecordGame(game Game) (Game, error) {
+	game, err := e.Names.canonicalGame(game)
+
+	if err == nil {
+		game, err = game.normalise()
+	}
+
+	if err != nil {
+		return game, err
+	}
+
+	recorded, err := e.record(Event{Type: eventGame, Game: &game})
+
+	if err != nil {
+		return game, err
+	}
+
+	return recorded, nil
+}
+
+// record appends a game or win to the log and tells subscribers once the lock is released.
+func (e *EventLogPlayerStore) record(event Event) (Game, error) {
+	e.lock.Lock()
+	event, err := e.append(event)
+	game, _ := event.asGame()
+	wins := 0
+
+	if winner := e.league.Find(game.Winner); err == nil && winner != nil {
+		wins = winner.Wins
+	}
+	e.lock.Unlock()
+
+	if err != nil {
+		return Game{}, err
+	}
+
+	e.publish(Change{Type: ChangeGame, Game: &game, Wins: wins})
+
+	return game, nil
+}
+
+// GetGames returns the games matching filter, oldest first, read from the full history.
+func (e *EventLogPlayerStore) GetGames(filter GameFilter) ([]Game, error) {
+	if filter.Player != "" {
+		var err error
+		if filter.Player, err = e.Names.Canonical(filter.Player); err != nil {
+			return nil, err
+		}
+	}
+
+	history, err := e.History()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var games []Game
+
+	for _, event := range history {
+		if game, ok := event.asGame(); ok {
+			games = append(games, game)
+		}
+	}
+
+	return FilterGames(games, filter), nil
+}
+
+func (e *EventLogPlayerStore) append(event Event) (Event, error) {
+	event.Seq = e.seq + 1
+	event.Time = e.now().UTC()
+
+	line, err := json.Marshal(event)
+
+	if err != nil {
+		return event, fmt.Errorf("problem encoding event, %v", err)
+	}
+
+	if e.log == nil {
+		if err := e.openLog(); err != nil {
+			return event, err
+		}
+	}
+
+	info, err := e.log.Stat()
+
+	if err != nil {
+		return event, fmt.Errorf("problem reading event log %s, %w", e.path, err)
+	}
+
+	if _, err := e.log.Write(append(line, '\n')); err != nil {
+		return event, e.abandon(info.Size(), fmt.Errorf("problem appending to event log %s, %w", e.path, err))
+	}
+
+	if err := e.log.Sync(); err != nil {
+		return event, e.abandon(info.Size(), fmt.Errorf("problem syncing event log %s, %w", e.path, err))
+	}
+
+	e.apply(event)
+	e.pending++
+
+	// The event is durable at this point, so a failed compaction is not reported
+	// as a failed write; it is simply tried again after the next append.
+	if e.CompactEvery > 0 && e.pending >= e.CompactEvery {
+		e.compact()
+	}
+
+	return event, nil
+}
+
+// Compact writes the league to a snapshot and moves the events it covers into an
+// archived segment, so startup only has to replay what happened since.
+func (e *EventLogPlayerStore) Compact() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.compact()
+}
+
+func (e *EventLogPlayerStore) compact() error {
+	if err := e.restatIfStale(); err != nil {
+		return err
+	}
+
+	played := e.played
+	data, err := json.Marshal(snapshot{e.seq, e.league, e.stats.snapshot(), e.rater.rated(), &played})
+
+	if err != nil {
+		return fmt.Errorf("problem encoding snapshot, %v", err)
+	}
+
+	if err := writeFileAtomic(e.path+snapshotSuffix, data); err != nil {
+		return err
+	}
+
+	// The snapshot covers every event in the log, so whichever of the old log
+	// or a new one ends up open below, nothing is lost or replayed twice.
+	if e.log != nil {
+		if err := e.log.Close(); err != nil {
+			e.log = nil
+			return fmt.Errorf("problem closing event log %s, %v", e.path, err)
+		}
+
+		e.log = nil
+	}
+
+	segment := fmt.Sprintf("%s%s%020d", e.path, segmentSuffix, e.seq)
+
+	if err := os.Rename(e.path, segment); err != nil {
+		return errors.Join(fmt.Errorf("problem archiving event log %s, %v", e.path, err), e.openLog())
+	}
+
+	if err := e.openLog(); err != nil {
+		return err
+	}
+
+	e.pending = 0
+
+	return syncDir(filepath.Dir(e.path))
+}
+
+// History returns every event ever recorded, oldest first, including archived segments.
+func (e *EventLogPlayerStore) History() ([]Event, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.history()
+}
+
+func (e *EventLogPlayerStore) history() ([]Event, error) {
+	segments, err := filepath.Glob(e.path + segmentSuffix + "*")
+
+	if err != nil {
+		return nil, fmt.Errorf("problem listing event log segments, %v", err)
+	}
+
+	sort.Strings(segments)
+
+	var events []Event
+
+	for _, path := range append(segments, e.path) {
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("problem reading event log %s, %v", path, err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+
+		for dec.More() {
+			var event Event
+
+			if err := dec.Decode(&event); err != nil {
+				return nil, fmt.Errorf("problem parsing event log %s, %v", path, err)
+			}
+
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// CheckHealth checks the event log is still open.
+func (e *EventLogPlayerStore) CheckHealth() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.log == nil {
+		return e.openLog()
+	}
+
+	if _, err := e.log.Stat(); err != nil {
+		return fmt.Errorf("problem checking event log %s, %v", e.path, err)
+	}
+
+	return nil
+}
+
+// Close closes the event log.
+func (e *EventLogPlayerStore) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.log == nil {
+		return nil
+	}
+
+	return e.log.Close()
+}
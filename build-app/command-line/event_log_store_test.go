@@ -0,0 +1,202 @@
+package poker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createEventLogStore(t *testing.T, dir string) *EventLogPlayerStore {
+	t.Helper()
+
+	store, err := NewEventLogPlayerStore(filepath.Join(dir, "game.log"))
+
+	assertNoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestEventLogStore(t *testing.T) {
+
+	t.Run("records wins and returns a sorted league", func(t *testing.T) {
+		store := createEventLogStore(t, t.TempDir())
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+		store.RecordWin("Chris")
+
+		assertPlayerScore(t, store, "Chris", 2)
+		assertStoreLeague(t, store, []Player{
+			{"Chris", 2},
+			{"Cleo", 1},
+		})
+	})
+
+	t.Run("rebuilds the league by replaying the log", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+		store.Close()
+
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Cleo", 1)
+		assertPlayerScore(t, store, "Chris", 1)
+	})
+
+	t.Run("ignores a torn record at the end of the log", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+
+		store.RecordWin("Cleo")
+		store.Close()
+
+		log, _ := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0666)
+		log.Write([]byte(`{"seq":2,"type":"win","na`))
+		log.Close()
+
+		store = createEventLogStore(t, dir)
+		store.RecordWin("Chris")
+		store.Close()
+
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Cleo", 1)
+		assertPlayerScore(t, store, "Chris", 1)
+	})
+
+	t.Run("skips a game event without a game when replaying", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+
+		store.RecordWin("Cleo")
+		store.Close()
+
+		log, _ := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0666)
+		log.Write([]byte(`{"seq":2,"type":"game","time":"2024-03-01T20:00:00Z"}` + "\n"))
+		log.Close()
+
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Cleo", 1)
+
+		if games, err := store.GetGames(GameFilter{}); err != nil || len(games) != 1 {
+			t.Errorf("got %d games, %v want 1", len(games), err)
+		}
+	})
+
+	t.Run("compacts the log into a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+		store.CompactEvery = 2
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+
+		info, err := os.Stat(store.path)
+		assertNoError(t, err)
+
+		if info.Size() == 0 {
+			t.Error("expected the win after compaction to be in the log")
+		}
+
+		store.Close()
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Cleo", 2)
+		assertPlayerScore(t, store, "Chris", 1)
+	})
+
+	t.Run("keeps appending when the log can't be archived", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+
+		store.RecordWin("Cleo")
+
+		// A directory in the way of the segment makes the rename fail.
+		segment := fmt.Sprintf("%s%s%020d", store.path, segmentSuffix, 1)
+		os.MkdirAll(filepath.Join(segment, "in-the-way"), 0o755)
+
+		if err := store.Compact(); err == nil {
+			t.Fatal("expected the compaction to fail")
+		}
+
+		assertNoError(t, store.RecordWin("Chris"))
+
+		os.RemoveAll(segment)
+		assertNoError(t, store.Compact())
+		assertNoError(t, store.RecordWin("Chris"))
+
+		store.Close()
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Cleo", 1)
+		assertPlayerScore(t, store, "Chris", 2)
+	})
+
+	t.Run("leaves nothing of an append that failed", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+
+		store.RecordWin("Cleo")
+
+		// A read only handle fails the write and can't be cut back either, so
+		// the log is cut when it is reopened.
+		store.log.Close()
+		store.log, _ = os.Open(store.path)
+
+		if err := store.RecordWin("Chris"); err == nil {
+			t.Fatal("expected the append to fail")
+		}
+
+		assertNoError(t, store.RecordWin("Pepper"))
+
+		history, err := store.History()
+		assertNoError(t, err)
+
+		if len(history) != 2 || history[1].Name != "Pepper" || history[1].Seq != 2 {
+			t.Errorf("got history %+v want Cleo then Pepper as event 2", history)
+		}
+
+		store.Close()
+		store = createEventLogStore(t, dir)
+
+		assertPlayerScore(t, store, "Chris", 0)
+		assertPlayerScore(t, store, "Pepper", 1)
+	})
+
+	t.Run("keeps the full history across compactions", func(t *testing.T) {
+		store := createEventLogStore(t, t.TempDir())
+		store.CompactEvery = 2
+		store.now = func() time.Time {
+			return time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC)
+		}
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+		store.RecordWin("Pepper")
+
+		history, err := store.History()
+		assertNoError(t, err)
+
+		if len(history) != 3 {
+			t.Fatalf("got %d events want %d", len(history), 3)
+		}
+
+		for i, name := range []string{"Cleo", "Chris", "Pepper"} {
+			if history[i].Name != name || history[i].Seq != int64(i+1) {
+				t.Errorf("got event %+v want %q with seq %d", history[i], name, i+1)
+			}
+		}
+
+		if !history[0].Time.Equal(store.now()) {
+			t.Errorf("got time %v want %v", history[0].Time, store.now())
+		}
+	})
+}
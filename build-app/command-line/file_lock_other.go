@@ -0,0 +1,11 @@
+//go:build !unix
+
+package poker
+
+const lockSuffix = ".lock"
+
+// lockFile is a no-op on platforms without flock, where only a single process
+// should use a database file at a time.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
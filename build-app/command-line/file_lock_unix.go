@@ -0,0 +1,32 @@
+//go:build unix
+
+package poker
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const lockSuffix = ".lock"
+
+// lockFile takes an exclusive advisory lock shared by every process using the
+// file at path, blocking until it is available. Call the returned func to release it.
+// The lock is held on a separate file, as the data file itself is replaced on every write.
+func lockFile(path string) (func(), error) {
+	lock, err := os.OpenFile(path+lockSuffix, os.O_RDWR|os.O_CREATE, 0666)
+
+	if err != nil {
+		return nil, fmt.Errorf("problem opening lock file for %s, %v", path, err)
+	}
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("problem locking %s, %v", path, err)
+	}
+
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
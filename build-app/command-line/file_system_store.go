@@ -2,36 +2,77 @@ package poker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
-	"sort"
+	"sync"
+	"time"
 )
 
-// FileSystemPlayerStore stores players in the filesystem.
+// FileSystemPlayerStore stores players in the filesystem as a versioned JSON document.
+// Files written by older versions are migrated when the store is created.
+// It is safe for concurrent use, and several processes may share the same file:
+// writes hold an advisory lock on the file and every access reloads the league
+// when another process has replaced the file since it was last read.
 type FileSystemPlayerStore struct {
+	path     string
 	database *json.Encoder
-	league   League
+	db       database
+	// stats and rater are worked out from db's games, the ratings for
+	// DefaultRatingParams, and kept up to date as games are recorded.
+	stats statsBook
+	rater *Rater
+	// loaded describes the file db was last read from or written to
+	loaded os.FileInfo
+	lock   sync.Mutex
+	now    func() time.Time
+	// MaxGames is how many games the file may hold, 0, the default, for no
+	// limit. The whole file is rewritten on every write, so it can be kept to
+	// a size that can be; past it, games are turned away until the history is
+	// moved to an EventLogPlayerStore, which only appends.
+	MaxGames int
+	changeHooks
 }
 
 // NewFileSystemPlayerStore creates a FileSystemPlayerStore initialising the store if needed.
 func NewFileSystemPlayerStore(file *os.File) (*FileSystemPlayerStore, error) {
+	unlock, err := lockFile(file.Name())
 
-	err := initialisePlayerDBFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = initialisePlayerDBFile(file)
 
 	if err != nil {
 		return nil, fmt.Errorf("problem initialising player db file, %v", err)
 	}
 
-	league, err := NewLeague(file)
+	db, err := recoverDatabase(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := os.Stat(file.Name())
 
 	if err != nil {
-		return nil, fmt.Errorf("problem loading player store from file %s, %v", file.Name(), err)
+		return nil, fmt.Errorf("problem getting file info from file %s, %v", file.Name(), err)
 	}
 
-	return &FileSystemPlayerStore{
-		database: json.NewEncoder(&tape{file}),
-		league:   league,
-	}, nil
+	store := &FileSystemPlayerStore{
+		path:     file.Name(),
+		database: json.NewEncoder(&tape{file.Name()}),
+		db:       db,
+		loaded:   loaded,
+		now:      time.Now,
+	}
+	store.index(&store.db)
+
+	return store, nil
 }
 
 // FileSystemPlayerStoreFromFile creates a PlayerStore from the contents of a JSON file found at path.
@@ -64,43 +105,495 @@ func initialisePlayerDBFile(file *os.File) error {
 		return fmt.Errorf("problem getting file info from file %s, %v", file.Name(), err)
 	}
 
-	if info.Size() == 0 {
-		file.Write([]byte("[]"))
+	if info.Size() == 0 && !fileExists(backupPath(file.Name())) {
+		json.NewEncoder(file).Encode(newDatabase())
 		file.Seek(0, 0)
 	}
 
 	return nil
 }
 
+// recoverDatabase loads the database from file, migrating it to the latest
+// schema version. When the file is torn or corrupt it falls back to the last
+// good copy and restores the file from it. A file written by a newer version
+// isn't corrupt, so it is left alone.
+func recoverDatabase(file *os.File) (database, error) {
+	removeStaleTempFiles(file.Name())
+
+	doc, err := io.ReadAll(file)
+
+	if err != nil {
+		return database{}, fmt.Errorf("problem reading %s, %v", file.Name(), err)
+	}
+
+	db, err := decodeDatabase(doc)
+
+	if err == nil {
+		_, err = migrateDocument(file.Name(), doc)
+		return db, err
+	}
+
+	loadErr := fmt.Errorf("problem loading player store from file %s, %w", file.Name(), err)
+
+	var newer NewerSchemaError
+
+	if errors.As(err, &newer) {
+		return database{}, loadErr
+	}
+
+	backup, err := os.ReadFile(backupPath(file.Name()))
+
+	if err != nil {
+		return database{}, loadErr
+	}
+
+	db, err = decodeDatabase(backup)
+
+	if err != nil {
+		return database{}, fmt.Errorf("%v, and the backup is unusable too, %v", loadErr, err)
+	}
+
+	if err := writeFileAtomic(file.Name(), backup); err != nil {
+		return database{}, fmt.Errorf("problem restoring %s from backup, %v", file.Name(), err)
+	}
+
+	_, err = migrateDocument(file.Name(), backup)
+	return db, err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// reloadIfChanged reads the database again when the file on disk is no longer
+// the one it was last loaded from, e.g. because another process recorded a win.
+func (f *FileSystemPlayerStore) reloadIfChanged() error {
+	current, err := os.Stat(f.path)
+
+	if err != nil {
+		return fmt.Errorf("problem getting file info from file %s, %v", f.path, err)
+	}
+
+	if os.SameFile(current, f.loaded) && current.ModTime().Equal(f.loaded.ModTime()) && current.Size() == f.loaded.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+
+	if err != nil {
+		return fmt.Errorf("problem reading %s, %v", f.path, err)
+	}
+
+	db, err := decodeDatabase(data)
+
+	if err != nil {
+		return fmt.Errorf("problem reloading player store from file %s, %v", f.path, err)
+	}
+
+	f.db = db
+	f.index(&f.db)
+	f.loaded = current
+
+	// Hooks read the store, so they can't run while it is locked, as it is here.
+	go f.publish(Change{Type: ChangeReload})
+
+	return nil
+}
+
+// index works out the statistics of db's games again, in the order they were
+// played as ComputeStats does, and the ratings in the order they were recorded,
+// as they are kept when games come in one by one.
+func (f *FileSystemPlayerStore) index(db *database) {
+	f.stats = statsFromGames(db.Games)
+	f.rater = rateGames(db.Games, DefaultRatingParams)
+}
+
+// read calls view with the latest database.
+func (f *FileSystemPlayerStore) read(view func(db *database) error) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.reloadIfChanged(); err != nil {
+		return err
+	}
+
+	return view(&f.db)
+}
+
+// update applies change to a copy of the latest database and writes it to disk
+// while holding the file lock. The database in memory is only replaced once the
+// write has succeeded, and the statistics and ratings are then worked out again.
+func (f *FileSystemPlayerStore) update(change func(db *database) error) error {
+	return f.write(change, f.index)
+}
+
+// write is update for changes that know how to bring the statistics and
+// ratings up to date with what they did, which committed is called to do
+// once the database in memory has been replaced.
+func (f *FileSystemPlayerStore) write(change func(db *database) error, committed func(db *database)) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	unlock, err := lockFile(f.path)
+
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := f.reloadIfChanged(); err != nil {
+		return err
+	}
+
+	next := f.db.clone()
+
+	if err := change(&next); err != nil {
+		return err
+	}
+
+	next.Revision++
+
+	if err := f.database.Encode(next); err != nil {
+		return fmt.Errorf("problem saving player store, %w", err)
+	}
+
+	f.db = next
+	committed(&f.db)
+
+	if loaded, err := os.Stat(f.path); err == nil {
+		f.loaded = loaded
+	}
+
+	return nil
+}
+
+// CheckHealth checks the database file can still be read and locked for writing.
+func (f *FileSystemPlayerStore) CheckHealth() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	unlock, err := lockFile(f.path)
+
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return f.reloadIfChanged()
+}
+
+// ApplyNamePolicy makes policy the one the file's names are put through, and
+// rewrites the names already recorded to match it, merging the players who
+// turn out to be the same. With dryRun set the file is left as it was.
+func (f *FileSystemPlayerStore) ApplyNamePolicy(policy NamePolicy, dryRun bool) (NameCleanup, error) {
+	var cleanup NameCleanup
+
+	if dryRun {
+		err := f.read(func(db *database) error {
+			next := db.clone()
+			cleanup = next.applyNamePolicy(policy)
+			return nil
+		})
+
+		return cleanup, err
+	}
+
+	err := f.update(func(db *database) error {
+		cleanup = db.applyNamePolicy(policy)
+		return nil
+	})
+
+	return cleanup, err
+}
+
+// Administer makes an administrator's change to the players, calling audit
+// with the result while the file is locked, before the change is saved.
+func (f *FileSystemPlayerStore) Administer(action AdminAction, audit func(AdminResult) error) (AdminResult, error) {
+	var result AdminResult
+
+	err := f.update(func(db *database) (err error) {
+		if result, err = db.administer(action, f.now); err != nil {
+			return err
+		}
+
+		if f.MaxGames > 0 && result.GamesAdded > 0 && len(db.Games) > f.MaxGames {
+			return StatusError{http.StatusInsufficientStorage, fmt.Errorf("the database holds its limit of %d games", f.MaxGames)}
+		}
+
+		return audit(result)
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	f.publish(Change{Type: ChangePlayers, Admin: &action})
+
+	return result, nil
+}
+
+// ImportLeague merges league into the file, or replaces the league with it, in
+// a single write. With dryRun set the file is left as it was.
+func (f *FileSystemPlayerStore) ImportLeague(league League, mode string, dryRun bool, audit func(AdminResult) error) (ImportResult, error) {
+	var result ImportResult
+
+	if dryRun {
+		err := f.read(func(db *database) (err error) {
+			next := db.clone()
+			result, _, err = next.importLeague(league, mode, f.now, f.MaxGames)
+			return err
+		})
+
+		result.DryRun = true
+
+		return result, err
+	}
+
+	err := f.update(func(db *database) error {
+		var audited AdminResult
+		var err error
+
+		if result, audited, err = db.importLeague(league, mode, f.now, f.MaxGames); err != nil {
+			return err
+		}
+
+		return audit(audited)
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	f.publish(Change{Type: ChangePlayers})
+
+	return result, nil
+}
+
+// Snapshot writes the database as of its latest revision, in the format of the file.
+func (f *FileSystemPlayerStore) Snapshot(w io.Writer) (int64, error) {
+	var revision int64
+
+	err := f.read(func(db *database) error {
+		revision = db.Revision
+		return json.NewEncoder(w).Encode(db)
+	})
+
+	return revision, err
+}
+
+// Revision returns the number of writes to the file, from any process, and when the last one was.
+func (f *FileSystemPlayerStore) Revision() (Revision, error) {
+	var revision Revision
+
+	err := f.read(func(db *database) error {
+		revision = Revision{db.Revision, f.loaded.ModTime()}
+		return nil
+	})
+
+	return revision, err
+}
+
 // GetLeague returns the scores of all the players.
-func (f *FileSystemPlayerStore) GetLeague() League {
-	sort.Slice(f.league, func(i, j int) bool {
-		return f.league[i].Wins > f.league[j].Wins
+func (f *FileSystemPlayerStore) GetLeague() (League, error) {
+	var league League
+
+	err := f.read(func(db *database) error {
+		league = append(League{}, db.Players...)
+		league.SortBy(f.stats.snapshot(), DefaultSortKeys...)
+		return nil
 	})
-	return f.league
+
+	return league, err
+}
+
+// CanonicalName puts name in the canonical form of the name policy kept in the file.
+func (f *FileSystemPlayerStore) CanonicalName(name string) (string, error) {
+	var canonical string
+
+	err := f.read(func(db *database) error {
+		var err error
+		canonical, err = db.Names.Canonical(name)
+		return err
+	})
+
+	return canonical, err
 }
 
 // GetPlayerScore retrieves a player's score.
-func (f *FileSystemPlayerStore) GetPlayerScore(name string) int {
+func (f *FileSystemPlayerStore) GetPlayerScore(name string) (int, error) {
+	var score int
 
-	player := f.league.Find(name)
+	err := f.read(func(db *database) error {
+		name, err := db.Names.Canonical(name)
 
-	if player != nil {
-		return player.Wins
-	}
+		if err != nil {
+			return err
+		}
 
-	return 0
+		if player := db.Players.Find(name); player != nil {
+			score = player.Wins
+		}
+		return nil
+	})
+
+	return score, err
 }
 
 // RecordWin will store a win for a player, incrementing wins if already known.
-func (f *FileSystemPlayerStore) RecordWin(name string) {
-	player := f.league.Find(name)
+func (f *FileSystemPlayerStore) RecordWin(name string) error {
+	_, err := f.RecordGame(winGame(name))
+	return err
+}
+
+// RecordGame stores a game and credits its winner, returning the game with its ID and time set.
+func (f *FileSystemPlayerStore) RecordGame(game Game) (Game, error) {
+	var wins int
+
+	err := f.write(func(db *database) error {
+		var err error
+		game, err = db.Names.canonicalGame(game)
+
+		if err == nil {
+			game, err = game.normalise()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if f.MaxGames > 0 && len(db.Games) >= f.MaxGames {
+			return StatusError{http.StatusInsufficientStorage, fmt.Errorf("the database holds its limit of %d games", f.MaxGames)}
+		}
+
+		game = db.addGame(game, f.now)
+		wins = db.Players.Find(game.Winner).Wins
+		return nil
+	}, func(db *database) {
+		// A game played before others already counted changes their streaks.
+		if playedLast(db.Games) {
+			f.stats.record(game)
+		} else {
+			f.stats = statsFromGames(db.Games)
+		}
 
-	if player != nil {
-		player.Wins++
-	} else {
-		f.league = append(f.league, Player{name, 1})
+		f.rater.Update(game)
+	})
+
+	if err != nil {
+		return game, err
 	}
 
-	f.database.Encode(f.league)
-}
\ No newline at end of file
+	f.publish(Change{Type: ChangeGame, Game: &game, Wins: wins})
+
+	return game, nil
+}
+
+// GetGames returns the games matching filter, oldest first.
+func (f *FileSystemPlayerStore) GetGames(filter GameFilter) ([]Game, error) {
+	var games []Game
+
+	err := f.read(func(db *database) error {
+		if filter.Player != "" {
+			var err error
+			if filter.Player, err = db.Names.Canonical(filter.Player); err != nil {
+				return err
+			}
+		}
+
+		games = FilterGames(db.Games, filter)
+		return nil
+	})
+
+	return games, err
+}
+
+// GetPlayerStats returns a player's statistics.
+func (f *FileSystemPlayerStore) GetPlayerStats(name string) (PlayerStats, error) {
+	var stats PlayerStats
+
+	err := f.read(func(db *database) error {
+		name, err := db.Names.Canonical(name)
+
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		stats, ok = f.stats.get(name)
+
+		if !ok {
+			return StatusError{http.StatusNotFound, fmt.Errorf("%s hasn't played any games", name)}
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// GetRatings returns every player's rating, best first. Ratings for
+// DefaultRatingParams are kept up to date as games are recorded.
+func (f *FileSystemPlayerStore) GetRatings(params RatingParams) ([]Rating, error) {
+	var ratings []Rating
+
+	err := f.read(func(db *database) error {
+		if params != DefaultRatingParams {
+			ratings = ComputeRatings(db.Games, params)
+		} else {
+			ratings = f.rater.Ratings()
+		}
+
+		return nil
+	})
+
+	return ratings, err
+}
+
+// GetSeasons returns every season of league, oldest first.
+func (f *FileSystemPlayerStore) GetSeasons(league string) ([]Season, error) {
+	var seasons []Season
+
+	err := f.read(func(db *database) error {
+		seasons = seasonsOf(db.Seasons, league)
+		return nil
+	})
+
+	return seasons, err
+}
+
+// StartSeason opens a new season of league, counting games from now on.
+func (f *FileSystemPlayerStore) StartSeason(league, name string) (Season, error) {
+	var season Season
+
+	err := f.update(func(db *database) (err error) {
+		season, err = db.startSeason(league, name, f.now().UTC())
+		return err
+	})
+
+	if err != nil {
+		return season, err
+	}
+
+	f.publish(Change{Type: ChangeSeason, Season: &season})
+
+	return season, nil
+}
+
+// CloseSeason ends the open season of league, archiving its final table.
+func (f *FileSystemPlayerStore) CloseSeason(league string) (Season, error) {
+	var season Season
+
+	err := f.update(func(db *database) (err error) {
+		season, err = db.closeSeason(league, f.now().UTC())
+		return err
+	})
+
+	if err != nil {
+		return season, err
+	}
+
+	f.publish(Change{Type: ChangeSeason, Season: &season})
+
+	return season, nil
+}
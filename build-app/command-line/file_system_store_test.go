@@ -2,7 +2,10 @@ package poker
 
 import (
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -18,12 +21,33 @@ func createTempFile(t *testing.T, initialData string) (*os.File, func()) {
 	tmpfile.Write([]byte(initialData))
 
 	removeFile := func() {
+		tmpfile.Close()
 		os.Remove(tmpfile.Name())
+		siblings, _ := filepath.Glob(tmpfile.Name() + ".*")
+		for _, sibling := range siblings {
+			os.Remove(sibling)
+		}
 	}
 
 	return tmpfile, removeFile
 }
 
+// reopenFile opens the file found at the path of file again, as the store
+// replaces the file on disk rather than writing through the original handle.
+func reopenFile(t *testing.T, file *os.File) *os.File {
+	t.Helper()
+
+	reopened, err := os.OpenFile(file.Name(), os.O_RDWR, 0666)
+
+	if err != nil {
+		t.Fatalf("could not reopen file %v", err)
+	}
+
+	t.Cleanup(func() { reopened.Close() })
+
+	return reopened
+}
+
 func TestFileSystemStore(t *testing.T) {
 
 	t.Run("league sorted", func(t *testing.T) {
@@ -36,7 +60,8 @@ func TestFileSystemStore(t *testing.T) {
 
 		assertNoError(t, err)
 
-		got := store.GetLeague()
+		got, err := store.GetLeague()
+		assertNoError(t, err)
 
 		want := []Player{
 			{"Chris", 33},
@@ -46,7 +71,8 @@ func TestFileSystemStore(t *testing.T) {
 		assertLeague(t, got, want)
 
 		// read again
-		got = store.GetLeague()
+		got, err = store.GetLeague()
+		assertNoError(t, err)
 		assertLeague(t, got, want)
 	})
 
@@ -60,7 +86,9 @@ func TestFileSystemStore(t *testing.T) {
 
 		assertNoError(t, err)
 
-		got := store.GetPlayerScore("Chris")
+		got, err := store.GetPlayerScore("Chris")
+		assertNoError(t, err)
+
 		want := 33
 		assertScoreEquals(t, got, want)
 	})
@@ -77,7 +105,9 @@ func TestFileSystemStore(t *testing.T) {
 
 		store.RecordWin("Chris")
 
-		got := store.GetPlayerScore("Chris")
+		got, err := store.GetPlayerScore("Chris")
+		assertNoError(t, err)
+
 		want := 34
 		assertScoreEquals(t, got, want)
 	})
@@ -94,7 +124,9 @@ func TestFileSystemStore(t *testing.T) {
 
 		store.RecordWin("Pepper")
 
-		got := store.GetPlayerScore("Pepper")
+		got, err := store.GetPlayerScore("Pepper")
+		assertNoError(t, err)
+
 		want := 1
 		assertScoreEquals(t, got, want)
 	})
@@ -107,6 +139,148 @@ func TestFileSystemStore(t *testing.T) {
 
 		assertNoError(t, err)
 	})
+
+	t.Run("keeps the league on disk after a win", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Cleo", "Wins": 10}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+
+		assertNoError(t, err)
+
+		store.RecordWin("Cleo")
+
+		store, err = NewFileSystemPlayerStore(reopenFile(t, database))
+
+		assertNoError(t, err)
+		assertPlayerScore(t, store, "Cleo", 11)
+	})
+
+	t.Run("recovers a torn file from the last good copy", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Cleo", "Wins": 10}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+
+		assertNoError(t, err)
+
+		store.RecordWin("Cleo")
+		os.WriteFile(database.Name(), []byte(`[{"Name": "Cle`), 0666)
+
+		store, err = NewFileSystemPlayerStore(reopenFile(t, database))
+
+		assertNoError(t, err)
+		assertPlayerScore(t, store, "Cleo", 10)
+
+		restored, _ := os.ReadFile(database.Name())
+		if _, err := decodeDatabase(restored); err != nil {
+			t.Errorf("expected the file to be restored but got %v", err)
+		}
+	})
+
+	t.Run("recovers a truncated file from the last good copy", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Cleo", "Wins": 10}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+
+		assertNoError(t, err)
+
+		store.RecordWin("Cleo")
+		os.Truncate(database.Name(), 0)
+
+		store, err = NewFileSystemPlayerStore(reopenFile(t, database))
+
+		assertNoError(t, err)
+		assertPlayerScore(t, store, "Cleo", 10)
+	})
+
+	t.Run("sees wins recorded by another store on the same file", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[]`)
+		defer cleanDatabase()
+
+		cli, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		webserver, err := NewFileSystemPlayerStore(reopenFile(t, database))
+		assertNoError(t, err)
+
+		cli.RecordWin("Chris")
+		webserver.RecordWin("Chris")
+		cli.RecordWin("Cleo")
+
+		assertPlayerScore(t, webserver, "Chris", 2)
+		assertPlayerScore(t, webserver, "Cleo", 1)
+		assertPlayerScore(t, cli, "Chris", 2)
+	})
+
+	t.Run("records concurrent wins without losing any", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		wantedCount := 50
+		var wg sync.WaitGroup
+		wg.Add(wantedCount)
+
+		for i := 0; i < wantedCount; i++ {
+			go func() {
+				store.RecordWin("Chris")
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+
+		assertPlayerScore(t, store, "Chris", wantedCount)
+	})
+
+	t.Run("returns an error when the file can no longer be read", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		os.Remove(database.Name())
+
+		if err := store.RecordWin("Chris"); err == nil {
+			t.Error("expected an error recording a win but didn't get one")
+		}
+
+		if _, err := store.GetLeague(); err == nil {
+			t.Error("expected an error getting the league but didn't get one")
+		}
+	})
+
+	t.Run("returns an error for a corrupt file without a backup", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[{"Name": "Cle`)
+		defer cleanDatabase()
+
+		_, err := NewFileSystemPlayerStore(database)
+
+		if err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("turns games away once the file holds its limit", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.MaxGames = 2
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Cleo")
+
+		if err := store.RecordWin("Chris"); statusFor(err) != http.StatusInsufficientStorage {
+			t.Errorf("got %v want status %d", err, http.StatusInsufficientStorage)
+		}
+
+		assertStoreLeague(t, store, []Player{{"Cleo", 2}})
+	})
 }
 
 func assertScoreEquals(t *testing.T, got, want int) {
@@ -116,9 +290,23 @@ func assertScoreEquals(t *testing.T, got, want int) {
 	}
 }
 
+func assertPlayerScore(t *testing.T, store PlayerStore, name string, want int) {
+	t.Helper()
+	got, err := store.GetPlayerScore(name)
+	assertNoError(t, err)
+	assertScoreEquals(t, got, want)
+}
+
+func assertStoreLeague(t *testing.T, store PlayerStore, want []Player) {
+	t.Helper()
+	got, err := store.GetLeague()
+	assertNoError(t, err)
+	assertLeague(t, got, want)
+}
+
 func assertNoError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
 		t.Fatalf("didn't expect an error but got one, %v", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,242 @@
+package poker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// LeagueEncoder writes a league in one output format.
+type LeagueEncoder struct {
+	// Format is the name used to pick the encoder with ?format= or --format.
+	Format      string
+	ContentType string
+	Encode      func(w io.Writer, league League) error
+	// EncodePage writes a page of the league along with its metadata. Formats
+	// without room for metadata leave it nil and only write the players.
+	EncodePage func(w io.Writer, page LeaguePage) error
+}
+
+// leagueEncoders are every known format, the first being the default.
+var leagueEncoders []LeagueEncoder
+
+// RegisterLeagueEncoder adds an output format for leagues.
+func RegisterLeagueEncoder(encoder LeagueEncoder) {
+	leagueEncoders = append(leagueEncoders, encoder)
+}
+
+// LeagueFormats lists the names of every registered format.
+func LeagueFormats() []string {
+	formats := make([]string, len(leagueEncoders))
+
+	for i, encoder := range leagueEncoders {
+		formats[i] = encoder.Format
+	}
+
+	return formats
+}
+
+// LeagueEncoderFor returns the encoder for the named format.
+func LeagueEncoderFor(format string) (LeagueEncoder, error) {
+	for _, encoder := range leagueEncoders {
+		if encoder.Format == format {
+			return encoder, nil
+		}
+	}
+
+	return LeagueEncoder{}, StatusError{http.StatusBadRequest, fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(LeagueFormats(), ", "))}
+}
+
+func init() {
+	RegisterLeagueEncoder(LeagueEncoder{"json", jsonContentType, encodeLeagueJSON, encodeLeaguePageJSON})
+	RegisterLeagueEncoder(LeagueEncoder{"csv", "text/csv; charset=utf-8", encodeLeagueCSV, nil})
+	RegisterLeagueEncoder(LeagueEncoder{"markdown", "text/markdown; charset=utf-8", encodeLeagueMarkdown, nil})
+	RegisterLeagueEncoder(LeagueEncoder{"text", "text/plain; charset=utf-8", encodeLeagueText, nil})
+	RegisterLeagueEncoder(LeagueEncoder{"html", "text/html; charset=utf-8", encodeLeagueHTML, nil})
+}
+
+func encodeLeagueJSON(w io.Writer, league League) error {
+	return json.NewEncoder(w).Encode(league)
+}
+
+func encodeLeaguePageJSON(w io.Writer, page LeaguePage) error {
+	return json.NewEncoder(w).Encode(page)
+}
+
+func encodeLeagueCSV(w io.Writer, league League) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"name", "wins"})
+
+	for _, player := range league {
+		out.Write([]string{escapeCSVFormula(player.Name), strconv.Itoa(player.Wins)})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvFormulaPrefixes are the characters spreadsheets start a formula with.
+const csvFormulaPrefixes = "=+-@"
+
+// escapeCSVFormula puts a ' in front of a cell a spreadsheet would run as a
+// formula, so a player named =HYPERLINK(...) is shown, not followed.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+// unescapeCSVFormula undoes escapeCSVFormula.
+func unescapeCSVFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+
+	return cell
+}
+
+func encodeLeagueMarkdown(w io.Writer, league League) error {
+	var b strings.Builder
+
+	b.WriteString("| # | Player | Wins |\n|---:|---|---:|\n")
+
+	for i, player := range league {
+		name := strings.ReplaceAll(player.Name, "|", `\|`)
+		fmt.Fprintf(&b, "| %d | %s | %d |\n", i+1, name, player.Wins)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func encodeLeagueText(w io.Writer, league League) error {
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(out, "#\tPlayer\tWins")
+
+	for i, player := range league {
+		fmt.Fprintf(out, "%d\t%s\t%d\n", i+1, player.Name, player.Wins)
+	}
+
+	return out.Flush()
+}
+
+var leagueTable = template.Must(template.New("league").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<table class="league">
+<thead><tr><th>#</th><th>Player</th><th>Wins</th></tr></thead>
+<tbody>
+{{- range $i, $p := .}}
+<tr><td>{{inc $i}}</td><td>{{$p.Name}}</td><td>{{$p.Wins}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+`))
+
+func encodeLeagueHTML(w io.Writer, league League) error {
+	return leagueTable.Execute(w, league)
+}
+
+// negotiateLeagueEncoder picks an encoder from the format query parameter,
+// falling back to the Accept header and then to JSON.
+func negotiateLeagueEncoder(r *http.Request) (LeagueEncoder, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return LeagueEncoderFor(format)
+	}
+
+	accept := r.Header.Get("Accept")
+
+	if accept == "" {
+		return leagueEncoders[0], nil
+	}
+
+	best, bestQ := -1, 0.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+
+		for i, encoder := range leagueEncoders {
+			if q > bestQ && mediaTypeMatches(mediaType, encoder.ContentType) {
+				best, bestQ = i, q
+				break
+			}
+		}
+	}
+
+	if best < 0 {
+		return LeagueEncoder{}, StatusError{http.StatusNotAcceptable, fmt.Errorf("can't produce %s, use one of %s", accept, strings.Join(LeagueFormats(), ", "))}
+	}
+
+	return leagueEncoders[best], nil
+}
+
+// mediaTypeMatches reports whether an Accept media range such as text/* covers contentType.
+func mediaTypeMatches(accepted, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if accepted == "*/*" || accepted == mediaType {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(accepted, "/*")
+
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// writeLeague sends a league in the format the client asked for.
+func writeLeague(w http.ResponseWriter, r *http.Request, league League) {
+	encoder, err := negotiateLeagueEncoder(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", encoder.ContentType)
+	w.Header().Add("Vary", "Accept")
+	encoder.Encode(w, league)
+}
+
+// writeLeaguePage sends a page of a league in the format the client asked for,
+// with links to the neighbouring pages in the Link header.
+func writeLeaguePage(w http.ResponseWriter, r *http.Request, page LeaguePage) {
+	encoder, err := negotiateLeagueEncoder(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if links := pageLinks(r.URL, page); links != "" {
+		w.Header().Set("Link", links)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	w.Header().Set("content-type", encoder.ContentType)
+	w.Header().Add("Vary", "Accept")
+
+	if encoder.EncodePage == nil {
+		encoder.Encode(w, page.Players)
+		return
+	}
+
+	encoder.EncodePage(w, page)
+}
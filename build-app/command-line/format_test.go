@@ -0,0 +1,118 @@
+package poker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLeagueFormats(t *testing.T) {
+	league := League{{"Cleo", 32}, {"Chris", 20}}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "name,wins\nCleo,32\nChris,20\n"},
+		{"markdown", "| # | Player | Wins |\n|---:|---|---:|\n| 1 | Cleo | 32 |\n| 2 | Chris | 20 |\n"},
+		{"text", "#  Player  Wins\n1  Cleo    32\n2  Chris   20\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			encoder, err := LeagueEncoderFor(c.format)
+			assertNoError(t, err)
+
+			var out bytes.Buffer
+			assertNoError(t, encoder.Encode(&out, league))
+
+			if out.String() != c.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), c.want)
+			}
+		})
+	}
+
+	t.Run("csv escapes names a spreadsheet would run as formulas", func(t *testing.T) {
+		encoder, _ := LeagueEncoderFor("csv")
+
+		var out bytes.Buffer
+		assertNoError(t, encoder.Encode(&out, League{{"=HYPERLINK(\"http://evil\")", 3}, {"-Cleo", 2}, {"+1", 1}, {"@Chris", 1}, {"Pepper-", 1}}))
+
+		want := "name,wins\n\"'=HYPERLINK(\"\"http://evil\"\")\",3\n'-Cleo,2\n'+1,1\n'@Chris,1\nPepper-,1\n"
+
+		if out.String() != want {
+			t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+		}
+
+		league, err := decodeLeagueCSV(&out)
+		assertNoError(t, err)
+
+		if league[1].Name != "-Cleo" || league[0].Name != `=HYPERLINK("http://evil")` {
+			t.Errorf("expected names to read back as they were, got %+v", league)
+		}
+	})
+
+	t.Run("html escapes player names", func(t *testing.T) {
+		encoder, _ := LeagueEncoderFor("html")
+
+		var out bytes.Buffer
+		assertNoError(t, encoder.Encode(&out, League{{"<b>Cleo</b>", 1}}))
+
+		if !strings.Contains(out.String(), "<td>1</td><td>&lt;b&gt;Cleo&lt;/b&gt;</td><td>1</td>") {
+			t.Errorf("expected an escaped row, got %s", out.String())
+		}
+	})
+}
+
+func TestLeagueContentNegotiation(t *testing.T) {
+	store := StubPlayerStore{nil, nil, []Player{{"Cleo", 32}}}
+	server := NewPlayerServer(&store)
+
+	cases := []struct {
+		name   string
+		path   string
+		accept string
+		want   string
+	}{
+		{"defaults to JSON", "/league", "", jsonContentType},
+		{"follows the Accept header", "/league", "text/csv", "text/csv; charset=utf-8"},
+		{"prefers the highest quality", "/league", "text/html;q=0.5, text/markdown", "text/markdown; charset=utf-8"},
+		{"matches media ranges", "/league", "text/*", "text/csv; charset=utf-8"},
+		{"a browser gets HTML", "/league", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"format overrides Accept", "/league?format=text", "application/json", "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := newGetRequest(c.path)
+			if c.accept != "" {
+				request.Header.Set("Accept", c.accept)
+			}
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertContentType(t, response, c.want)
+		})
+	}
+
+	t.Run("rejects an unknown format", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?format=xml"))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns 406 when nothing acceptable can be produced", func(t *testing.T) {
+		request := newGetRequest("/league")
+		request.Header.Set("Accept", "application/xml")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotAcceptable)
+	})
+}
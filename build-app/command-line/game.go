@@ -0,0 +1,184 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Game is the result of a single game of poker.
+type Game struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Players []string  `json:"players"`
+	Winner  string    `json:"winner"`
+	// League the game was played in, empty for the DefaultLeague.
+	League string `json:"league,omitempty"`
+	// BuyIn is what each player paid to join, zero when the game was played for fun.
+	BuyIn int `json:"buy_in,omitempty"`
+}
+
+// GameStore stores the full history of games, not just a running count of wins.
+type GameStore interface {
+	RecordGame(game Game) (Game, error)
+	GetGames(filter GameFilter) ([]Game, error)
+}
+
+// GameFilter selects games of League played in [From, To) that Player took part in.
+// Zero values match everything.
+type GameFilter struct {
+	From   time.Time
+	To     time.Time
+	Player string
+	League string
+}
+
+// Match reports whether game is selected by the filter.
+func (f GameFilter) Match(game Game) bool {
+	if !f.From.IsZero() && game.Time.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !game.Time.Before(f.To) {
+		return false
+	}
+
+	if f.Player != "" && !game.hasPlayer(f.Player) {
+		return false
+	}
+
+	if f.League != "" && leagueName(game.League) != leagueName(f.League) {
+		return false
+	}
+
+	return true
+}
+
+// FilterGames returns the games matching filter, oldest first.
+func FilterGames(games []Game, filter GameFilter) []Game {
+	matched := []Game{}
+
+	for _, game := range games {
+		if filter.Match(game) {
+			matched = append(matched, game)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Time.Before(matched[j].Time)
+	})
+
+	return matched
+}
+
+var errMissingWinner = errors.New("a game needs a winner")
+
+// normalise checks a game is complete, adding the winner to the players if missing.
+func (g Game) normalise() (Game, error) {
+	if g.Winner == "" {
+		return g, StatusError{http.StatusBadRequest, errMissingWinner}
+	}
+
+	if g.BuyIn < 0 {
+		return g, StatusError{http.StatusBadRequest, fmt.Errorf("buy-in can't be negative, got %d", g.BuyIn)}
+	}
+
+	if g.League != "" {
+		if err := validateSeasonName("league", g.League); err != nil {
+			return g, err
+		}
+	}
+
+	players := []string{}
+	seen := map[string]bool{}
+
+	for _, name := range append(g.Players, g.Winner) {
+		if name == "" {
+			return g, StatusError{http.StatusBadRequest, errors.New("player names can't be empty")}
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			players = append(players, name)
+		}
+	}
+
+	g.Players = players
+
+	return g, nil
+}
+
+func (g Game) hasPlayer(name string) bool {
+	for _, player := range g.Players {
+		if player == name {
+			return true
+		}
+	}
+	return false
+}
+
+// winGame is the game recorded for a plain RecordWin, where only the winner is known.
+func winGame(name string) Game {
+	return Game{Players: []string{name}, Winner: name}
+}
+
+// LeagueFromGames derives the league from a history of games.
+func LeagueFromGames(games []Game) League {
+	league := League{}
+
+	for _, game := range games {
+		league.recordGame(game)
+	}
+
+	return league
+}
+
+// parseGameFilter reads a filter from the from, to, player and league query parameters.
+// Dates can be RFC 3339 timestamps or plain days, in which case to includes the whole day.
+func parseGameFilter(query url.Values) (GameFilter, error) {
+	var filter GameFilter
+	var err error
+
+	filter.Player = query.Get("player")
+	filter.League = query.Get("league")
+
+	if from := query.Get("from"); from != "" {
+		filter.From, _, err = parseTime(from)
+
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		var day bool
+		filter.To, day, err = parseTime(to)
+
+		if err != nil {
+			return filter, err
+		}
+
+		if day {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+
+	if err != nil {
+		return t, false, StatusError{http.StatusBadRequest, fmt.Errorf("could not parse time %q, use RFC 3339 or YYYY-MM-DD", value)}
+	}
+
+	return t, true, nil
+}
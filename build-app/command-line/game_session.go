@@ -0,0 +1,121 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Messages sent to WebSocket clients playing a game on /ws.
+const (
+	PlayerPrompt          = "Please enter the number of players"
+	BadPlayerInputMessage = "Bad value received for number of players, please try again with a number of at least 2"
+	WinnerPrompt          = "Game started, send {Name} wins when the game is over"
+	BadWinnerInputMessage = "Bad value received for winner, please try again with {Name} wins"
+)
+
+// wsAlertWriter sends each blind alert to a WebSocket client as a message of its own.
+type wsAlertWriter struct {
+	ws *WebSocket
+}
+
+func (w wsAlertWriter) Write(p []byte) (int, error) {
+	if err := w.ws.WriteMessage([]byte(strings.TrimSuffix(string(p), "\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// webSocketHandler runs a game of poker with a client over a WebSocket: it asks
+// for the number of players, sends the blinds as they go up, then records the winner.
+func (p *PlayerServer) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := UpgradeWebSocket(w, r)
+
+	if err != nil {
+		return
+	}
+
+	p.games.Add(1)
+	defer p.games.Done()
+
+	finished := make(chan struct{})
+	defer close(finished)
+
+	go func() {
+		select {
+		case <-p.draining:
+			ws.CloseWith(wsCloseGoingAway, "server is shutting down")
+		case <-finished:
+		}
+	}()
+
+	game := NewTexasHoldem(p.alerter, serverStore{p.store, p})
+	defer game.Abandon()
+
+	if err := p.playGame(ws, game); err != nil {
+		var closeErr WebSocketCloseError
+
+		if !errors.As(err, &closeErr) {
+			ws.CloseWith(wsCloseInternalError, err.Error())
+		}
+		return
+	}
+
+	ws.Close()
+}
+
+func (p *PlayerServer) playGame(ws *WebSocket, game *TexasHoldem) error {
+	ws.WriteMessage([]byte(PlayerPrompt))
+
+	for {
+		message, err := ws.ReadMessage()
+
+		if err != nil {
+			return err
+		}
+
+		numberOfPlayers, err := strconv.Atoi(strings.TrimSpace(string(message)))
+
+		if err == nil {
+			err = game.Start(numberOfPlayers, wsAlertWriter{ws})
+		}
+
+		if err == nil {
+			break
+		}
+
+		ws.WriteMessage([]byte(BadPlayerInputMessage))
+	}
+
+	ws.WriteMessage([]byte(WinnerPrompt))
+
+	for {
+		message, err := ws.ReadMessage()
+
+		if err != nil {
+			return err
+		}
+
+		winner := strings.TrimSpace(extractWinner(string(message)))
+
+		if winner == "" {
+			ws.WriteMessage([]byte(BadWinnerInputMessage))
+			continue
+		}
+
+		err = game.Finish(winner)
+
+		if err != nil && statusFor(err) < http.StatusInternalServerError {
+			ws.WriteMessage([]byte(fmt.Sprintf("%s, %v", BadWinnerInputMessage, err)))
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not record a win for %s, %v", winner, err)
+		}
+
+		return ws.WriteMessage([]byte(fmt.Sprintf("%s wins, game over", winner)))
+	}
+}
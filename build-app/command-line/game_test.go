@@ -0,0 +1,207 @@
+package poker
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	monday = time.Date(2024, 3, 4, 20, 0, 0, 0, time.UTC)
+	friday = time.Date(2024, 3, 8, 20, 0, 0, 0, time.UTC)
+)
+
+func TestGameFilter(t *testing.T) {
+	games := []Game{
+		{ID: 2, Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		{ID: 1, Time: monday, Players: []string{"Chris", "Pepper"}, Winner: "Chris"},
+	}
+
+	cases := []struct {
+		name   string
+		filter GameFilter
+		want   []int64
+	}{
+		{"everything oldest first", GameFilter{}, []int64{1, 2}},
+		{"by player", GameFilter{Player: "Pepper"}, []int64{1}},
+		{"from is inclusive", GameFilter{From: friday}, []int64{2}},
+		{"to is exclusive", GameFilter{To: friday}, []int64{1}},
+		{"nothing matches", GameFilter{Player: "Apollo"}, []int64{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := []int64{}
+			for _, game := range FilterGames(games, c.filter) {
+				got = append(got, game.ID)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got games %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLeagueFromGames(t *testing.T) {
+	league := LeagueFromGames([]Game{
+		{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		{Players: []string{"Chris", "Pepper"}, Winner: "Chris"},
+	})
+
+	assertLeague(t, league, []Player{
+		{"Chris", 1},
+		{"Cleo", 2},
+		{"Pepper", 0},
+	})
+}
+
+// historyStore is a PlayerStore that also keeps the history of games.
+type historyStore interface {
+	PlayerStore
+	GameStore
+}
+
+func TestGameStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) historyStore{
+		"file system": func(t *testing.T) historyStore {
+			database, cleanDatabase := createTempFile(t, "")
+			t.Cleanup(cleanDatabase)
+
+			store, err := NewFileSystemPlayerStore(database)
+			assertNoError(t, err)
+			store.now = func() time.Time { return monday }
+			return store
+		},
+		"event log": func(t *testing.T) historyStore {
+			store := createEventLogStore(t, t.TempDir())
+			store.now = func() time.Time { return monday }
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			first, err := store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo", BuyIn: 500})
+			assertNoError(t, err)
+
+			if !first.Time.Equal(monday) || first.ID == 0 {
+				t.Errorf("expected the game to get an ID and the current time, got %+v", first)
+			}
+
+			_, err = store.RecordGame(Game{Time: friday, Players: []string{"Chris"}, Winner: "Pepper"})
+			assertNoError(t, err)
+
+			assertNoError(t, store.RecordWin("Chris"))
+
+			games, err := store.GetGames(GameFilter{Player: "Chris", From: friday})
+			assertNoError(t, err)
+
+			if len(games) != 1 || games[0].Winner != "Pepper" || !games[0].hasPlayer("Pepper") {
+				t.Errorf("got games %+v want only Pepper's win on friday", games)
+			}
+
+			all, err := store.GetGames(GameFilter{})
+			assertNoError(t, err)
+
+			league, err := store.GetLeague()
+			assertNoError(t, err)
+
+			derived := LeagueFromGames(all)
+			for _, player := range league {
+				if got := derived.Find(player.Name); got == nil || got.Wins != player.Wins {
+					t.Errorf("league %v can't be derived from the history %v", league, derived)
+				}
+			}
+
+			if _, err := store.RecordGame(Game{Players: []string{"Chris"}}); statusFor(err) != http.StatusBadRequest {
+				t.Errorf("expected a bad request for a game without a winner, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGamesEndpoint(t *testing.T) {
+	database, cleanDatabase := createTempFile(t, "")
+	defer cleanDatabase()
+
+	store, err := NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	store.RecordGame(Game{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Chris"})
+	store.RecordGame(Game{Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+
+	server := NewPlayerServer(store)
+
+	t.Run("lists games in a date range", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/games?from=2024-03-08&to=2024-03-08&player=Cleo", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		games := getGamesFromResponse(t, response.Body)
+		if len(games) != 1 || games[0].Winner != "Cleo" {
+			t.Errorf("got %+v want only Friday's game", games)
+		}
+	})
+
+	t.Run("records a game", func(t *testing.T) {
+		body := strings.NewReader(`{"players": ["Chris", "Pepper"], "winner": "Pepper", "buy_in": 1000}`)
+		request, _ := http.NewRequest(http.MethodPost, "/games", body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		assertPlayerScore(t, store, "Pepper", 1)
+	})
+
+	t.Run("rejects a game without a winner", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/games", strings.NewReader(`{"players": ["Chris"]}`))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("rejects a bad date", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/games?from=friday", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("is not implemented by stores without a history", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/games", nil)
+		response := httptest.NewRecorder()
+
+		NewPlayerServer(&StubPlayerStore{}).ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+}
+
+func getGamesFromResponse(t *testing.T, body io.Reader) []Game {
+	t.Helper()
+	var games []Game
+
+	if err := json.NewDecoder(body).Decode(&games); err != nil {
+		t.Fatalf("Unable to parse response from server into slice of Game, '%v'", err)
+	}
+
+	return games
+}
@@ -0,0 +1,100 @@
+package poker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// HealthChecker is implemented by stores that can check they are usable more
+// thoroughly than by answering a query, e.g. that their files can still be written.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// HealthResponse is the body of a successful /healthz or /readyz.
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// checkStore returns why store can't serve requests, if it can't.
+func checkStore(store PlayerStore) error {
+	if checker, ok := store.(HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+
+	_, err := store.GetLeague()
+	return err
+}
+
+func writeHealth(w http.ResponseWriter, status string) {
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(HealthResponse{status})
+}
+
+// healthzHandler reports the process is up and serving requests.
+func (p *PlayerServer) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	writeHealth(w, "ok")
+}
+
+// readyzHandler reports whether the server should be sent traffic: not while
+// it is shutting down, nor when the store can't be used.
+func (p *PlayerServer) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	select {
+	case <-p.draining:
+		writeErrorStatus(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	default:
+	}
+
+	if err := checkStore(p.store); err != nil {
+		slog.Error("store is not usable", "error", err)
+		writeErrorStatus(w, http.StatusServiceUnavailable, "store is not usable")
+		return
+	}
+
+	writeHealth(w, "ready")
+}
+
+// Drain makes /readyz fail and ends the /league/stream and /ws connections,
+// which http.Server.Shutdown neither closes nor waits for by itself. It is
+// meant to be passed to http.Server.RegisterOnShutdown.
+func (p *PlayerServer) Drain() {
+	p.drainOnce.Do(func() { close(p.draining) })
+}
+
+// Shutdown drains the server, stops listening for changes to the store, and
+// waits until the games played over /ws have stopped using it, or ctx is done.
+// Call it after http.Server.Shutdown and before closing the store.
+func (p *PlayerServer) Shutdown(ctx context.Context) error {
+	p.Drain()
+
+	for _, cancel := range p.unwatch {
+		cancel()
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		p.games.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package poker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks(t *testing.T) {
+
+	t.Run("healthz and readyz answer without a token", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t), WithAuth(createTokenStore(t), RoleNone))
+
+		for _, path := range []string{"/healthz", "/readyz"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest(path))
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertContentType(t, response, jsonContentType)
+		}
+	})
+
+	t.Run("readyz fails when the database file is gone", func(t *testing.T) {
+		store := createSeasonStore(t)
+		os.Remove(store.path)
+
+		response := httptest.NewRecorder()
+		NewPlayerServer(store).ServeHTTP(response, newGetRequest("/readyz"))
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+
+		if strings.Contains(response.Body.String(), store.path) {
+			t.Errorf("got body %q want the error kept out of it", response.Body.String())
+		}
+	})
+
+	t.Run("readyz fails once the event log is closed", func(t *testing.T) {
+		store := createEventLogStore(t, t.TempDir())
+		server := NewPlayerServer(store)
+		store.Close()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/readyz"))
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+	})
+
+	t.Run("readyz fails while draining but healthz does not", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{})
+		server.Drain()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/readyz"))
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/healthz"))
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+}
+
+func TestShutdown(t *testing.T) {
+
+	t.Run("tells games in progress the server is going away", func(t *testing.T) {
+		players := NewPlayerServer(createSeasonStore(t), WithBlindAlerter(instantAlerter))
+		server := httptest.NewServer(players)
+		t.Cleanup(server.Close)
+
+		ws := dialTestWebSocket(t, server.URL+"/ws")
+		assertWebSocketMessage(t, ws, PlayerPrompt)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assertNoError(t, players.Shutdown(ctx))
+
+		var closeErr WebSocketCloseError
+		if _, err := ws.ReadMessage(); !errors.As(err, &closeErr) || closeErr.Code != wsCloseGoingAway {
+			t.Errorf("got %v want a close with code %d", err, wsCloseGoingAway)
+		}
+	})
+
+	t.Run("ends league streams", func(t *testing.T) {
+		players := NewPlayerServer(createSeasonStore(t))
+		server := httptest.NewServer(players)
+		t.Cleanup(server.Close)
+
+		stream := openLeagueStream(t, server.URL, "")
+		readSSEEvent(t, stream)
+
+		players.Drain()
+
+		if _, err := stream.ReadString('\n'); err == nil {
+			t.Error("expected the stream to end")
+		}
+	})
+}
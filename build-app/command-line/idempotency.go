@@ -0,0 +1,291 @@
+package poker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyLimit is how many keys an IdempotencyStore remembers by default.
+	DefaultIdempotencyLimit = 1000
+	// DefaultIdempotencyTTL is how long a key is remembered by default.
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	maxIdempotentBody = 1 << 20
+)
+
+// idempotencyRecord is the response sent the first time a key was used.
+type idempotencyRecord struct {
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Time        time.Time `json:"time"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+}
+
+// IdempotencyStore remembers the responses to recent requests sent with an
+// Idempotency-Key header, so retries get the original response instead of
+// being applied twice. It keeps at most limit keys, each for at most ttl, in a JSON file.
+type IdempotencyStore struct {
+	path     string
+	limit    int
+	ttl      time.Duration
+	lock     sync.Mutex
+	records  []idempotencyRecord
+	inFlight map[string]bool
+	now      func() time.Time
+}
+
+// NewIdempotencyStore loads the keys remembered in the file at path, which is created when first needed.
+func NewIdempotencyStore(path string, limit int, ttl time.Duration) (*IdempotencyStore, error) {
+	store := &IdempotencyStore{path: path, limit: limit, ttl: ttl, inFlight: map[string]bool{}, now: time.Now}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s, %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, &store.records); err != nil {
+		return nil, fmt.Errorf("problem parsing idempotency keys from file %s, %v", path, err)
+	}
+
+	return store, nil
+}
+
+var (
+	errKeyInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+	errKeyReused   = errors.New("this Idempotency-Key was already used for a different request")
+)
+
+// begin returns the response remembered for key, or claims the key for a new
+// request until finish or release is called.
+func (s *IdempotencyStore) begin(key, fingerprint string) (*idempotencyRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expire()
+
+	for _, record := range s.records {
+		if record.Key != key {
+			continue
+		}
+
+		if record.Fingerprint != fingerprint {
+			return nil, StatusError{http.StatusUnprocessableEntity, errKeyReused}
+		}
+
+		return &record, nil
+	}
+
+	if s.inFlight[key] {
+		return nil, StatusError{http.StatusConflict, errKeyInFlight}
+	}
+
+	s.inFlight[key] = true
+
+	return nil, nil
+}
+
+// finish remembers the response to the request that claimed key.
+func (s *IdempotencyStore) finish(record idempotencyRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.inFlight, record.Key)
+
+	s.records = append(s.records, record)
+	s.expire()
+
+	data, err := json.Marshal(s.records)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data)
+}
+
+// release gives up the claim on key without remembering a response, so the request can be retried.
+func (s *IdempotencyStore) release(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.inFlight, key)
+}
+
+// expire forgets keys older than the ttl, then the oldest keys over the limit.
+func (s *IdempotencyStore) expire() {
+	cutoff := s.now().Add(-s.ttl)
+	kept := s.records[:0]
+
+	for _, record := range s.records {
+		if record.Time.After(cutoff) {
+			kept = append(kept, record)
+		}
+	}
+
+	if len(kept) > s.limit {
+		kept = kept[len(kept)-s.limit:]
+	}
+
+	s.records = kept
+}
+
+// responseCapture keeps a copy of a response as it is written.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// idempotent replays the remembered response to a POST that repeats the
+// Idempotency-Key of an earlier one. Keys are scoped to the API token used.
+// Server errors and rate limited responses are not remembered, so a retry can succeed.
+func idempotent(next http.Handler, store *IdempotencyStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token, ok := TokenFromContext(r.Context()); ok {
+			key = token.ID + ":" + key
+		}
+
+		var body []byte
+
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+
+			if err != nil {
+				writeErrorStatus(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("problem reading request, %v", err))
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		record, err := store.begin(key, fingerprint)
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if record != nil {
+			if record.ContentType != "" {
+				w.Header().Set("content-type", record.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+			return
+		}
+
+		capture := &responseCapture{ResponseWriter: w}
+		next.ServeHTTP(capture, r)
+
+		if capture.status == 0 || capture.status == http.StatusTooManyRequests || capture.status >= http.StatusInternalServerError {
+			store.release(key)
+			return
+		}
+
+		store.finish(idempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Time:        store.now(),
+			Status:      capture.status,
+			ContentType: w.Header().Get("content-type"),
+			Body:        capture.body.Bytes(),
+		})
+	})
+}
+
+// winLimiter turns away a win for a player recorded too soon after their last one.
+type winLimiter struct {
+	interval time.Duration
+	lock     sync.Mutex
+	last     map[string]time.Time
+	now      func() time.Time
+}
+
+func newWinLimiter(interval time.Duration) *winLimiter {
+	return &winLimiter{interval: interval, last: map[string]time.Time{}, now: time.Now}
+}
+
+// WinTooSoonError is returned for a win recorded within the interval of the player's last one.
+type WinTooSoonError struct {
+	Player string
+	Since  time.Duration
+	// Wait is how long until the player can win again.
+	Wait time.Duration
+}
+
+func (e WinTooSoonError) Error() string {
+	return fmt.Sprintf("%s won %v ago, wait before recording another win", e.Player, e.Since)
+}
+
+// allow reports whether name can win now, with a WinTooSoonError when they can't.
+// Allowed wins start a new interval, holding it against concurrent wins while
+// the win is saved; release gives it back for a win that couldn't be, so the
+// player can try again straight away.
+func (l *winLimiter) allow(name string) (release func(), err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+
+	if last, ok := l.last[name]; ok && now.Sub(last) < l.interval {
+		return nil, StatusError{http.StatusTooManyRequests, WinTooSoonError{name, now.Sub(last), l.interval - now.Sub(last)}}
+	}
+
+	for player, last := range l.last {
+		if now.Sub(last) >= l.interval {
+			delete(l.last, player)
+		}
+	}
+	l.last[name] = now
+
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		if l.last[name].Equal(now) {
+			delete(l.last, name)
+		}
+	}, nil
+}
@@ -0,0 +1,202 @@
+package poker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createIdempotencyStore(t *testing.T, limit int) *IdempotencyStore {
+	t.Helper()
+
+	store, err := NewIdempotencyStore(filepath.Join(t.TempDir(), "idempotency.json"), limit, DefaultIdempotencyTTL)
+	assertNoError(t, err)
+
+	return store
+}
+
+func newIdempotentWinRequest(name, key string) *http.Request {
+	request := newPostWinRequest(name)
+	request.Header.Set("Idempotency-Key", key)
+	return request
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+
+	t.Run("a retried win is only recorded once", func(t *testing.T) {
+		store := StubPlayerStore{map[string]int{}, nil, nil}
+		server := NewPlayerServer(&store, WithIdempotency(createIdempotencyStore(t, 10)))
+
+		for i := 0; i < 3; i++ {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newIdempotentWinRequest("Pepper", "game-night-1"))
+
+			assertStatus(t, response.Code, http.StatusAccepted)
+
+			if replayed := response.Header().Get("Idempotent-Replayed") == "true"; replayed != (i > 0) {
+				t.Errorf("request %d: got Idempotent-Replayed %v", i, replayed)
+			}
+		}
+
+		if len(store.WinCalls) != 1 {
+			t.Errorf("got %d wins recorded want 1", len(store.WinCalls))
+		}
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		store := StubPlayerStore{map[string]int{}, nil, nil}
+		server := NewPlayerServer(&store, WithIdempotency(createIdempotencyStore(t, 10)))
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+		if len(store.WinCalls) != 2 {
+			t.Errorf("got %d wins recorded want 2", len(store.WinCalls))
+		}
+	})
+
+	t.Run("reusing a key for a different request is rejected", func(t *testing.T) {
+		store := StubPlayerStore{map[string]int{}, nil, nil}
+		server := NewPlayerServer(&store, WithIdempotency(createIdempotencyStore(t, 10)))
+
+		server.ServeHTTP(httptest.NewRecorder(), newIdempotentWinRequest("Pepper", "k"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newIdempotentWinRequest("Cleo", "k"))
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("replays the body of a recorded game", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := NewPlayerServer(store, WithIdempotency(createIdempotencyStore(t, 10)))
+
+		var bodies []string
+		for i := 0; i < 2; i++ {
+			request, _ := http.NewRequest(http.MethodPost, "/games", strings.NewReader(`{"players":["Chris","Cleo"],"winner":"Cleo"}`))
+			request.Header.Set("Idempotency-Key", "game-1")
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusCreated)
+			assertContentType(t, response, jsonContentType)
+			bodies = append(bodies, response.Body.String())
+		}
+
+		if bodies[0] != bodies[1] {
+			t.Errorf("got %q then %q, want the same game", bodies[0], bodies[1])
+		}
+
+		assertPlayerScore(t, store, "Cleo", 1)
+	})
+
+	t.Run("remembers keys across restarts", func(t *testing.T) {
+		keys := createIdempotencyStore(t, 10)
+		store := StubPlayerStore{map[string]int{}, nil, nil}
+
+		NewPlayerServer(&store, WithIdempotency(keys)).ServeHTTP(httptest.NewRecorder(), newIdempotentWinRequest("Pepper", "k"))
+
+		reloaded, err := NewIdempotencyStore(keys.path, 10, DefaultIdempotencyTTL)
+		assertNoError(t, err)
+
+		NewPlayerServer(&store, WithIdempotency(reloaded)).ServeHTTP(httptest.NewRecorder(), newIdempotentWinRequest("Pepper", "k"))
+
+		if len(store.WinCalls) != 1 {
+			t.Errorf("got %d wins recorded want 1", len(store.WinCalls))
+		}
+	})
+
+	t.Run("forgets the oldest keys over the limit and expired keys", func(t *testing.T) {
+		keys := createIdempotencyStore(t, 2)
+		now := monday
+		keys.now = func() time.Time { return now }
+
+		for _, key := range []string{"a", "b", "c"} {
+			keys.begin(key, "f")
+			keys.finish(idempotencyRecord{Key: key, Fingerprint: "f", Time: now, Status: http.StatusAccepted})
+		}
+
+		if record, _ := keys.begin("a", "f"); record != nil {
+			t.Error("expected the oldest key to be forgotten")
+		}
+
+		now = now.Add(DefaultIdempotencyTTL + time.Second)
+
+		if record, _ := keys.begin("c", "f"); record != nil {
+			t.Error("expected an expired key to be forgotten")
+		}
+	})
+
+	t.Run("a key is claimed while its request is in flight", func(t *testing.T) {
+		keys := createIdempotencyStore(t, 10)
+
+		keys.begin("k", "f")
+		_, err := keys.begin("k", "f")
+
+		assertStatus(t, statusFor(err), http.StatusConflict)
+
+		keys.release("k")
+		_, err = keys.begin("k", "f")
+		assertNoError(t, err)
+	})
+}
+
+func TestWinInterval(t *testing.T) {
+	store := StubPlayerStore{map[string]int{}, nil, nil}
+	server := NewPlayerServer(&store, WithWinInterval(time.Minute))
+
+	now := monday
+	server.wins.now = func() time.Time { return now }
+
+	server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+	t.Run("turns away a double tap", func(t *testing.T) {
+		now = now.Add(10 * time.Second)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper"))
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+
+		if got := response.Header().Get("Retry-After"); got != "50" {
+			t.Errorf("got Retry-After %q want 50", got)
+		}
+	})
+
+	t.Run("other players can still win", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Cleo"))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+	})
+
+	t.Run("allows the next win after the interval", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper"))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+	})
+	t.Run("a win that failed to save can be tried again straight away", func(t *testing.T) {
+		store := &FailingPlayerStore{errors.New("disk on fire")}
+		server := NewPlayerServer(store, WithWinInterval(time.Minute))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper"))
+		assertStatus(t, response.Code, http.StatusInternalServerError)
+
+		store.Err = nil
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper"))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper"))
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+	})
+}
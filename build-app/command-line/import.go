@@ -0,0 +1,454 @@
+package poker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Imported wins are recorded as games each player won alone, played at the
+// time of the import in the DefaultLeague, so they count everywhere wins from
+// the history do: open seasons, stats and ratings.
+const (
+	// ImportMerge adds the wins imported to those already recorded.
+	ImportMerge = "merge"
+	// ImportReplace makes the league exactly what was imported, removing every
+	// game recorded before.
+	ImportReplace = "replace"
+
+	// maxImportBody is the largest league accepted by /league/import.
+	maxImportBody = 10 << 20
+	// maxImportProblems is how many invalid entries are described in an error.
+	maxImportProblems = 10
+	// maxImportWins is the most wins one import records, as each is a game.
+	maxImportWins = 1_000_000
+)
+
+// LeagueDecoder reads a league written in one of the formats it can be imported from.
+type LeagueDecoder struct {
+	Format      string
+	ContentType string
+	Decode      func(r io.Reader) (League, error)
+}
+
+// leagueDecoders are every format leagues can be imported from, the first being the default.
+var leagueDecoders []LeagueDecoder
+
+// RegisterLeagueDecoder adds an input format for leagues.
+func RegisterLeagueDecoder(decoder LeagueDecoder) {
+	leagueDecoders = append(leagueDecoders, decoder)
+}
+
+// ImportFormats lists the names of every format leagues can be imported from.
+func ImportFormats() []string {
+	formats := make([]string, len(leagueDecoders))
+
+	for i, decoder := range leagueDecoders {
+		formats[i] = decoder.Format
+	}
+
+	return formats
+}
+
+// LeagueDecoderFor returns the decoder for the named format.
+func LeagueDecoderFor(format string) (LeagueDecoder, error) {
+	for _, decoder := range leagueDecoders {
+		if decoder.Format == format {
+			return decoder, nil
+		}
+	}
+
+	return LeagueDecoder{}, StatusError{http.StatusBadRequest, fmt.Errorf("can't import %q, use one of %s", format, strings.Join(ImportFormats(), ", "))}
+}
+
+func init() {
+	RegisterLeagueDecoder(LeagueDecoder{"json", jsonContentType, decodeLeagueJSON})
+	RegisterLeagueDecoder(LeagueDecoder{"csv", "text/csv; charset=utf-8", decodeLeagueCSV})
+}
+
+// decodeLeagueJSON reads a league as written by the json format.
+func decodeLeagueJSON(r io.Reader) (League, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var league League
+
+	if err := dec.Decode(&league); err != nil {
+		return nil, StatusError{http.StatusBadRequest, fmt.Errorf("problem parsing league, %v", err)}
+	}
+
+	return league, nil
+}
+
+// decodeLeagueCSV reads a league as written by the csv format. The columns are
+// found by their header, so a spreadsheet may have others besides name and wins.
+// Names escaped against formulas on the way out lose their ' again.
+func decodeLeagueCSV(r io.Reader) (League, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+
+	header, err := in.Read()
+
+	if err != nil {
+		return nil, StatusError{http.StatusBadRequest, fmt.Errorf("problem reading csv header, %v", err)}
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	nameColumn, hasName := columns["name"]
+	winsColumn, hasWins := columns["wins"]
+
+	if !hasName || !hasWins {
+		return nil, StatusError{http.StatusBadRequest, fmt.Errorf("csv header %q needs name and wins columns", strings.Join(header, ","))}
+	}
+
+	league := League{}
+
+	for {
+		record, err := in.Read()
+
+		if err == io.EOF {
+			return league, nil
+		}
+
+		if err != nil {
+			return nil, StatusError{http.StatusBadRequest, fmt.Errorf("problem reading csv, %v", err)}
+		}
+
+		line, _ := in.FieldPos(0)
+
+		if nameColumn >= len(record) || winsColumn >= len(record) {
+			return nil, StatusError{http.StatusBadRequest, fmt.Errorf("line %d has no name or wins", line)}
+		}
+
+		wins, err := strconv.Atoi(strings.TrimSpace(record[winsColumn]))
+
+		if err != nil {
+			return nil, StatusError{http.StatusBadRequest, fmt.Errorf("line %d: wins must be a whole number, got %q", line, record[winsColumn])}
+		}
+
+		league = append(league, Player{unescapeCSVFormula(record[nameColumn]), wins})
+	}
+}
+
+// ImportStore is implemented by stores that can load a whole league at once.
+type ImportStore interface {
+	// ImportLeague merges league into the store, or replaces the league with
+	// it, in one write. Unless dryRun is set, when the store is left as it
+	// was, audit is called with the players touched before the change is
+	// saved, and the change is abandoned when it fails.
+	ImportLeague(league League, mode string, dryRun bool, audit func(AdminResult) error) (ImportResult, error)
+}
+
+// ImportResult reports what an import changed, or would change on a dry run.
+type ImportResult struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// Players and Wins count what was imported.
+	Players int `json:"players"`
+	Wins    int `json:"wins"`
+	// Added lists the players who weren't in the league before.
+	Added []string `json:"added"`
+	// Removed lists the players a replace left out of the league.
+	Removed []string `json:"removed"`
+	// GamesDropped counts the games a replace removed from the history.
+	GamesDropped int `json:"games_dropped,omitempty"`
+	// League is the league after the import.
+	League League `json:"league"`
+}
+
+// importLeague merges imported into db, or replaces its players and games with
+// it, recording the wins as games dated with now. Every entry is checked first,
+// and nothing is changed if any is invalid or the games would take db past
+// maxGames, unless that is 0.
+func (db *database) importLeague(imported League, mode string, now func() time.Time, maxGames int) (ImportResult, AdminResult, error) {
+	result := ImportResult{Mode: mode, Added: []string{}, Removed: []string{}}
+	var audited AdminResult
+
+	if mode != ImportMerge && mode != ImportReplace {
+		return result, audited, StatusError{http.StatusBadRequest, fmt.Errorf("unknown import mode %q, use %s or %s", mode, ImportMerge, ImportReplace)}
+	}
+
+	players, err := db.Names.canonicalLeague(imported)
+
+	if err != nil {
+		return result, audited, err
+	}
+
+	touched := []string{}
+
+	for _, player := range players {
+		result.Players++
+		result.Wins += player.Wins
+		touched = append(touched, player.Name)
+
+		if db.Players.Find(player.Name) == nil {
+			result.Added = append(result.Added, player.Name)
+		}
+	}
+
+	kept := len(db.Games)
+
+	if mode == ImportReplace {
+		kept = 0
+
+		for _, player := range db.Players {
+			if players.Find(player.Name) == nil {
+				result.Removed = append(result.Removed, player.Name)
+				touched = append(touched, player.Name)
+			}
+		}
+	}
+
+	if result.Wins > maxImportWins {
+		return result, audited, StatusError{http.StatusBadRequest, fmt.Errorf("can import at most %d wins at a time, got %d", maxImportWins, result.Wins)}
+	}
+
+	if maxGames > 0 && kept+result.Wins > maxGames {
+		return result, audited, StatusError{http.StatusInsufficientStorage, fmt.Errorf("importing %d wins would take the database past its limit of %d games", result.Wins, maxGames)}
+	}
+
+	audited.Before = db.Players.pick(touched)
+
+	if mode == ImportReplace {
+		result.GamesDropped = len(db.Games)
+		db.Players = League{}
+		db.Games = []Game{}
+	}
+
+	for _, player := range players {
+		if db.Players.Find(player.Name) == nil {
+			db.Players = append(db.Players, Player{player.Name, 0})
+		}
+
+		for range player.Wins {
+			db.addGame(winGame(player.Name), now)
+		}
+	}
+
+	audited.After = db.Players.pick(touched)
+	audited.GamesAdded = result.Wins
+	audited.GamesDropped = result.GamesDropped
+
+	result.League = append(League{}, db.Players...)
+	result.League.SortBy(ComputeStats(db.Games), DefaultSortKeys...)
+
+	return result, audited, nil
+}
+
+// canonicalLeague checks every entry of league, returning it with the names in
+// canonical form. The error lists the first few invalid entries by position,
+// and how many more there are.
+func (n NamePolicy) canonicalLeague(league League) (League, error) {
+	var problems []string
+
+	canonical := League{}
+	seen := map[string]int{}
+
+	for i, player := range league {
+		name, err := n.Canonical(player.Name)
+
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("entry %d: %v", i+1, err))
+		case player.Wins < 0:
+			problems = append(problems, fmt.Sprintf("entry %d: %s can't have %d wins", i+1, name, player.Wins))
+		case seen[name] > 0:
+			problems = append(problems, fmt.Sprintf("entry %d: %s is already entry %d", i+1, name, seen[name]))
+		default:
+			seen[name] = i + 1
+			canonical = append(canonical, Player{name, player.Wins})
+		}
+	}
+
+	if len(problems) > maxImportProblems {
+		problems = append(problems[:maxImportProblems], fmt.Sprintf("and %d more", len(problems)-maxImportProblems))
+	}
+
+	if len(problems) > 0 {
+		return nil, StatusError{http.StatusBadRequest, fmt.Errorf("problem importing league, %s", strings.Join(problems, "; "))}
+	}
+
+	return canonical, nil
+}
+
+// importDecoder picks the decoder for an import from the format query
+// parameter, falling back to the Content-Type of the body and then to JSON.
+func importDecoder(r *http.Request) (LeagueDecoder, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return LeagueDecoderFor(format)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+
+	if contentType == "" {
+		return leagueDecoders[0], nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	for _, decoder := range leagueDecoders {
+		if mediaTypeMatches(mediaType, decoder.ContentType) {
+			return decoder, nil
+		}
+	}
+
+	return LeagueDecoder{}, StatusError{http.StatusUnsupportedMediaType, fmt.Errorf("can't import %s, use one of %s", contentType, strings.Join(ImportFormats(), ", "))}
+}
+
+// importHandler loads a league. Anything but a dry run is recorded in the
+// audit log, so needs one.
+func (p *PlayerServer) importHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := p.store.(ImportStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not support importing leagues")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	query := r.URL.Query()
+
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = ImportMerge
+	}
+
+	dryRun := false
+
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeErrorStatus(w, http.StatusBadRequest, fmt.Sprintf("dry_run must be true or false, got %q", value))
+			return
+		}
+	}
+
+	decoder, err := importDecoder(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	league, err := decoder.Decode(http.MaxBytesReader(w, r.Body, maxImportBody))
+
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		writeErrorStatus(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("leagues can be at most %d bytes", tooLarge.Limit))
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !dryRun && p.audit == nil {
+		writeErrorStatus(w, http.StatusNotImplemented, "importing leagues needs an audit log")
+		return
+	}
+
+	var result ImportResult
+
+	if dryRun {
+		result, err = store.ImportLeague(league, mode, true, nil)
+	} else {
+		result, err = p.audit.Import(store, actor(r), league, mode)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// exportHandler sends every player, in a format the league can be imported
+// from again. It holds wins only, not the history of games or seasons: the
+// whole database is sent by snapshotHandler.
+func (p *PlayerServer) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	encoder, err := negotiateLeagueEncoder(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := LeagueDecoderFor(encoder.Format); err != nil {
+		writeErrorStatus(w, http.StatusNotAcceptable, fmt.Sprintf("can't export %s, use one of %s", encoder.Format, strings.Join(ImportFormats(), ", ")))
+		return
+	}
+
+	league, err := p.store.GetLeague()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", encoder.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="league-%s.%s"`, time.Now().UTC().Format("2006-01-02"), encoder.Format))
+	w.Header().Add("Vary", "Accept")
+	encoder.Encode(w, league)
+}
+
+// snapshotHandler sends the whole database as of its latest revision, in the
+// format of a backup, named the way Backups names them and with its checksum
+// in the X-Checksum-Sha256 header.
+func (p *PlayerServer) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := p.store.(SnapshotStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not support snapshots")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	var snapshot bytes.Buffer
+
+	revision, err := store.Snapshot(&snapshot)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	sum := sha256.Sum256(snapshot.Bytes())
+	name := fmt.Sprintf("%s%s-r%d%s", backupPrefix, time.Now().UTC().Format(backupTimeFormat), revision, backupExt)
+
+	w.Header().Set("content-type", jsonContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+	w.Write(snapshot.Bytes())
+}
@@ -0,0 +1,324 @@
+package poker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newImportRequest(query, contentType, body string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, "/league/import"+query, strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	return request
+}
+
+func TestLeagueDecoders(t *testing.T) {
+
+	t.Run("reads what the encoders write", func(t *testing.T) {
+		league := League{{"Cleo", 32}, {"Chris, Jr", 20}}
+
+		for _, format := range ImportFormats() {
+			encoder, _ := LeagueEncoderFor(format)
+			decoder, _ := LeagueDecoderFor(format)
+
+			var out strings.Builder
+			encoder.Encode(&out, league)
+
+			got, err := decoder.Decode(strings.NewReader(out.String()))
+			assertNoError(t, err)
+
+			if !reflect.DeepEqual(got, league) {
+				t.Errorf("%s: got %v want %v", format, got, league)
+			}
+		}
+	})
+
+	t.Run("finds csv columns by their header", func(t *testing.T) {
+		decoder, _ := LeagueDecoderFor("csv")
+
+		got, err := decoder.Decode(strings.NewReader("Notes,Wins,Name\nfast,3,Cleo\n,1,Chris\n"))
+		assertNoError(t, err)
+
+		if want := (League{{"Cleo", 3}, {"Chris", 1}}); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+
+	t.Run("rejects malformed files", func(t *testing.T) {
+		cases := map[string]string{
+			"csv":  "player,score\nCleo,3\n",
+			"json": `[{"Name": "Cleo", "Wins": 3, "Rank": 1}]`,
+		}
+
+		for format, body := range cases {
+			decoder, _ := LeagueDecoderFor(format)
+			_, err := decoder.Decode(strings.NewReader(body))
+			assertStatus(t, statusFor(err), http.StatusBadRequest)
+		}
+
+		decoder, _ := LeagueDecoderFor("csv")
+		_, err := decoder.Decode(strings.NewReader("name,wins\nCleo,3\nChris,lots\n"))
+
+		if err == nil || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("expected an error pointing at line 3, got %v", err)
+		}
+	})
+}
+
+func noAudit(AdminResult) error { return nil }
+
+func TestImportLeague(t *testing.T) {
+
+	t.Run("merges wins into the league", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Chris")
+
+		result, err := store.ImportLeague(League{{"Chris", 4}, {"Cleo", 2}}, ImportMerge, false, noAudit)
+		assertNoError(t, err)
+
+		if result.Players != 2 || result.Wins != 6 || !reflect.DeepEqual(result.Added, []string{"Cleo"}) {
+			t.Errorf("got %+v", result)
+		}
+
+		assertStoreLeague(t, store, []Player{{"Chris", 5}, {"Cleo", 2}})
+
+		if games, _ := store.GetGames(GameFilter{}); len(games) != 7 {
+			t.Errorf("got %d games want 7, one for each win", len(games))
+		}
+	})
+
+	t.Run("replaces the league and its games", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Chris")
+
+		var audited AdminResult
+
+		result, err := store.ImportLeague(League{{"Cleo", 2}}, ImportReplace, false, func(result AdminResult) error {
+			audited = result
+			return nil
+		})
+		assertNoError(t, err)
+
+		if !reflect.DeepEqual(result.Removed, []string{"Chris"}) || result.GamesDropped != 1 {
+			t.Errorf("got %+v", result)
+		}
+
+		want := AdminResult{Before: League{{"Chris", 1}}, After: League{{"Cleo", 2}}, GamesDropped: 1, GamesAdded: 2}
+
+		if !reflect.DeepEqual(audited, want) {
+			t.Errorf("audited %+v want %+v", audited, want)
+		}
+
+		assertStoreLeague(t, store, []Player{{"Cleo", 2}})
+
+		if stats, _ := store.GetPlayerStats("Chris"); stats.Played != 0 {
+			t.Errorf("expected Chris's games to be gone, got %+v", stats)
+		}
+	})
+
+	t.Run("counts imported wins in an open season", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.now = func() time.Time { return monday }
+
+		store.StartSeason(DefaultLeague, "spring")
+
+		_, err := store.ImportLeague(League{{"Cleo", 3}, {"Chris", 1}}, ImportMerge, false, noAudit)
+		assertNoError(t, err)
+
+		seasons, _ := store.GetSeasons(DefaultLeague)
+		standings, err := Standings(seasons[0], store)
+		assertNoError(t, err)
+
+		assertLeague(t, standings, []Player{{"Cleo", 3}, {"Chris", 1}})
+	})
+
+	t.Run("refuses more wins than the database holds games", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.MaxGames = 3
+
+		_, err := store.ImportLeague(League{{"Cleo", 4}}, ImportMerge, false, noAudit)
+
+		assertStatus(t, statusFor(err), http.StatusInsufficientStorage)
+		assertStoreLeague(t, store, []Player{})
+	})
+
+	t.Run("refuses more wins than one import records", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		_, err := store.ImportLeague(League{{"Cleo", maxImportWins}, {"Chris", 1}}, ImportMerge, false, noAudit)
+
+		assertStatus(t, statusFor(err), http.StatusBadRequest)
+		assertStoreLeague(t, store, []Player{})
+	})
+
+	t.Run("abandons an import that can't be audited", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		_, err := store.ImportLeague(League{{"Cleo", 2}}, ImportMerge, false, func(AdminResult) error {
+			return errors.New("disk full")
+		})
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		assertStoreLeague(t, store, []Player{})
+	})
+
+	t.Run("previews a dry run without changing anything", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Chris")
+
+		result, err := store.ImportLeague(League{{"Cleo", 2}}, ImportReplace, true, nil)
+		assertNoError(t, err)
+
+		if !result.DryRun || !reflect.DeepEqual(result.League, League{{"Cleo", 2}}) {
+			t.Errorf("got %+v", result)
+		}
+
+		assertStoreLeague(t, store, []Player{{"Chris", 1}})
+	})
+
+	t.Run("imports nothing when any entry is invalid", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		_, err := store.ImportLeague(League{{"Cleo", 2}, {"", 1}, {"Chris", -1}, {" Cleo", 1}}, ImportMerge, false, noAudit)
+
+		assertStatus(t, statusFor(err), http.StatusBadRequest)
+
+		for _, want := range []string{"entry 2", "entry 3", "entry 4: Cleo is already entry 1"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected %q in %v", want, err)
+			}
+		}
+
+		assertStoreLeague(t, store, []Player{})
+
+		_, err = store.ImportLeague(League{{"Cleo", 2}}, "append", false, noAudit)
+		assertStatus(t, statusFor(err), http.StatusBadRequest)
+	})
+}
+
+func TestImportExportEndpoints(t *testing.T) {
+
+	t.Run("imports csv and exports it again", func(t *testing.T) {
+		store := createSeasonStore(t)
+		audit := createAuditLog(t)
+		server := NewPlayerServer(store, WithAuditLog(audit))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newImportRequest("", "text/csv", "name,wins\nCleo,3\nChris,2\n"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		entries, _ := audit.Entries()
+
+		if len(entries) != 1 || entries[0].Action.Action != AdminImport || entries[0].State != AuditCommitted {
+			t.Errorf("got audit log %+v want the import", entries)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league/export?format=csv"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "name,wins\nCleo,3\nChris,2\n")
+
+		if !strings.HasPrefix(response.Header().Get("Content-Disposition"), "attachment;") {
+			t.Errorf("expected an attachment, got %v", response.Header())
+		}
+	})
+
+	t.Run("needs an audit log to import", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newImportRequest("", "", `[{"Name": "Cleo", "Wins": 3}]`))
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+
+	t.Run("sends a snapshot of the whole database", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		server := NewPlayerServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/admin/snapshot"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		sum := sha256.Sum256(response.Body.Bytes())
+
+		if got := response.Header().Get("X-Checksum-Sha256"); got != hex.EncodeToString(sum[:]) {
+			t.Errorf("got checksum %q for a body with %x", got, sum)
+		}
+
+		if !strings.Contains(response.Header().Get("Content-Disposition"), "-r1.json") {
+			t.Errorf("expected the revision in the file name, got %v", response.Header())
+		}
+
+		if !strings.Contains(response.Body.String(), `"games"`) {
+			t.Errorf("expected the games in the snapshot, got %s", response.Body)
+		}
+	})
+
+	t.Run("previews a dry run", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := NewPlayerServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newImportRequest("?mode=replace&dry_run=true", "", `[{"Name": "Cleo", "Wins": 3}]`))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var result ImportResult
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if !result.DryRun || result.Mode != ImportReplace || result.Wins != 3 {
+			t.Errorf("got %+v", result)
+		}
+
+		assertStoreLeague(t, store, []Player{})
+	})
+
+	t.Run("rejects what it can't import", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t), WithAuditLog(createAuditLog(t)))
+
+		cases := []struct {
+			request *http.Request
+			want    int
+		}{
+			{newImportRequest("", "application/xml", "<league/>"), http.StatusUnsupportedMediaType},
+			{newImportRequest("?dry_run=maybe", "", "[]"), http.StatusBadRequest},
+			{newImportRequest("", "text/csv", "name,wins\nCleo,-3\n"), http.StatusBadRequest},
+			{newGetRequest("/league/import"), http.StatusMethodNotAllowed},
+			{newGetRequest("/league/export?format=html"), http.StatusNotAcceptable},
+		}
+
+		for _, c := range cases {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, c.request)
+			assertStatus(t, response.Code, c.want)
+		}
+	})
+
+	t.Run("only lets admins import", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, recorder, _ := tokens.Issue("table", RoleRecord)
+
+		server := NewPlayerServer(createSeasonStore(t), WithAuth(tokens, RoleRead))
+
+		request := newImportRequest("", "", "[]")
+		request.Header.Set("Authorization", "Bearer "+recorder)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+}
@@ -19,6 +19,19 @@ func (l League) Find(name string) *Player {
 	return nil
 }
 
+// recordGame adds everyone who played to the league and increments the winner's wins.
+func (l *League) recordGame(game Game) {
+	for _, name := range game.Players {
+		if l.Find(name) == nil {
+			*l = append(*l, Player{name, 0})
+		}
+	}
+
+	if winner := l.Find(game.Winner); winner != nil {
+		winner.Wins++
+	}
+}
+
 // NewLeague creates a league from JSON.
 func NewLeague(rdr io.Reader) (League, error) {
 	var league []Player
@@ -0,0 +1,259 @@
+package poker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Revision identifies a state of a store, it changes with every write.
+type Revision struct {
+	Number   int64
+	Modified time.Time
+}
+
+// RevisionStore is implemented by stores that count their writes, which lets
+// responses worked out from them be cached until the next write.
+type RevisionStore interface {
+	Revision() (Revision, error)
+}
+
+const (
+	// maxCachedResponses bounds how many variants of the league, formats and
+	// pages, are kept for a revision.
+	maxCachedResponses = 64
+	// minGzipSize is the smallest body worth compressing.
+	minGzipSize = 512
+)
+
+type cachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+
+	gzipOnce sync.Once
+	gzipped  []byte
+}
+
+// gzip returns the body compressed, compressing it the first time it is asked for.
+func (c *cachedResponse) gzip() []byte {
+	c.gzipOnce.Do(func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(c.body)
+		zw.Close()
+		c.gzipped = buf.Bytes()
+	})
+
+	return c.gzipped
+}
+
+// responseCache keeps the responses worked out from one revision of the store,
+// forgetting them all as soon as another revision is asked for.
+type responseCache struct {
+	lock      sync.Mutex
+	revision  int64
+	responses map[string]*cachedResponse
+}
+
+func (c *responseCache) get(revision int64, key string) *cachedResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if revision != c.revision {
+		return nil
+	}
+
+	return c.responses[key]
+}
+
+func (c *responseCache) put(revision int64, key string, response *cachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if revision < c.revision {
+		return
+	}
+
+	if c.responses == nil || revision != c.revision || len(c.responses) >= maxCachedResponses {
+		c.revision = revision
+		c.responses = map[string]*cachedResponse{}
+	}
+
+	c.responses[key] = response
+}
+
+// bufferedResponse holds a response back so it can be cached before it is sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// cached serves GET requests to next from the responses kept for the current
+// revision of the store, so the league is only sorted and encoded again once
+// something has changed. next must only depend on the store, the URL and the
+// Accept header. Responses carry an ETag and Last-Modified for clients to
+// revalidate with, and are gzipped for clients that accept it.
+func (p *PlayerServer) cached(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		var revision Revision
+		revisions, versioned := p.store.(RevisionStore)
+
+		if versioned {
+			var err error
+
+			if revision, err = revisions.Revision(); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+
+		key := r.URL.Path + "?" + r.URL.RawQuery + "\n" + r.Header.Get("Accept")
+
+		var response *cachedResponse
+
+		if versioned {
+			response = p.cache.get(revision.Number, key)
+		}
+
+		if response == nil {
+			buffered := &bufferedResponse{header: http.Header{}}
+			next(buffered, r)
+
+			// Errors are sent as they are, neither kept nor compressed.
+			if buffered.status != http.StatusOK {
+				buffered.writeTo(w)
+				return
+			}
+
+			response = &cachedResponse{header: buffered.header, body: buffered.body.Bytes()}
+
+			if versioned {
+				response.etag = revisionETag(revision.Number, key)
+				p.cache.put(revision.Number, key, response)
+			}
+		}
+
+		header := w.Header()
+
+		for name, values := range response.header {
+			header[name] = append([]string(nil), values...)
+		}
+
+		header.Add("Vary", "Accept, Accept-Encoding")
+
+		if versioned {
+			header.Set("ETag", response.etag)
+			header.Set("Cache-Control", "no-cache")
+
+			if !revision.Modified.IsZero() {
+				header.Set("Last-Modified", revision.Modified.UTC().Format(http.TimeFormat))
+			}
+
+			if notModified(r, response.etag, revision.Modified) {
+				header.Del("content-type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		body := response.body
+
+		if len(body) >= minGzipSize && acceptsGzip(r) {
+			body = response.gzip()
+			header.Set("Content-Encoding", "gzip")
+		}
+
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	}
+}
+
+// revisionETag is the entity tag of the response to key at a revision. It is
+// weak, as the same tag is sent whether or not the body is compressed.
+func revisionETag(revision int64, key string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return fmt.Sprintf(`W/"%d-%x"`, revision, hash.Sum64())
+}
+
+// notModified reports whether the client already has the response, going by
+// If-None-Match or, when that is missing, If-Modified-Since.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+
+	return err == nil && !modified.IsZero() && !modified.Truncate(time.Second).After(since)
+}
+
+// acceptsGzip reports whether the Accept-Encoding of a request allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			return err == nil && q > 0
+		}
+
+		return true
+	}
+
+	return false
+}
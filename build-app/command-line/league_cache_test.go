@@ -0,0 +1,243 @@
+package poker
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore counts how often the league is worked out from the store.
+type countingStore struct {
+	*FileSystemPlayerStore
+	leagues atomic.Int64
+}
+
+func (c *countingStore) GetLeague() (League, error) {
+	c.leagues.Add(1)
+	return c.FileSystemPlayerStore.GetLeague()
+}
+
+func serveLeague(server http.Handler, header http.Header) *httptest.ResponseRecorder {
+	request := newLeagueRequest()
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+func TestLeagueCache(t *testing.T) {
+
+	t.Run("answers a matching If-None-Match with 304 until the next win", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+		server := NewPlayerServer(store)
+
+		first := serveLeague(server, nil)
+		assertStatus(t, first.Code, http.StatusOK)
+
+		etag := first.Header().Get("ETag")
+		if etag == "" || first.Header().Get("Last-Modified") == "" {
+			t.Fatalf("expected ETag and Last-Modified, got %v", first.Header())
+		}
+
+		again := serveLeague(server, http.Header{"If-None-Match": {etag}})
+		assertStatus(t, again.Code, http.StatusNotModified)
+
+		if again.Body.Len() != 0 {
+			t.Errorf("expected no body with 304, got %q", again.Body)
+		}
+
+		store.RecordWin("Chris")
+
+		changed := serveLeague(server, http.Header{"If-None-Match": {etag}})
+		assertStatus(t, changed.Code, http.StatusOK)
+
+		if changed.Header().Get("ETag") == etag {
+			t.Error("expected the ETag to change after a win")
+		}
+	})
+
+	t.Run("answers If-Modified-Since with 304", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t))
+
+		first := serveLeague(server, nil)
+		again := serveLeague(server, http.Header{"If-Modified-Since": {first.Header().Get("Last-Modified")}})
+
+		assertStatus(t, again.Code, http.StatusNotModified)
+	})
+
+	t.Run("tags each format differently", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t))
+
+		asJSON := serveLeague(server, nil)
+		asCSV := serveLeague(server, http.Header{"Accept": {"text/csv"}})
+
+		if asJSON.Header().Get("ETag") == asCSV.Header().Get("ETag") {
+			t.Error("expected different ETags for JSON and CSV")
+		}
+
+		assertContentType(t, asCSV, "text/csv; charset=utf-8")
+	})
+
+	t.Run("works the league out once per revision", func(t *testing.T) {
+		store := &countingStore{FileSystemPlayerStore: createSeasonStore(t)}
+		server := NewPlayerServer(store)
+
+		serveLeague(server, nil)
+		worked := store.leagues.Load()
+		serveLeague(server, nil)
+
+		if got := store.leagues.Load(); got != worked {
+			t.Errorf("got league worked out %d times want %d", got, worked)
+		}
+
+		store.RecordWin("Cleo")
+		serveLeague(server, nil)
+
+		if got := store.leagues.Load(); got == worked {
+			t.Error("expected the league to be worked out again after a win")
+		}
+	})
+
+	t.Run("gzips large leagues for clients that accept it", func(t *testing.T) {
+		store := createSeasonStore(t)
+		for i := 0; i < 50; i++ {
+			store.RecordWin(fmt.Sprintf("Player %d", i))
+		}
+		server := NewPlayerServer(store)
+
+		plain := serveLeague(server, nil)
+		zipped := serveLeague(server, http.Header{"Accept-Encoding": {"br, gzip"}})
+
+		if zipped.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("expected a gzipped response, got %v", zipped.Header())
+		}
+
+		reader, err := gzip.NewReader(zipped.Body)
+		assertNoError(t, err)
+		unzipped, _ := io.ReadAll(reader)
+
+		if string(unzipped) != plain.Body.String() {
+			t.Errorf("got %q unzipped want %q", unzipped, plain.Body)
+		}
+
+		refused := serveLeague(server, http.Header{"Accept-Encoding": {"gzip;q=0"}})
+		if refused.Header().Get("Content-Encoding") != "" {
+			t.Error("didn't expect gzip when the client refuses it")
+		}
+	})
+
+	t.Run("passes errors through", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t))
+
+		response := serveLeague(server, http.Header{"Accept": {"image/png"}})
+
+		assertStatus(t, response.Code, http.StatusNotAcceptable)
+
+		if response.Header().Get("ETag") != "" {
+			t.Error("didn't expect an ETag on an error")
+		}
+	})
+}
+
+func TestStoreRevisions(t *testing.T) {
+
+	t.Run("the file system store counts writes made by another process", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "game.db.json")
+
+		server, closeServer, err := FileSystemPlayerStoreFromFile(path)
+		assertNoError(t, err)
+		defer closeServer()
+
+		cli, closeCLI, err := FileSystemPlayerStoreFromFile(path)
+		assertNoError(t, err)
+		defer closeCLI()
+
+		before, err := server.Revision()
+		assertNoError(t, err)
+
+		assertNoError(t, cli.RecordWin("Cleo"))
+
+		after, err := server.Revision()
+		assertNoError(t, err)
+
+		if after.Number != before.Number+1 {
+			t.Errorf("got revision %d want %d", after.Number, before.Number+1)
+		}
+	})
+
+	t.Run("the event log store counts events", func(t *testing.T) {
+		store := createEventLogStore(t, t.TempDir())
+
+		assertNoError(t, store.RecordWin("Cleo"))
+		assertNoError(t, store.RecordWin("Chris"))
+
+		revision, err := store.Revision()
+		assertNoError(t, err)
+
+		if revision.Number != 2 || revision.Modified.IsZero() {
+			t.Errorf("got revision %+v want number 2 and a modified time", revision)
+		}
+	})
+}
+
+// createLargeStore writes a database of players directly, as recording each
+// win would take too long for a benchmark.
+func createLargeStore(b *testing.B, players int) *FileSystemPlayerStore {
+	b.Helper()
+
+	db := newDatabase()
+	for i := 0; i < players; i++ {
+		db.Players = append(db.Players, Player{fmt.Sprintf("Player %d", i), i % 97})
+	}
+
+	data, _ := json.Marshal(db)
+	path := filepath.Join(b.TempDir(), "game.db.json")
+	os.WriteFile(path, data, 0666)
+
+	store, close, err := FileSystemPlayerStoreFromFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(close)
+
+	return store
+}
+
+// withoutRevisions hides the revision of a store, so every request works the league out afresh.
+type withoutRevisions struct {
+	PlayerStore
+	GameStore
+	SeasonStore
+}
+
+func BenchmarkLeague(b *testing.B) {
+	for _, players := range []int{100, 10000} {
+		store := createLargeStore(b, players)
+
+		servers := map[string]http.Handler{
+			"cached":   NewPlayerServer(store),
+			"uncached": NewPlayerServer(withoutRevisions{store, store, store}),
+		}
+
+		for _, name := range []string{"uncached", "cached"} {
+			b.Run(fmt.Sprintf("%s/%d players", name, players), func(b *testing.B) {
+				server := servers[name]
+
+				for i := 0; i < b.N; i++ {
+					server.ServeHTTP(httptest.NewRecorder(), newLeagueRequest())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package poker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxPageSize is the largest limit a client can ask for in one page of the league.
+const MaxPageSize = 1000
+
+// LeagueQuery filters, sorts and pages a league table.
+type LeagueQuery struct {
+	Offset int `json:"offset,omitempty"`
+	// Limit is the size of a page, zero for the rest of the table.
+	Limit int       `json:"limit,omitempty"`
+	Sort  []SortKey `json:"sort,omitempty"`
+	// MinWins and MinPlayed drop players below them, Prefix those whose
+	// name does not start with it, ignoring case.
+	MinWins   int    `json:"min_wins,omitempty"`
+	MinPlayed int    `json:"min_played,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+}
+
+// LeaguePage is one page of a league table along with where it sits in the whole.
+type LeaguePage struct {
+	Players League `json:"players"`
+	// Total counts the players matching the filters, across every page.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit,omitempty"`
+	// Next and Prev are cursors for the neighbouring pages, empty at either end.
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// leagueQueryParams are the query parameters read by parseLeagueQuery.
+var leagueQueryParams = []string{"cursor", "offset", "limit", "sort", "min_wins", "min_played", "prefix"}
+
+// parseLeagueQuery reads a query from the cursor parameter, or else from the
+// offset, limit, sort, min_wins, min_played and prefix parameters. paged is
+// true when the client asked for a page rather than the whole table.
+func parseLeagueQuery(values url.Values) (query LeagueQuery, paged bool, err error) {
+	if cursor := values.Get("cursor"); cursor != "" {
+		query, err = decodeCursor(cursor)
+		return query, true, err
+	}
+
+	paged = values.Has("offset") || values.Has("limit")
+
+	for name, field := range map[string]*int{
+		"offset":     &query.Offset,
+		"limit":      &query.Limit,
+		"min_wins":   &query.MinWins,
+		"min_played": &query.MinPlayed,
+	} {
+		value := values.Get(name)
+
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+
+		if err != nil || parsed < 0 {
+			return query, paged, StatusError{http.StatusBadRequest, fmt.Errorf("%s must be a non-negative integer, got %q", name, value)}
+		}
+
+		*field = parsed
+	}
+
+	if query.Limit > MaxPageSize {
+		return query, paged, StatusError{http.StatusBadRequest, fmt.Errorf("limit can be at most %d, got %d", MaxPageSize, query.Limit)}
+	}
+
+	query.Prefix = values.Get("prefix")
+	query.Sort, err = parseSortKeys(values.Get("sort"))
+
+	return query, paged, err
+}
+
+// parseSortKeys reads a comma separated list of statistics, each prefixed
+// with - to sort in descending order, such as -win_rate,name.
+func parseSortKeys(value string) ([]SortKey, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+
+	for _, field := range strings.Split(value, ",") {
+		key := SortKey{Field: strings.TrimSpace(field)}
+		key.Field, key.Descending = strings.CutPrefix(key.Field, "-")
+
+		if _, ok := sortFields[key.Field]; !ok {
+			return nil, StatusError{http.StatusBadRequest, fmt.Errorf("can't sort by %q, use one of %s", key.Field, strings.Join(sortFieldNames(), ", "))}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func sortFieldNames() []string {
+	return slices.Sorted(maps.Keys(sortFields))
+}
+
+// needsStats reports whether applying the query looks at more than names and wins.
+func (q LeagueQuery) needsStats() bool {
+	if q.MinPlayed > 0 {
+		return true
+	}
+
+	for _, key := range q.Sort {
+		if key.Field != "name" && key.Field != "wins" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply filters and sorts league, leaving it untouched, and cuts out the page the query asks for.
+// Custom sorts fall back to DefaultSortKeys so pages are stable between requests.
+func (q LeagueQuery) Apply(league League, stats map[string]PlayerStats) LeaguePage {
+	matched := League{}
+
+	for _, player := range league {
+		if player.Wins < q.MinWins || stats[player.Name].Played < q.MinPlayed {
+			continue
+		}
+
+		if !strings.HasPrefix(strings.ToLower(player.Name), strings.ToLower(q.Prefix)) {
+			continue
+		}
+
+		matched = append(matched, player)
+	}
+
+	if len(q.Sort) > 0 {
+		matched.SortBy(stats, append(append([]SortKey{}, q.Sort...), DefaultSortKeys...)...)
+	}
+
+	from := min(q.Offset, len(matched))
+	to := len(matched)
+
+	if q.Limit > 0 {
+		to = min(from+q.Limit, len(matched))
+	}
+
+	page := LeaguePage{Players: matched[from:to], Total: len(matched), Offset: from, Limit: q.Limit}
+
+	if to < len(matched) {
+		next := q
+		next.Offset = to
+		page.Next = next.cursor()
+	}
+
+	if from > 0 {
+		prev := q
+		prev.Offset = max(from-q.Limit, 0)
+
+		if q.Limit == 0 {
+			prev.Offset = 0
+		}
+		page.Prev = prev.cursor()
+	}
+
+	return page
+}
+
+// cursor encodes the query so a client can fetch the page without repeating its parameters.
+func (q LeagueQuery) cursor() string {
+	data, _ := json.Marshal(q)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func decodeCursor(cursor string) (LeagueQuery, error) {
+	var query LeagueQuery
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return query, StatusError{http.StatusBadRequest, errInvalidCursor}
+	}
+
+	if err := json.Unmarshal(data, &query); err != nil {
+		return query, StatusError{http.StatusBadRequest, errInvalidCursor}
+	}
+
+	if query.Offset < 0 || query.Limit < 0 || query.Limit > MaxPageSize {
+		return query, StatusError{http.StatusBadRequest, errInvalidCursor}
+	}
+
+	for _, key := range query.Sort {
+		if _, ok := sortFields[key.Field]; !ok {
+			return query, StatusError{http.StatusBadRequest, errInvalidCursor}
+		}
+	}
+
+	return query, nil
+}
+
+// pageLinks builds a Link header pointing at the pages around page, keeping
+// the other query parameters of the request, such as the format.
+func pageLinks(u *url.URL, page LeaguePage) string {
+	link := func(cursor, rel string) string {
+		values := u.Query()
+
+		for _, name := range leagueQueryParams {
+			values.Del(name)
+		}
+
+		if cursor != "" {
+			values.Set("cursor", cursor)
+		}
+
+		target := url.URL{Path: u.Path, RawQuery: values.Encode()}
+
+		return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+	}
+
+	var links []string
+
+	if page.Next != "" {
+		links = append(links, link(page.Next, "next"))
+	}
+
+	if page.Prev != "" {
+		links = append(links, link(page.Prev, "prev"))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,213 @@
+package poker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeagueQueryApply(t *testing.T) {
+	// the 13 games of base/slices/07-slice-expressions-pagination, paged by 4
+	league := League{}
+	for i, name := range []string{
+		"pacman", "mario", "tetris", "doom",
+		"galaga", "frogger", "asteroids", "simcity",
+		"metroid", "defender", "rayman", "tempest",
+		"ultima",
+	} {
+		league = append(league, Player{name, 13 - i})
+	}
+
+	t.Run("pages through the whole table", func(t *testing.T) {
+		query := LeagueQuery{Limit: 4}
+		var sizes []int
+
+		for {
+			page := query.Apply(league, nil)
+			sizes = append(sizes, len(page.Players))
+
+			if page.Total != 13 {
+				t.Fatalf("got total %d want 13", page.Total)
+			}
+
+			if page.Next == "" {
+				break
+			}
+
+			var err error
+			query, err = decodeCursor(page.Next)
+			assertNoError(t, err)
+		}
+
+		if got := len(sizes); got != 4 || sizes[3] != 1 {
+			t.Errorf("got page sizes %v want [4 4 4 1]", sizes)
+		}
+	})
+
+	t.Run("an offset past the end is an empty page", func(t *testing.T) {
+		page := LeagueQuery{Offset: 20, Limit: 4}.Apply(league, nil)
+
+		if len(page.Players) != 0 || page.Next != "" || page.Offset != 13 {
+			t.Errorf("got %+v want an empty last page", page)
+		}
+	})
+
+	t.Run("the previous page of the second is the first", func(t *testing.T) {
+		page := LeagueQuery{Offset: 4, Limit: 4}.Apply(league, nil)
+
+		prev, err := decodeCursor(page.Prev)
+		assertNoError(t, err)
+
+		if prev.Offset != 0 || prev.Limit != 4 {
+			t.Errorf("got %+v want offset 0", prev)
+		}
+	})
+
+	t.Run("filters by wins and name prefix", func(t *testing.T) {
+		page := LeagueQuery{MinWins: 5, Prefix: "Me"}.Apply(league, nil)
+
+		assertLeague(t, page.Players, []Player{{"metroid", 5}})
+	})
+
+	t.Run("sorts by a stat, falling back to the default order", func(t *testing.T) {
+		table := League{{"Chris", 2}, {"Cleo", 2}, {"Pepper", 1}}
+		stats := map[string]PlayerStats{
+			"Chris":  {Played: 4, WinRate: 0.5},
+			"Cleo":   {Played: 2, WinRate: 1},
+			"Pepper": {Played: 4, WinRate: 0.25},
+		}
+
+		page := LeagueQuery{Sort: []SortKey{{"played", true}}}.Apply(table, stats)
+
+		assertLeague(t, page.Players, []Player{{"Chris", 2}, {"Pepper", 1}, {"Cleo", 2}})
+	})
+}
+
+func TestParseLeagueQuery(t *testing.T) {
+	t.Run("reads sort keys with a direction", func(t *testing.T) {
+		query, paged, err := parseLeagueQuery(url.Values{"sort": {"-win_rate,name"}})
+		assertNoError(t, err)
+
+		if paged {
+			t.Error("sorting alone should not ask for a page")
+		}
+
+		if len(query.Sort) != 2 || query.Sort[0] != (SortKey{"win_rate", true}) || query.Sort[1] != (SortKey{"name", false}) {
+			t.Errorf("got %+v", query.Sort)
+		}
+	})
+
+	for _, values := range []url.Values{
+		{"sort": {"height"}},
+		{"limit": {"-1"}},
+		{"limit": {"5000"}},
+		{"min_wins": {"lots"}},
+		{"cursor": {"not a cursor"}},
+	} {
+		t.Run("rejects "+values.Encode(), func(t *testing.T) {
+			_, _, err := parseLeagueQuery(values)
+
+			assertStatus(t, statusFor(err), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestLeaguePagination(t *testing.T) {
+	store := createSeasonStore(t)
+	store.now = func() time.Time { return monday }
+	server := NewPlayerServer(store)
+
+	for _, game := range []Game{
+		{Players: []string{"Chris", "Cleo", "Pepper"}, Winner: "Chris"},
+		{Players: []string{"Chris", "Cleo"}, Winner: "Chris"},
+		{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		{Players: []string{"Tiest"}, Winner: "Tiest"},
+	} {
+		store.RecordGame(game)
+	}
+
+	t.Run("returns a page with metadata in the body and headers", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?limit=2"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var page LeaguePage
+		json.NewDecoder(response.Body).Decode(&page)
+
+		assertLeague(t, page.Players, []Player{{"Chris", 2}, {"Tiest", 1}})
+
+		if page.Total != 4 || page.Next == "" || page.Prev != "" {
+			t.Errorf("got %+v want the first of two pages", page)
+		}
+
+		if got := response.Header().Get("X-Total-Count"); got != "4" {
+			t.Errorf("got X-Total-Count %q want 4", got)
+		}
+
+		want := `</league?cursor=` + page.Next + `>; rel="next"`
+		if got := response.Header().Get("Link"); got != want {
+			t.Errorf("got Link %q want %q", got, want)
+		}
+	})
+
+	t.Run("follows the next link to the last page", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?limit=2&format=csv"))
+
+		link := response.Header().Get("Link")
+		next := link[strings.Index(link, "<")+1 : strings.Index(link, ">")]
+
+		if !strings.Contains(next, "format=csv") {
+			t.Errorf("expected the next link %q to keep the format", next)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(next))
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if got := response.Body.String(); got != "name,wins\nCleo,1\nPepper,0\n" {
+			t.Errorf("got %q want the last two players", got)
+		}
+
+		if !strings.Contains(response.Header().Get("Link"), `rel="prev"`) {
+			t.Errorf("expected a link to the previous page, got %q", response.Header().Get("Link"))
+		}
+	})
+
+	t.Run("sorts and filters without paging", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?sort=-played&min_played=2"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertLeague(t, getLeagueFromResponse(t, response.Body), []Player{{"Chris", 2}, {"Cleo", 1}})
+	})
+
+	t.Run("rejects an unknown sort key", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?sort=height"))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("can't filter or sort by stats a store doesn't keep", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{League: []Player{{"Cleo", 1}}})
+
+		for _, query := range []string{"min_played=1", "sort=-win_rate"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest("/league?"+query))
+
+			assertStatus(t, response.Code, http.StatusNotImplemented)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/league?min_wins=1"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+}
@@ -0,0 +1,253 @@
+package poker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBuffer is how many events can queue up for a subscriber before it is dropped as too slow.
+	streamBuffer = 16
+	// streamHistory is how many recent events are kept for clients resuming with Last-Event-ID.
+	streamHistory = 64
+	// streamKeepAlive is how often an idle stream is sent a comment so proxies keep it open.
+	streamKeepAlive = 15 * time.Second
+	// streamPoll is how often a stream looks at the store for writes made by other processes.
+	streamPoll = 2 * time.Second
+)
+
+// LeagueUpdate is the data of every event sent on /league/stream: the
+// standings as /league would return them, and the change that led to them.
+type LeagueUpdate struct {
+	League League  `json:"league"`
+	Change *Change `json:"change,omitempty"`
+}
+
+type streamEvent struct {
+	seq  uint64
+	id   string
+	data []byte
+}
+
+type streamSubscriber struct {
+	events chan streamEvent
+	// dropped is closed when the subscriber fell too far behind and was disconnected.
+	dropped chan struct{}
+}
+
+// leagueStream fans the standings out to every /league/stream client whenever the store changes.
+type leagueStream struct {
+	store PlayerStore
+	// epoch tells apart event ids from before a restart, when seq starts again.
+	epoch       string
+	lock        sync.Mutex
+	seq         uint64
+	history     []streamEvent
+	subscribers map[*streamSubscriber]bool
+	keepAlive   time.Duration
+	poll        time.Duration
+}
+
+func newLeagueStream(store PlayerStore) *leagueStream {
+	return &leagueStream{
+		store:       store,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: map[*streamSubscriber]bool{},
+		keepAlive:   streamKeepAlive,
+		poll:        streamPoll,
+	}
+}
+
+// event builds the next event from the current standings. Call with the lock held.
+func (s *leagueStream) event(seq uint64, change *Change) (streamEvent, error) {
+	league, err := DefaultStandings(s.store)
+
+	if err != nil {
+		return streamEvent{}, err
+	}
+
+	data, err := json.Marshal(LeagueUpdate{league, change})
+
+	if err != nil {
+		return streamEvent{}, err
+	}
+
+	return streamEvent{seq: seq, id: fmt.Sprintf("%s-%d", s.epoch, seq), data: data}, nil
+}
+
+// publish sends the standings after change to every subscriber, dropping any
+// that can't keep up. With nobody listening the standings aren't worked out;
+// the kept events are forgotten instead, so a client resuming from before
+// the change is sent the standings afresh.
+func (s *leagueStream) publish(change Change) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.subscribers) == 0 {
+		s.seq++
+		s.history = nil
+		return
+	}
+
+	event, err := s.event(s.seq+1, &change)
+
+	if err != nil {
+		return
+	}
+
+	s.seq++
+	s.history = append(s.history, event)
+
+	if len(s.history) > streamHistory {
+		s.history = s.history[len(s.history)-streamHistory:]
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			close(sub.dropped)
+			delete(s.subscribers, sub)
+		}
+	}
+}
+
+// subscribe registers a new client, returning the events it should be sent
+// first: those after lastEventID when they are all still kept, or else the
+// current standings.
+func (s *leagueStream) subscribe(lastEventID string) (*streamSubscriber, []streamEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	backlog, ok := s.since(lastEventID)
+
+	if !ok {
+		event, err := s.event(s.seq, nil)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		backlog = []streamEvent{event}
+	}
+
+	sub := &streamSubscriber{events: make(chan streamEvent, streamBuffer), dropped: make(chan struct{})}
+	s.subscribers[sub] = true
+
+	return sub, backlog, nil
+}
+
+// since returns the kept events after lastEventID, with ok false if some of them were already forgotten.
+func (s *leagueStream) since(lastEventID string) ([]streamEvent, bool) {
+	epoch, seqText, found := strings.Cut(lastEventID, "-")
+
+	if !found || epoch != s.epoch {
+		return nil, false
+	}
+
+	last, err := strconv.ParseUint(seqText, 10, 64)
+
+	if err != nil || last > s.seq {
+		return nil, false
+	}
+
+	oldest := s.seq - uint64(len(s.history))
+
+	if last < oldest {
+		return nil, false
+	}
+
+	return append([]streamEvent{}, s.history[len(s.history)-int(s.seq-last):]...), true
+}
+
+// refresh reads the revision of the store, which makes a store shared with
+// other processes pick up their writes and announce them.
+func (s *leagueStream) refresh() {
+	if revisions, ok := s.store.(RevisionStore); ok {
+		revisions.Revision()
+	}
+}
+
+func (s *leagueStream) unsubscribe(sub *streamSubscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+func writeStreamEvent(w http.ResponseWriter, event streamEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: league\ndata: %s\n\n", event.id, event.data)
+}
+
+// leagueStreamHandler sends the standings as Server-Sent Events, first when
+// the client connects and then after every change to the store.
+func (p *PlayerServer) leagueStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if p.stream == nil {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not announce changes")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	sub, backlog, err := p.stream.subscribe(r.Header.Get("Last-Event-ID"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer p.stream.unsubscribe(sub)
+
+	// A stream outlives the server's write timeout, which is meant for ordinary requests.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range backlog {
+		writeStreamEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(p.stream.keepAlive)
+	defer keepAlive.Stop()
+
+	poll := time.NewTicker(p.stream.poll)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.draining:
+			return
+		case <-sub.dropped:
+			fmt.Fprint(w, ": too slow, reconnect to catch up\n\n")
+			flusher.Flush()
+			return
+		case event := <-sub.events:
+			writeStreamEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-poll.C:
+			p.stream.refresh()
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package poker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id   string
+	data LeagueUpdate
+}
+
+// readSSEEvent reads the next event from a stream, skipping comments.
+func readSSEEvent(t *testing.T, rdr *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+
+	for {
+		line, err := rdr.ReadString('\n')
+
+		if err != nil {
+			t.Fatalf("problem reading event stream, %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event.id != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data); err != nil {
+				t.Fatalf("problem parsing event data %q, %v", line, err)
+			}
+		}
+	}
+}
+
+func openLeagueStream(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	request, _ := http.NewRequest(http.MethodGet, url+"/league/stream", nil)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assertNoError(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+
+	assertStatus(t, response.StatusCode, http.StatusOK)
+
+	if got := response.Header.Get("content-type"); got != "text/event-stream" {
+		t.Fatalf("got content-type %q want text/event-stream", got)
+	}
+
+	return bufio.NewReader(response.Body)
+}
+
+func TestLeagueStream(t *testing.T) {
+
+	t.Run("sends the standings on connect and after every win", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := httptest.NewServer(NewPlayerServer(store))
+		t.Cleanup(server.Close)
+
+		store.RecordWin("Pepper")
+
+		stream := openLeagueStream(t, server.URL, "")
+		assertLeague(t, readSSEEvent(t, stream).data.League, []Player{{"Pepper", 1}})
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Cleo")
+
+		readSSEEvent(t, stream)
+		event := readSSEEvent(t, stream)
+
+		assertLeague(t, event.data.League, []Player{{"Cleo", 2}, {"Pepper", 1}})
+
+		if event.data.Change == nil || event.data.Change.Game.Winner != "Cleo" {
+			t.Errorf("got change %+v want Cleo's win", event.data.Change)
+		}
+	})
+
+	t.Run("every subscriber gets every event", func(t *testing.T) {
+		store, err := NewEventLogPlayerStore(t.TempDir() + "/events.log")
+		assertNoError(t, err)
+		defer store.Close()
+
+		server := httptest.NewServer(NewPlayerServer(store))
+		t.Cleanup(server.Close)
+
+		var streams []*bufio.Reader
+		for i := 0; i < 5; i++ {
+			stream := openLeagueStream(t, server.URL, "")
+			readSSEEvent(t, stream)
+			streams = append(streams, stream)
+		}
+
+		store.RecordWin("Chris")
+
+		for _, stream := range streams {
+			assertLeague(t, readSSEEvent(t, stream).data.League, []Player{{"Chris", 1}})
+		}
+	})
+
+	t.Run("resumes after the Last-Event-ID", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := httptest.NewServer(NewPlayerServer(store))
+		t.Cleanup(server.Close)
+
+		store.RecordWin("Pepper")
+		first := readSSEEvent(t, openLeagueStream(t, server.URL, ""))
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+
+		stream := openLeagueStream(t, server.URL, first.id)
+
+		if got := readSSEEvent(t, stream).data.Change.Game.Winner; got != "Cleo" {
+			t.Errorf("got %s want the first missed win, Cleo's", got)
+		}
+
+		if got := readSSEEvent(t, stream).data.Change.Game.Winner; got != "Chris" {
+			t.Errorf("got %s want the second missed win, Chris's", got)
+		}
+	})
+
+	t.Run("an unknown Last-Event-ID gets the current standings", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := httptest.NewServer(NewPlayerServer(store))
+		t.Cleanup(server.Close)
+
+		store.RecordWin("Pepper")
+
+		event := readSSEEvent(t, openLeagueStream(t, server.URL, "before-a-restart-7"))
+
+		assertLeague(t, event.data.League, []Player{{"Pepper", 1}})
+	})
+
+	t.Run("sends wins recorded by another process", func(t *testing.T) {
+		store := createSeasonStore(t)
+		players := NewPlayerServer(store)
+		players.stream.poll = 5 * time.Millisecond
+		server := httptest.NewServer(players)
+		t.Cleanup(server.Close)
+
+		stream := openLeagueStream(t, server.URL, "")
+		readSSEEvent(t, stream)
+
+		cli, closeCLI, err := FileSystemPlayerStoreFromFile(store.path)
+		assertNoError(t, err)
+		defer closeCLI()
+
+		cli.RecordWin("Cleo")
+
+		event := readSSEEvent(t, stream)
+		assertLeague(t, event.data.League, []Player{{"Cleo", 1}})
+
+		if event.data.Change == nil || event.data.Change.Type != ChangeReload {
+			t.Errorf("got change %+v want a reload", event.data.Change)
+		}
+	})
+
+	t.Run("stops listening to the store on shutdown", func(t *testing.T) {
+		store := createSeasonStore(t)
+		players := NewPlayerServer(store)
+
+		assertNoError(t, players.Shutdown(context.Background()))
+
+		if len(store.hooks) != 0 {
+			t.Errorf("got %d change hooks left want none", len(store.hooks))
+		}
+	})
+
+	t.Run("stores that don't announce changes can't stream", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, newGetRequest("/league/stream"))
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+}
+
+func TestLeagueStreamSlowConsumers(t *testing.T) {
+	store := createSeasonStore(t)
+	stream := newLeagueStream(store)
+
+	slow, _, err := stream.subscribe("")
+	assertNoError(t, err)
+
+	fast, _, _ := stream.subscribe("")
+
+	for i := 0; i <= streamBuffer; i++ {
+		stream.publish(Change{Type: ChangeGame})
+		<-fast.events
+	}
+
+	select {
+	case <-slow.dropped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the slow subscriber to be dropped")
+	}
+
+	select {
+	case <-fast.dropped:
+		t.Error("did not expect the subscriber keeping up to be dropped")
+	default:
+	}
+}
+
+// leagueCountingStore counts how often the league is worked out.
+type leagueCountingStore struct {
+	StubPlayerStore
+	leagues int
+}
+
+func (s *leagueCountingStore) GetLeague() (League, error) {
+	s.leagues++
+	return s.StubPlayerStore.GetLeague()
+}
+
+func TestLeagueStreamWithoutSubscribers(t *testing.T) {
+	store := &leagueCountingStore{StubPlayerStore: StubPlayerStore{League: []Player{{"Cleo", 1}}}}
+	stream := newLeagueStream(store)
+
+	before := stream.epoch + "-0"
+
+	for range 3 {
+		stream.publish(Change{Type: ChangeGame})
+	}
+
+	if store.leagues != 0 {
+		t.Errorf("worked out the league %d times with nobody listening", store.leagues)
+	}
+
+	_, backlog, err := stream.subscribe(before)
+	assertNoError(t, err)
+
+	if len(backlog) != 1 || !strings.HasSuffix(backlog[0].id, "-3") {
+		t.Errorf("got backlog %+v want the current standings as event 3", backlog)
+	}
+}
@@ -0,0 +1,323 @@
+package poker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// durationBuckets are the upper bounds, in seconds, of the request latency histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route, method string
+	code          int
+}
+
+type routeKey struct {
+	route, method string
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in bucket i alone, the
+	// cumulative counts Prometheus expects are added up when written.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(durationBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// Metrics counts requests served and writes made to the store, and writes
+// them in the Prometheus text format. It is safe for concurrent use.
+type Metrics struct {
+	lock        sync.Mutex
+	requests    map[requestKey]uint64
+	durations   map[routeKey]*histogram
+	inFlight    int64
+	wins        uint64
+	writes      map[string]uint64
+	writeErrors map[string]uint64
+}
+
+// NewMetrics returns Metrics with every counter at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:    map[requestKey]uint64{},
+		durations:   map[routeKey]*histogram{},
+		writes:      map[string]uint64{},
+		writeErrors: map[string]uint64{},
+	}
+}
+
+func (m *Metrics) startRequest() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inFlight++
+}
+
+func (m *Metrics) finishRequest(route, method string, code int, took time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inFlight--
+	m.requests[requestKey{route, method, code}]++
+
+	h, ok := m.durations[routeKey{route, method}]
+
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.durations[routeKey{route, method}] = h
+	}
+
+	h.observe(took.Seconds())
+}
+
+// observeWrite counts a write of operation to the store, returning err so it
+// can wrap the call. Only failures of the store itself count as errors, not
+// writes it refused as invalid. A nil Metrics counts nothing.
+func (m *Metrics) observeWrite(operation string, err error) error {
+	if m == nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.writes[operation]++
+
+	switch {
+	case err == nil && (operation == writeRecordWin || operation == writeRecordGame):
+		m.wins++
+	case err != nil && statusFor(err) >= http.StatusInternalServerError:
+		m.writeErrors[operation]++
+	}
+
+	return err
+}
+
+// Operations counted by observeWrite.
+const (
+	writeRecordWin  = "record_win"
+	writeRecordGame = "record_game"
+)
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	out := &countingWriter{w: buffered}
+
+	writeMetricHeader(out, "poker_http_requests_total", "counter", "HTTP requests served, by route, method and status code.")
+	for _, key := range sortedKeys(m.requests, func(a, b requestKey) int {
+		return cmpAll(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method), a.code-b.code)
+	}) {
+		fmt.Fprintf(out, "poker_http_requests_total{route=%s,method=%s,code=\"%d\"} %d\n", labelValue(key.route), labelValue(key.method), key.code, m.requests[key])
+	}
+
+	writeMetricHeader(out, "poker_http_request_duration_seconds", "histogram", "Time taken to serve HTTP requests, by route and method.")
+	for _, key := range sortedKeys(m.durations, func(a, b routeKey) int {
+		return cmpAll(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method))
+	}) {
+		h := m.durations[key]
+		labels := fmt.Sprintf("route=%s,method=%s", labelValue(key.route), labelValue(key.method))
+
+		var cumulative uint64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(out, "poker_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(out, "poker_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(out, "poker_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(out, "poker_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	writeMetricHeader(out, "poker_http_requests_in_flight", "gauge", "HTTP requests being served, streams and WebSocket games included.")
+	fmt.Fprintf(out, "poker_http_requests_in_flight %d\n", m.inFlight)
+
+	writeMetricHeader(out, "poker_wins_recorded_total", "counter", "Wins recorded in the store, from single wins and games alike.")
+	fmt.Fprintf(out, "poker_wins_recorded_total %d\n", m.wins)
+
+	writeMetricHeader(out, "poker_store_writes_total", "counter", "Writes attempted on the store, by operation.")
+	for _, operation := range sortedKeys(m.writes, strings.Compare) {
+		fmt.Fprintf(out, "poker_store_writes_total{operation=%s} %d\n", labelValue(operation), m.writes[operation])
+	}
+
+	writeMetricHeader(out, "poker_store_write_errors_total", "counter", "Writes the store failed to persist, by operation.")
+	for _, operation := range sortedKeys(m.writes, strings.Compare) {
+		fmt.Fprintf(out, "poker_store_write_errors_total{operation=%s} %d\n", labelValue(operation), m.writeErrors[operation])
+	}
+
+	return out.n, buffered.Flush()
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelValue quotes a label value, escaping it as the text format requires.
+func labelValue(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, cmp func(a, b K) int) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, cmp)
+	return keys
+}
+
+func cmpAll(results ...int) int {
+	for _, r := range results {
+		if r != 0 {
+			return r
+		}
+	}
+	return 0
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// metricsHandler serves the metrics to Prometheus.
+func (p *PlayerServer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	w.Header().Set("content-type", metricsContentType)
+	p.metrics.WriteTo(w)
+}
+
+// statusRecorder remembers the status and size of a response. It passes on
+// Flush and Hijack, so streams and WebSockets work through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		if s.status == 0 {
+			s.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err == nil {
+		s.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// knownMethods keeps the method label of the metrics to a bounded set.
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// instrument counts every request in metrics, labelled with the route of
+// router it matched, and logs it to accessLog when that isn't nil.
+func instrument(next http.Handler, router *http.ServeMux, metrics *Metrics, accessLog *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := router.Handler(r)
+
+		if route == "" {
+			route = "unmatched"
+		}
+
+		method := r.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		metrics.startRequest()
+		next.ServeHTTP(recorder, r)
+		took := time.Since(start)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		metrics.finishRequest(route, method, recorder.status, took)
+
+		if accessLog != nil {
+			accessLog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", recorder.status),
+				slog.Int64("bytes", recorder.bytes),
+				slog.Duration("duration", took),
+				slog.String("remote", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getMetrics(t *testing.T, server http.Handler) string {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newGetRequest("/metrics"))
+
+	assertStatus(t, response.Code, http.StatusOK)
+	assertContentType(t, response, metricsContentType)
+
+	return response.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+
+	t.Run("counts requests by route, method and status", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{Scores: map[string]int{"Pepper": 20}})
+
+		server.ServeHTTP(httptest.NewRecorder(), newGetScoreRequest("Pepper"))
+		server.ServeHTTP(httptest.NewRecorder(), newGetScoreRequest("Pepper"))
+		server.ServeHTTP(httptest.NewRecorder(), newGetScoreRequest("Nobody"))
+		server.ServeHTTP(httptest.NewRecorder(), newGetRequest("/nowhere"))
+
+		body := getMetrics(t, server)
+
+		assertBodyContains(t, body, `poker_http_requests_total{route="/players/",method="GET",code="200"} 2`)
+		assertBodyContains(t, body, `poker_http_requests_total{route="/players/",method="GET",code="404"} 1`)
+		assertBodyContains(t, body, `poker_http_requests_total{route="unmatched",method="GET",code="404"} 1`)
+		assertBodyContains(t, body, `poker_http_request_duration_seconds_bucket{route="/players/",method="GET",le="+Inf"} 3`)
+		assertBodyContains(t, body, `poker_http_request_duration_seconds_count{route="/players/",method="GET"} 3`)
+	})
+
+	t.Run("counts wins and the writes the store failed", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{Scores: map[string]int{}})
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+		body := getMetrics(t, server)
+
+		assertBodyContains(t, body, "poker_wins_recorded_total 1\n")
+		assertBodyContains(t, body, `poker_store_writes_total{operation="record_win"} 1`)
+		assertBodyContains(t, body, `poker_store_write_errors_total{operation="record_win"} 0`)
+
+		server = NewPlayerServer(&FailingPlayerStore{Err: errors.New("disk full")})
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+		body = getMetrics(t, server)
+
+		assertBodyContains(t, body, "poker_wins_recorded_total 0\n")
+		assertBodyContains(t, body, `poker_store_write_errors_total{operation="record_win"} 1`)
+	})
+
+	t.Run("counts requests turned away by authentication", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, WithAuth(createTokenStore(t), RoleNone))
+
+		server.ServeHTTP(httptest.NewRecorder(), newLeagueRequest())
+
+		request := newGetRequest("/metrics")
+		_, secret, _ := server.tokens.(*TokenStore).Issue("prometheus", RoleRead)
+		request.Header.Set("Authorization", "Bearer "+secret)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertBodyContains(t, response.Body.String(), `poker_http_requests_total{route="/league",method="GET",code="401"} 1`)
+	})
+
+	t.Run("escapes label values", func(t *testing.T) {
+		if got := labelValue("a\"b\\c\nd"); got != `"a\"b\\c\nd"` {
+			t.Errorf("got %s", got)
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewPlayerServer(&StubPlayerStore{}, WithAccessLog(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	server.ServeHTTP(httptest.NewRecorder(), newLeagueRequest())
+
+	var entry struct {
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Route  string `json:"route"`
+		Status int    `json:"status"`
+	}
+
+	if err := json.Unmarshal([]byte(strings.TrimSpace(logs.String())), &entry); err != nil {
+		t.Fatalf("problem parsing access log %q, %v", logs.String(), err)
+	}
+
+	if entry.Msg != "request" || entry.Method != http.MethodGet || entry.Path != "/league" || entry.Route != "/league" || entry.Status != http.StatusOK {
+		t.Errorf("got %+v", entry)
+	}
+}
@@ -0,0 +1,300 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Migration upgrades a database document from the version before it to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(doc []byte) ([]byte, error)
+}
+
+// migrations are applied in order; the document version is the number of migrations it has seen.
+var migrations []Migration
+
+// RegisterMigration adds the next migration, which must upgrade to the version after the latest one.
+func RegisterMigration(m Migration) {
+	if m.Version != len(migrations)+1 {
+		panic(fmt.Sprintf("migration %d registered out of order, expected version %d", m.Version, len(migrations)+1))
+	}
+	migrations = append(migrations, m)
+}
+
+// LatestSchemaVersion is the version of documents written by this program.
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+func init() {
+	RegisterMigration(Migration{
+		Version:     1,
+		Description: "wrap the bare league array in a versioned envelope",
+		Up: func(doc []byte) ([]byte, error) {
+			return json.Marshal(struct {
+				Version int             `json:"version"`
+				Players json.RawMessage `json:"players"`
+			}{1, doc})
+		},
+	})
+
+	RegisterMigration(Migration{
+		Version:     2,
+		Description: "add the history of games",
+		Up: func(doc []byte) ([]byte, error) {
+			return upgradeEnvelope(doc, 2, func(fields map[string]json.RawMessage) error {
+				fields["games"] = json.RawMessage("[]")
+				return nil
+			})
+		},
+	})
+
+	RegisterMigration(Migration{
+		Version:     3,
+		Description: "add seasons of named leagues",
+		Up: func(doc []byte) ([]byte, error) {
+			return upgradeEnvelope(doc, 3, func(fields map[string]json.RawMessage) error {
+				fields["seasons"] = json.RawMessage("[]")
+				return nil
+			})
+		},
+	})
+
+	RegisterMigration(Migration{
+		Version:     4,
+		Description: "add the player name policy, names already recorded are tidied by the cli names merge command",
+		Up: func(doc []byte) ([]byte, error) {
+			return upgradeEnvelope(doc, 4, func(fields map[string]json.RawMessage) error {
+				fields["names"] = json.RawMessage("{}")
+				return nil
+			})
+		},
+	})
+
+	RegisterMigration(Migration{
+		Version:     5,
+		Description: "count the writes to the file, so responses can be cached until the next one",
+		Up: func(doc []byte) ([]byte, error) {
+			return upgradeEnvelope(doc, 5, func(fields map[string]json.RawMessage) error {
+				fields["revision"] = json.RawMessage("0")
+				return nil
+			})
+		},
+	})
+}
+
+// upgradeEnvelope lets a migration edit the top level fields of a document and sets its version.
+func upgradeEnvelope(doc []byte, version int, edit func(fields map[string]json.RawMessage) error) ([]byte, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+
+	if err := edit(fields); err != nil {
+		return nil, err
+	}
+
+	fields["version"] = json.RawMessage(strconv.Itoa(version))
+
+	return json.Marshal(fields)
+}
+
+// database is the document stored in game.db.json.
+type database struct {
+	Version int      `json:"version"`
+	Players League   `json:"players"`
+	Games   []Game   `json:"games"`
+	Seasons []Season `json:"seasons"`
+	// Names is the policy every process writing the file puts player names through.
+	Names NamePolicy `json:"names"`
+	// Revision counts the writes to the file.
+	Revision int64 `json:"revision"`
+}
+
+func newDatabase() database {
+	return database{Version: LatestSchemaVersion(), Players: League{}, Games: []Game{}, Seasons: []Season{}}
+}
+
+// clone copies db so it can be changed without affecting the original.
+func (db database) clone() database {
+	db.Players = append(League{}, db.Players...)
+	db.Games = append([]Game{}, db.Games...)
+	db.Seasons = append([]Season{}, db.Seasons...)
+	return db
+}
+
+// addGame appends a normalised game to the history, giving it the next ID
+// and the current time if it has none, and updates the league.
+func (db *database) addGame(game Game, now func() time.Time) Game {
+	game.ID = 1
+	if n := len(db.Games); n > 0 {
+		game.ID = db.Games[n-1].ID + 1
+	}
+
+	if game.Time.IsZero() {
+		game.Time = now().UTC()
+	}
+
+	db.Games = append(db.Games, game)
+	db.Players.recordGame(game)
+
+	return game
+}
+
+// schemaVersion reads the version of a document. Legacy files holding a bare
+// array of players have no version marker and are version 0.
+func schemaVersion(doc []byte) (int, error) {
+	trimmed := bytes.TrimSpace(doc)
+
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return 0, nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.Unmarshal(trimmed, &header); err != nil {
+		return 0, fmt.Errorf("problem reading schema version, %v", err)
+	}
+
+	return header.Version, nil
+}
+
+// NewerSchemaError is returned for a database written by a newer version,
+// which this one can't read and must leave alone.
+type NewerSchemaError struct {
+	Version int
+}
+
+func (e NewerSchemaError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the latest supported version %d", e.Version, LatestSchemaVersion())
+}
+
+// PendingMigrations returns the migrations needed to bring doc up to date.
+func PendingMigrations(doc []byte) ([]Migration, int, error) {
+	version, err := schemaVersion(doc)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version < 0 {
+		return nil, version, fmt.Errorf("database schema version %d is not valid", version)
+	}
+
+	if version > LatestSchemaVersion() {
+		return nil, version, NewerSchemaError{version}
+	}
+
+	return migrations[version:], version, nil
+}
+
+// migrate applies every pending migration to doc, returning the upgraded document.
+func migrate(doc []byte) ([]byte, error) {
+	pending, _, err := PendingMigrations(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range pending {
+		doc, err = m.Up(doc)
+
+		if err != nil {
+			return nil, fmt.Errorf("problem applying migration %d (%s), %v", m.Version, m.Description, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// decodeDatabase parses a document of any known version, upgrading it in memory.
+func decodeDatabase(doc []byte) (database, error) {
+	var db database
+
+	upgraded, err := migrate(doc)
+
+	if err != nil {
+		return db, err
+	}
+
+	if err := json.Unmarshal(upgraded, &db); err != nil {
+		return db, fmt.Errorf("problem parsing league, %v", err)
+	}
+
+	if db.Players == nil {
+		db.Players = League{}
+	}
+
+	if db.Games == nil {
+		db.Games = []Game{}
+	}
+
+	if db.Seasons == nil {
+		db.Seasons = []Season{}
+	}
+
+	return db, nil
+}
+
+func migrationBackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d%s", path, version, backupSuffix)
+}
+
+// MigrateFile upgrades the database at path to the latest schema version, keeping
+// a copy of the original next to it. It returns the version the file was at.
+func MigrateFile(path string) (int, error) {
+	unlock, err := lockFile(path)
+
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	doc, err := os.ReadFile(path)
+
+	if err != nil {
+		return 0, fmt.Errorf("problem reading %s, %v", path, err)
+	}
+
+	return migrateDocument(path, doc)
+}
+
+// migrateDocument writes the upgraded doc over path when it needed migrating.
+func migrateDocument(path string, doc []byte) (int, error) {
+	_, from, err := PendingMigrations(doc)
+
+	if err != nil {
+		return from, err
+	}
+
+	if from == LatestSchemaVersion() {
+		return from, nil
+	}
+
+	db, err := decodeDatabase(doc)
+
+	if err != nil {
+		return from, err
+	}
+
+	upgraded, err := json.Marshal(db)
+
+	if err != nil {
+		return from, fmt.Errorf("problem encoding migrated database, %v", err)
+	}
+
+	if err := writeFileAtomic(migrationBackupPath(path, from), doc); err != nil {
+		return from, err
+	}
+
+	return from, writeFileAtomic(path, upgraded)
+}
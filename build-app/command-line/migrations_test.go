@@ -0,0 +1,143 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+
+	t.Run("upgrades a legacy bare array file in place with a backup", func(t *testing.T) {
+		legacy := `[{"Name": "Cleo", "Wins": 10}]`
+		database, cleanDatabase := createTempFile(t, legacy)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertPlayerScore(t, store, "Cleo", 10)
+
+		assertSchemaVersion(t, database.Name(), LatestSchemaVersion())
+
+		backup, err := os.ReadFile(migrationBackupPath(database.Name(), 0))
+		assertNoError(t, err)
+
+		if string(backup) != legacy {
+			t.Errorf("got backup %q want %q", backup, legacy)
+		}
+	})
+
+	t.Run("leaves an up to date file alone", func(t *testing.T) {
+		current, _ := json.Marshal(newDatabase())
+		database, cleanDatabase := createTempFile(t, string(current))
+		defer cleanDatabase()
+
+		_, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		if backups, _ := filepath.Glob(database.Name() + ".v*" + backupSuffix); len(backups) != 0 {
+			t.Errorf("didn't expect a migration backup for an up to date file, found %v", backups)
+		}
+	})
+
+	t.Run("refuses a file from a newer version", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `{"version": 999, "players": []}`)
+		defer cleanDatabase()
+
+		_, err := NewFileSystemPlayerStore(database)
+
+		if err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("leaves a file from a newer version alone rather than restore the last good copy", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[{"Name": "Cleo", "Wins": 10}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertNoError(t, store.RecordWin("Cleo"))
+
+		newer := `{"version": 999, "players": []}`
+		os.WriteFile(database.Name(), []byte(newer), 0666)
+
+		_, err = NewFileSystemPlayerStore(reopenFile(t, database))
+
+		var newerErr NewerSchemaError
+		if !errors.As(err, &newerErr) || newerErr.Version != 999 {
+			t.Errorf("got %v want a NewerSchemaError for version 999", err)
+		}
+
+		if got, _ := os.ReadFile(database.Name()); string(got) != newer {
+			t.Errorf("got file %s want it left as %s", got, newer)
+		}
+	})
+
+	t.Run("falls back to the last good copy of a file with a negative version", func(t *testing.T) {
+		if _, _, err := PendingMigrations([]byte(`{"version": -1}`)); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+
+		database, cleanDatabase := createTempFile(t, `{"version": -1, "players": []}`)
+		defer cleanDatabase()
+
+		os.WriteFile(backupPath(database.Name()), []byte(`[{"Name": "Cleo", "Wins": 10}]`), 0o644)
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertPlayerScore(t, store, "Cleo", 10)
+	})
+
+	t.Run("reports pending migrations without applying them", func(t *testing.T) {
+		pending, version, err := PendingMigrations([]byte(`[]`))
+		assertNoError(t, err)
+
+		if version != 0 || len(pending) != LatestSchemaVersion() {
+			t.Errorf("got version %d with %d pending, want version 0 with %d pending", version, len(pending), LatestSchemaVersion())
+		}
+	})
+
+	t.Run("migrates a file by hand", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[]`)
+		defer cleanDatabase()
+
+		from, err := MigrateFile(database.Name())
+		assertNoError(t, err)
+
+		if from != 0 {
+			t.Errorf("got from version %d want 0", from)
+		}
+
+		assertSchemaVersion(t, database.Name(), LatestSchemaVersion())
+	})
+}
+
+func TestMigrationToGameHistory(t *testing.T) {
+	db, err := decodeDatabase([]byte(`{"version": 1, "players": [{"Name": "Cleo", "Wins": 10}]}`))
+	assertNoError(t, err)
+
+	if db.Version != LatestSchemaVersion() || len(db.Games) != 0 {
+		t.Errorf("got version %d with %d games, want version %d with no games", db.Version, len(db.Games), LatestSchemaVersion())
+	}
+
+	assertLeague(t, db.Players, []Player{{"Cleo", 10}})
+}
+
+func assertSchemaVersion(t *testing.T, path string, want int) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+
+	var header struct{ Version int }
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatalf("could not parse %s, %v", path, err)
+	}
+
+	if header.Version != want {
+		t.Errorf("got schema version %d want %d", header.Version, want)
+	}
+}
@@ -0,0 +1,265 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultMaxNameLength is the longest player name allowed when a NamePolicy doesn't say.
+const DefaultMaxNameLength = 32
+
+// nameSymbols are the characters other than letters, digits and spaces allowed in a name.
+const nameSymbols = "-_.'"
+
+var errEmptyName = errors.New("player names can't be empty")
+
+// NamePolicy decides which player names are allowed and the canonical form
+// they are kept in, so that names which only look different are the same player.
+type NamePolicy struct {
+	// FoldCase keeps names in lower case, making "Chris" and "chris" one player.
+	FoldCase bool `json:"fold_case,omitempty"`
+	// MaxLength is the longest name allowed, in characters, DefaultMaxNameLength when zero.
+	MaxLength int `json:"max_length,omitempty"`
+}
+
+// DefaultNamePolicy keeps the case of names as given.
+var DefaultNamePolicy = NamePolicy{}
+
+// NameCanonicaliser is implemented by stores that keep player names in a canonical form.
+type NameCanonicaliser interface {
+	CanonicalName(name string) (string, error)
+}
+
+func (n NamePolicy) maxLength() int {
+	if n.MaxLength > 0 {
+		return n.MaxLength
+	}
+	return DefaultMaxNameLength
+}
+
+// Canonical returns name in its canonical form: NFKC normalised, with runs of
+// spaces collapsed, trimmed and, when FoldCase is set, case folded. It is a
+// StatusError with http.StatusBadRequest when the name isn't allowed.
+func (n NamePolicy) Canonical(name string) (string, error) {
+	name = strings.Join(strings.Fields(norm.NFKC.String(name)), " ")
+
+	if n.FoldCase {
+		name = norm.NFKC.String(cases.Fold().String(name))
+	}
+
+	if name == "" {
+		return "", StatusError{http.StatusBadRequest, errEmptyName}
+	}
+
+	if length := utf8.RuneCountInString(name); length > n.maxLength() {
+		return "", StatusError{http.StatusBadRequest, fmt.Errorf("player names can be at most %d characters, %q has %d", n.maxLength(), name, length)}
+	}
+
+	for _, r := range name {
+		if !allowedInName(r) {
+			return "", StatusError{http.StatusBadRequest, fmt.Errorf("player names can only have letters, digits, spaces and %s, %q has %q", nameSymbols, name, r)}
+		}
+	}
+
+	return name, nil
+}
+
+func allowedInName(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == ' ' || strings.ContainsRune(nameSymbols, r)
+}
+
+// sanitise turns a name recorded before names were checked into one the policy
+// allows, dropping the characters it doesn't and cutting it to length. The
+// result is empty when nothing of the name can be kept.
+func (n NamePolicy) sanitise(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !allowedInName(r) {
+			return -1
+		}
+		return r
+	}, norm.NFKC.String(name))
+
+	if runes := []rune(strings.TrimSpace(name)); len(runes) > n.maxLength() {
+		name = string(runes[:n.maxLength()])
+	}
+
+	canonical, err := n.Canonical(name)
+
+	if err != nil {
+		return ""
+	}
+
+	return canonical
+}
+
+// canonicalGame puts the names in game in canonical form.
+func (n NamePolicy) canonicalGame(game Game) (Game, error) {
+	players := make([]string, len(game.Players))
+
+	for i, name := range game.Players {
+		canonical, err := n.Canonical(name)
+
+		if err != nil {
+			return game, err
+		}
+
+		players[i] = canonical
+	}
+
+	winner, err := n.Canonical(game.Winner)
+
+	if err != nil && game.Winner != "" {
+		return game, err
+	}
+
+	game.Players = players
+	game.Winner = winner
+
+	return game, nil
+}
+
+// canonicalName puts name in the canonical form of the store, or of the
+// DefaultNamePolicy for stores which don't have one of their own.
+func canonicalName(store PlayerStore, name string) (string, error) {
+	if canonicaliser, ok := store.(NameCanonicaliser); ok {
+		return canonicaliser.CanonicalName(name)
+	}
+
+	return DefaultNamePolicy.Canonical(name)
+}
+
+// NameMerge is a player whose entries were put under one canonical name.
+type NameMerge struct {
+	Name string   `json:"name"`
+	From []string `json:"from"`
+	Wins int      `json:"wins"`
+}
+
+// NameCleanup reports what applying a name policy to recorded names changed.
+type NameCleanup struct {
+	// Merged lists the players whose name changed or who had several entries.
+	Merged []NameMerge `json:"merged"`
+	// Dropped lists the names nothing could be kept of, such as the empty name.
+	Dropped []string `json:"dropped"`
+	// GamesDropped counts the games won by a dropped name, which are removed.
+	GamesDropped int `json:"games_dropped"`
+}
+
+// mergeLeague puts the players of league under their canonical names, adding
+// up the wins of those that turn out to be the same player.
+func mergeLeague(league League, rename func(string) string) League {
+	merged := League{}
+
+	for _, player := range league {
+		name := rename(player.Name)
+
+		if name == "" {
+			continue
+		}
+
+		if existing := merged.Find(name); existing != nil {
+			existing.Wins += player.Wins
+			continue
+		}
+
+		merged = append(merged, Player{name, player.Wins})
+	}
+
+	return merged
+}
+
+// applyNamePolicy rewrites every name recorded in db in the canonical form of
+// policy, merging players who turn out to be the same, and makes policy the one
+// used from now on.
+func (db *database) applyNamePolicy(policy NamePolicy) NameCleanup {
+	var cleanup NameCleanup
+
+	renamed := map[string]string{}
+	rename := func(name string) string {
+		canonical, ok := renamed[name]
+
+		if !ok {
+			canonical = policy.sanitise(name)
+			renamed[name] = canonical
+		}
+
+		return canonical
+	}
+
+	froms := map[string][]string{}
+
+	for _, player := range db.Players {
+		name := rename(player.Name)
+
+		if name == "" {
+			cleanup.Dropped = append(cleanup.Dropped, player.Name)
+			continue
+		}
+
+		froms[name] = append(froms[name], player.Name)
+	}
+
+	cleanup.GamesDropped = db.renamePlayers(rename)
+
+	for _, player := range db.Players {
+		if from := froms[player.Name]; len(from) > 1 || from[0] != player.Name {
+			cleanup.Merged = append(cleanup.Merged, NameMerge{player.Name, from, player.Wins})
+		}
+	}
+
+	db.Names = policy
+
+	return cleanup
+}
+
+// renamePlayers puts every name recorded in db through rename, merging the
+// players who end up with the same name and removing those renamed to "".
+// Games left without a winner are dropped, and their number returned.
+func (db *database) renamePlayers(rename func(string) string) int {
+	db.Players = mergeLeague(db.Players, rename)
+
+	dropped := 0
+	games := []Game{}
+
+	for _, game := range db.Games {
+		players := []string{}
+
+		for _, name := range game.Players {
+			if renamed := rename(name); renamed != "" {
+				players = append(players, renamed)
+			}
+		}
+
+		game.Players = players
+		game.Winner = rename(game.Winner)
+
+		normalised, err := game.normalise()
+
+		if err != nil {
+			dropped++
+			continue
+		}
+
+		games = append(games, normalised)
+	}
+
+	db.Games = games
+
+	for i, season := range db.Seasons {
+		if season.Final != nil {
+			db.Seasons[i].Final = mergeLeague(season.Final, rename)
+		}
+	}
+
+	return dropped
+}
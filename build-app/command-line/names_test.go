@@ -0,0 +1,172 @@
+package poker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamePolicy(t *testing.T) {
+
+	t.Run("puts names in canonical form", func(t *testing.T) {
+		cases := []struct {
+			policy NamePolicy
+			name   string
+			want   string
+		}{
+			{DefaultNamePolicy, "Chris", "Chris"},
+			{DefaultNamePolicy, "  Chris \t van  Dam ", "Chris van Dam"},
+			{DefaultNamePolicy, "Ｃｈｒｉｓ", "Chris"},
+			{DefaultNamePolicy, "Zoë", "Zoë"},
+			{DefaultNamePolicy, "O'Brien-Smith_2.0", "O'Brien-Smith_2.0"},
+			{NamePolicy{FoldCase: true}, "CHRIS", "chris"},
+			{NamePolicy{FoldCase: true}, "Straße", "strasse"},
+		}
+
+		for _, c := range cases {
+			got, err := c.policy.Canonical(c.name)
+			assertNoError(t, err)
+
+			if got != c.want {
+				t.Errorf("%+v: got %q want %q from %q", c.policy, got, c.want, c.name)
+			}
+		}
+	})
+
+	t.Run("rejects names that aren't allowed", func(t *testing.T) {
+		for _, name := range []string{"", "   ", "a/b", "<script>", "zero\u200bwidth", strings.Repeat("a", DefaultMaxNameLength+1)} {
+			_, err := DefaultNamePolicy.Canonical(name)
+			assertStatus(t, statusFor(err), http.StatusBadRequest)
+		}
+
+		_, err := NamePolicy{MaxLength: 3}.Canonical("Cleo")
+		assertStatus(t, statusFor(err), http.StatusBadRequest)
+	})
+}
+
+func TestStoresCanonicaliseNames(t *testing.T) {
+	stores := map[string]func(t *testing.T) PlayerStore{
+		"file system": func(t *testing.T) PlayerStore { return createSeasonStore(t) },
+		"event log":   func(t *testing.T) PlayerStore { return createEventLogStore(t, t.TempDir()) },
+	}
+
+	for name, create := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := create(t)
+
+			assertNoError(t, store.RecordWin("Chris"))
+			assertNoError(t, store.RecordWin(" Chris  "))
+			assertPlayerScore(t, store, "Chris", 2)
+			assertPlayerScore(t, store, "\tChris", 2)
+
+			assertStatus(t, statusFor(store.RecordWin("")), http.StatusBadRequest)
+
+			_, err := store.(GameStore).RecordGame(Game{Players: []string{"Chris", "Chris "}, Winner: "Cleo/2"})
+			assertStatus(t, statusFor(err), http.StatusBadRequest)
+
+			game, err := store.(GameStore).RecordGame(Game{Players: []string{"Chris", "Chris ", "Cleo"}, Winner: " Cleo"})
+			assertNoError(t, err)
+
+			if want := []string{"Chris", "Cleo"}; !reflect.DeepEqual(game.Players, want) {
+				t.Errorf("got players %q want %q", game.Players, want)
+			}
+		})
+	}
+}
+
+func TestApplyNamePolicy(t *testing.T) {
+	legacy := `{"version": 3,
+		"players": [{"Name": "chris", "Wins": 2}, {"Name": "Chris ", "Wins": 3}, {"Name": "", "Wins": 1}, {"Name": "Cleo", "Wins": 4}],
+		"games": [
+			{"id": 1, "time": "2024-01-01T00:00:00Z", "players": ["chris", "Cleo"], "winner": "chris"},
+			{"id": 2, "time": "2024-01-02T00:00:00Z", "players": [""], "winner": ""}
+		],
+		"seasons": []}`
+
+	database, cleanDatabase := createTempFile(t, legacy)
+	defer cleanDatabase()
+
+	store, err := NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	policy := NamePolicy{FoldCase: true}
+
+	t.Run("a dry run changes nothing", func(t *testing.T) {
+		cleanup, err := store.ApplyNamePolicy(policy, true)
+		assertNoError(t, err)
+
+		if len(cleanup.Merged) != 2 {
+			t.Errorf("got %+v want two merges", cleanup)
+		}
+
+		assertPlayerScore(t, store, "chris", 2)
+	})
+
+	t.Run("merges duplicates and drops the empty name", func(t *testing.T) {
+		cleanup, err := store.ApplyNamePolicy(policy, false)
+		assertNoError(t, err)
+
+		want := NameCleanup{
+			Merged:       []NameMerge{{Name: "chris", From: []string{"chris", "Chris "}, Wins: 5}, {Name: "cleo", From: []string{"Cleo"}, Wins: 4}},
+			Dropped:      []string{""},
+			GamesDropped: 1,
+		}
+
+		if !reflect.DeepEqual(cleanup, want) {
+			t.Errorf("got %+v want %+v", cleanup, want)
+		}
+
+		assertStoreLeague(t, store, []Player{{"chris", 5}, {"cleo", 4}})
+
+		games, _ := store.GetGames(GameFilter{Player: "CHRIS"})
+		if len(games) != 1 || games[0].Winner != "chris" {
+			t.Errorf("got games %+v", games)
+		}
+	})
+
+	t.Run("keeps the policy for later writes", func(t *testing.T) {
+		assertNoError(t, store.RecordWin("CLEO"))
+		assertPlayerScore(t, store, "Cleo", 5)
+	})
+}
+
+func TestServerCanonicalisesNames(t *testing.T) {
+
+	t.Run("does not record a win for the empty name", func(t *testing.T) {
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		response := httptest.NewRecorder()
+		NewPlayerServer(store).ServeHTTP(response, newPostWinRequest(""))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		if len(store.WinCalls) != 0 {
+			t.Errorf("got %d win calls want 0", len(store.WinCalls))
+		}
+	})
+
+	t.Run("decodes and tidies the name in the path", func(t *testing.T) {
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		server := NewPlayerServer(store)
+
+		request, _ := http.NewRequest(http.MethodPost, "/players/Chris%20van%20%20Dam%20", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		AssertPlayerWin(t, store, "Chris van Dam")
+	})
+
+	t.Run("limits wins by canonical name", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t), WithWinInterval(time.Minute))
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostWinRequest("Pepper%20"))
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,183 @@
+package poker
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// RatingParams configures the Elo rating system.
+type RatingParams struct {
+	// Initial is the rating of a player before their first game.
+	Initial float64 `json:"initial"`
+	// K is the most a rating can move in a single game.
+	K float64 `json:"k"`
+}
+
+// DefaultRatingParams are the usual chess Elo parameters.
+var DefaultRatingParams = RatingParams{Initial: 1500, K: 32}
+
+// Rating is a player's Elo rating and the number of rated games behind it.
+type Rating struct {
+	Name   string  `json:"name"`
+	Rating float64 `json:"rating"`
+	Games  int     `json:"games"`
+}
+
+// RatingStore is implemented by stores that keep Elo ratings up to date as
+// games are recorded, rather than replaying the history for every request.
+type RatingStore interface {
+	// GetRatings returns every rated player, best first. Ratings for
+	// DefaultRatingParams are kept; others are worked out from the history.
+	GetRatings(params RatingParams) ([]Rating, error)
+}
+
+// Rater keeps Elo ratings up to date as game results come in.
+type Rater struct {
+	params  RatingParams
+	ratings map[string]*Rating
+	order   []string
+}
+
+// NewRater creates a Rater where every player starts at params.Initial.
+func NewRater(params RatingParams) *Rater {
+	return &Rater{params: params, ratings: map[string]*Rating{}}
+}
+
+func (r *Rater) rating(name string) *Rating {
+	rating, ok := r.ratings[name]
+
+	if !ok {
+		rating = &Rating{Name: name, Rating: r.params.Initial}
+		r.ratings[name] = rating
+		r.order = append(r.order, name)
+	}
+
+	return rating
+}
+
+// Update applies the result of a game. A multi-player game is rated as the
+// winner beating every other player, with K shared between those pairings so a
+// big table doesn't move ratings more than a heads-up game does.
+func (r *Rater) Update(game Game) {
+	winner := r.rating(game.Winner)
+	before := map[string]float64{winner.Name: winner.Rating}
+
+	var losers []*Rating
+
+	for _, name := range game.Players {
+		if name == game.Winner {
+			continue
+		}
+		loser := r.rating(name)
+		before[name] = loser.Rating
+		losers = append(losers, loser)
+	}
+
+	for _, loser := range losers {
+		k := r.params.K / float64(len(losers))
+		delta := k * (1 - expectedScore(before[winner.Name], before[loser.Name]))
+
+		winner.Rating += delta
+		loser.Rating -= delta
+		loser.Games++
+	}
+
+	winner.Games++
+}
+
+// expectedScore is the chance a player rated a beats a player rated b.
+func expectedScore(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// rated returns every rated player in the order they were first rated.
+func (r *Rater) rated() []Rating {
+	ratings := make([]Rating, 0, len(r.order))
+
+	for _, name := range r.order {
+		ratings = append(ratings, *r.ratings[name])
+	}
+
+	return ratings
+}
+
+// restoreRater creates a Rater carrying on from ratings, as returned by rated.
+func restoreRater(params RatingParams, ratings []Rating) *Rater {
+	r := NewRater(params)
+
+	for _, rating := range ratings {
+		*r.rating(rating.Name) = rating
+	}
+
+	return r
+}
+
+// Ratings returns every rated player, best first.
+func (r *Rater) Ratings() []Rating {
+	ratings := r.rated()
+
+	sort.SliceStable(ratings, func(i, j int) bool {
+		return ratings[i].Rating > ratings[j].Rating
+	})
+
+	return ratings
+}
+
+// ComputeRatings rates every player from scratch by replaying games in order,
+// so ratings can be recomputed whenever the parameters change.
+func ComputeRatings(games []Game, params RatingParams) []Rating {
+	return rateGames(FilterGames(games, GameFilter{}), params).Ratings()
+}
+
+// rateGames rates games in the order they are given.
+func rateGames(games []Game, params RatingParams) *Rater {
+	rater := NewRater(params)
+
+	for _, game := range games {
+		rater.Update(game)
+	}
+
+	return rater
+}
+
+// WriteRatings prints ratings as a table.
+func WriteRatings(out io.Writer, ratings []Rating) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "#\tPlayer\tRating\tGames")
+
+	for i, rating := range ratings {
+		fmt.Fprintf(w, "%d\t%s\t%.0f\t%d\n", i+1, rating.Name, rating.Rating, rating.Games)
+	}
+
+	return w.Flush()
+}
+
+// parseRatingParams overrides defaults with the initial and k query parameters.
+func parseRatingParams(query url.Values, defaults RatingParams) (RatingParams, error) {
+	params := defaults
+
+	for name, field := range map[string]*float64{"initial": &params.Initial, "k": &params.K} {
+		value := query.Get(name)
+
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+
+		if err != nil || parsed < 0 {
+			return params, StatusError{http.StatusBadRequest, fmt.Errorf("%s must be a non-negative number, got %q", name, value)}
+		}
+
+		*field = parsed
+	}
+
+	return params, nil
+}
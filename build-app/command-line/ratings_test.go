@@ -0,0 +1,217 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRater(t *testing.T) {
+
+	t.Run("the winner of a heads-up game between equals gains half of K", func(t *testing.T) {
+		rater := NewRater(DefaultRatingParams)
+		rater.Update(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+
+		assertRatings(t, rater.Ratings(), map[string]float64{
+			"Cleo":  1516,
+			"Chris": 1484,
+		})
+	})
+
+	t.Run("beating a stronger player is worth more", func(t *testing.T) {
+		rater := NewRater(DefaultRatingParams)
+		rater.Update(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		rater.Update(Game{Players: []string{"Chris", "Cleo"}, Winner: "Chris"})
+
+		ratings := rater.Ratings()
+		if ratings[0].Name != "Chris" {
+			t.Errorf("expected Chris to lead after beating a stronger player, got %+v", ratings)
+		}
+	})
+
+	t.Run("a multi-player game shares K between the losers", func(t *testing.T) {
+		rater := NewRater(DefaultRatingParams)
+		rater.Update(Game{Players: []string{"Chris", "Cleo", "Pepper", "Tiest"}, Winner: "Pepper"})
+
+		assertRatings(t, rater.Ratings(), map[string]float64{
+			"Pepper": 1516,
+			"Chris":  1500 - 16.0/3,
+			"Cleo":   1500 - 16.0/3,
+			"Tiest":  1500 - 16.0/3,
+		})
+	})
+
+	t.Run("a game on your own changes nothing but the game count", func(t *testing.T) {
+		rater := NewRater(DefaultRatingParams)
+		rater.Update(winGame("Chris"))
+
+		ratings := rater.Ratings()
+		if ratings[0].Rating != 1500 || ratings[0].Games != 1 {
+			t.Errorf("got %+v want a rating of 1500 after one game", ratings[0])
+		}
+	})
+
+	t.Run("ratings are recomputed from history with new parameters", func(t *testing.T) {
+		games := []Game{
+			{Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Chris"},
+			{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		}
+
+		ratings := ComputeRatings(games, RatingParams{Initial: 1000, K: 10})
+
+		if ratings[0].Name != "Chris" || ratings[0].Games != 2 {
+			t.Errorf("expected games to be replayed in time order, got %+v", ratings)
+		}
+
+		total := 0.0
+		for _, r := range ratings {
+			total += r.Rating
+		}
+		if math.Abs(total-2000) > 1e-9 {
+			t.Errorf("expected ratings to be zero-sum around 1000, got total %v", total)
+		}
+	})
+}
+
+func TestRatingStores(t *testing.T) {
+	heads := Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"}
+	table := Game{Players: []string{"Chris", "Cleo", "Pepper"}, Winner: "Chris"}
+	want := ComputeRatings([]Game{heads, table}, DefaultRatingParams)
+
+	assertKeptRatings := func(t *testing.T, store RatingStore) {
+		t.Helper()
+
+		got, err := store.GetRatings(DefaultRatingParams)
+		assertNoError(t, err)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	}
+
+	t.Run("the file store keeps ratings as games are recorded", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(heads)
+		store.RecordGame(table)
+
+		assertKeptRatings(t, store)
+	})
+
+	t.Run("the file store rates games recorded by another process", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(heads)
+
+		other, closeOther, err := FileSystemPlayerStoreFromFile(store.path)
+		assertNoError(t, err)
+		defer closeOther()
+		other.RecordGame(table)
+
+		assertKeptRatings(t, store)
+	})
+
+	t.Run("the event log keeps ratings across compactions", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+		store.CompactEvery = 1
+		store.RecordGame(heads)
+		store.RecordGame(table)
+		store.Close()
+
+		assertKeptRatings(t, createEventLogStore(t, dir))
+	})
+
+	t.Run("the event log rates the history behind a snapshot without ratings", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+		store.CompactEvery = 2
+		store.RecordGame(heads)
+		store.RecordGame(table)
+		store.Close()
+
+		os.WriteFile(store.path+snapshotSuffix, []byte(`{"seq":2,"league":[{"Name":"Cleo","Wins":1},{"Name":"Chris","Wins":1}]}`), 0666)
+
+		assertKeptRatings(t, createEventLogStore(t, dir))
+	})
+}
+
+func TestWriteRatings(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	WriteRatings(out, []Rating{{"Cleo", 1516, 1}, {"Chris", 1484, 1}})
+
+	want := "#  Player  Rating  Games\n1  Cleo    1516    1\n2  Chris   1484    1\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRatingsEndpoint(t *testing.T) {
+	database, cleanDatabase := createTempFile(t, "")
+	defer cleanDatabase()
+
+	store, err := NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+
+	t.Run("returns ratings with the server's parameters", func(t *testing.T) {
+		server := NewPlayerServer(store, WithRatingParams(RatingParams{Initial: 1000, K: 20}))
+
+		request, _ := http.NewRequest(http.MethodGet, "/ratings", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertRatings(t, getRatingsFromResponse(t, response), map[string]float64{"Cleo": 1010, "Chris": 990})
+	})
+
+	t.Run("recomputes ratings with parameters from the query", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/ratings?k=64", nil)
+		response := httptest.NewRecorder()
+
+		NewPlayerServer(store).ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertRatings(t, getRatingsFromResponse(t, response), map[string]float64{"Cleo": 1532, "Chris": 1468})
+	})
+
+	t.Run("rejects bad parameters", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/ratings?k=lots", nil)
+		response := httptest.NewRecorder()
+
+		NewPlayerServer(store).ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func getRatingsFromResponse(t *testing.T, response *httptest.ResponseRecorder) []Rating {
+	t.Helper()
+	var ratings []Rating
+
+	if err := json.NewDecoder(response.Body).Decode(&ratings); err != nil {
+		t.Fatalf("Unable to parse response from server into slice of Rating, '%v'", err)
+	}
+
+	return ratings
+}
+
+func assertRatings(t *testing.T, got []Rating, want map[string]float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d ratings want %d", len(got), len(want))
+	}
+
+	for _, rating := range got {
+		if math.Abs(rating.Rating-want[rating.Name]) > 1e-9 {
+			t.Errorf("got %s rated %v want %v", rating.Name, rating.Rating, want[rating.Name])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultLeague is the league games belong to when none is given.
+const DefaultLeague = "default"
+
+// CurrentSeason can be used in place of a season name to mean the open season.
+const CurrentSeason = "current"
+
+// Season is a time-boxed competition within a named league. A season is open
+// until it is closed, when its final table is archived.
+type Season struct {
+	League string     `json:"league"`
+	Name   string     `json:"name"`
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end,omitempty"`
+	Final  League     `json:"final,omitempty"`
+}
+
+// Open reports whether games are still being counted towards the season.
+func (s Season) Open() bool {
+	return s.End == nil
+}
+
+// Filter selects the games counted towards the season.
+func (s Season) Filter() GameFilter {
+	filter := GameFilter{League: s.League, From: s.Start}
+
+	if s.End != nil {
+		filter.To = *s.End
+	}
+
+	return filter
+}
+
+// SeasonStore keeps track of the seasons of every league.
+type SeasonStore interface {
+	GetSeasons(league string) ([]Season, error)
+	StartSeason(league, name string) (Season, error)
+	CloseSeason(league string) (Season, error)
+}
+
+// leagueName returns the league a game was played in.
+func leagueName(name string) string {
+	if name == "" {
+		return DefaultLeague
+	}
+	return name
+}
+
+func validateSeasonName(kind, name string) error {
+	if name == "" || strings.ContainsAny(name, "/?#") || name == CurrentSeason {
+		return StatusError{http.StatusBadRequest, fmt.Errorf("invalid %s name %q", kind, name)}
+	}
+	return nil
+}
+
+var errNoOpenSeason = errors.New("no open season")
+
+// findSeason returns the season called name in seasons, or the open one for CurrentSeason.
+func findSeason(seasons []Season, name string) (Season, error) {
+	for i := len(seasons) - 1; i >= 0; i-- {
+		if seasons[i].Name == name || (name == CurrentSeason && seasons[i].Open()) {
+			return seasons[i], nil
+		}
+	}
+
+	if name == CurrentSeason {
+		return Season{}, StatusError{http.StatusNotFound, errNoOpenSeason}
+	}
+
+	return Season{}, StatusError{http.StatusNotFound, fmt.Errorf("no season called %q", name)}
+}
+
+// startSeason opens a new season in db, which must not have an open season in the same league.
+func (db *database) startSeason(league, name string, now time.Time) (Season, error) {
+	league = leagueName(league)
+
+	if err := validateSeasonName("league", league); err != nil {
+		return Season{}, err
+	}
+
+	if err := validateSeasonName("season", name); err != nil {
+		return Season{}, err
+	}
+
+	for _, season := range db.Seasons {
+		if season.League != league {
+			continue
+		}
+
+		if season.Name == name {
+			return Season{}, StatusError{http.StatusConflict, fmt.Errorf("league %s already has a season called %q", league, name)}
+		}
+
+		if season.Open() {
+			return Season{}, StatusError{http.StatusConflict, fmt.Errorf("season %q of league %s is still open", season.Name, league)}
+		}
+	}
+
+	season := Season{League: league, Name: name, Start: now}
+	db.Seasons = append(db.Seasons, season)
+
+	return season, nil
+}
+
+// closeSeason ends the open season of league in db and archives its final table.
+func (db *database) closeSeason(league string, now time.Time) (Season, error) {
+	league = leagueName(league)
+
+	for i, season := range db.Seasons {
+		if season.League != league || !season.Open() {
+			continue
+		}
+
+		season.End = &now
+		games := FilterGames(db.Games, season.Filter())
+		season.Final = LeagueFromGames(games)
+		season.Final.SortBy(ComputeStats(games), DefaultSortKeys...)
+		db.Seasons[i] = season
+
+		return season, nil
+	}
+
+	return Season{}, StatusError{http.StatusNotFound, fmt.Errorf("league %s has %v", league, errNoOpenSeason)}
+}
+
+func seasonsOf(seasons []Season, league string) []Season {
+	matched := []Season{}
+
+	for _, season := range seasons {
+		if season.League == leagueName(league) {
+			matched = append(matched, season)
+		}
+	}
+
+	return matched
+}
+
+// Standings returns the table of a season: the archived final table once it
+// has closed, or the table so far from the history of games while it is open.
+func Standings(season Season, games GameStore) (League, error) {
+	if !season.Open() {
+		return season.Final, nil
+	}
+
+	history, err := games.GetGames(season.Filter())
+
+	if err != nil {
+		return nil, err
+	}
+
+	league := LeagueFromGames(history)
+	league.SortBy(ComputeStats(history), DefaultSortKeys...)
+
+	return league, nil
+}
@@ -0,0 +1,162 @@
+package poker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func createSeasonStore(t *testing.T) *FileSystemPlayerStore {
+	t.Helper()
+
+	database, cleanDatabase := createTempFile(t, "")
+	t.Cleanup(cleanDatabase)
+
+	store, err := NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	return store
+}
+
+func TestSeasons(t *testing.T) {
+
+	t.Run("counts only the league's games since the season started", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.now = func() time.Time { return monday }
+
+		store.RecordGame(Game{Time: monday.Add(-time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Chris", League: "monday"})
+
+		_, err := store.StartSeason("monday", "spring")
+		assertNoError(t, err)
+
+		store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Cleo", League: "monday"})
+		store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Chris", League: "friday"})
+
+		seasons, _ := store.GetSeasons("monday")
+		standings, err := Standings(seasons[0], store)
+		assertNoError(t, err)
+
+		assertLeague(t, standings, []Player{{"Cleo", 1}, {"Chris", 0}})
+	})
+
+	t.Run("archives the final table when a season closes", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.now = func() time.Time { return monday }
+
+		store.StartSeason("monday", "spring")
+		store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Cleo", League: "monday"})
+
+		store.now = func() time.Time { return friday }
+		season, err := store.CloseSeason("monday")
+		assertNoError(t, err)
+
+		if season.Open() || !season.End.Equal(friday) {
+			t.Errorf("expected the season to end on friday, got %+v", season)
+		}
+
+		store.RecordGame(Game{Time: friday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Chris", League: "monday"})
+
+		standings, err := Standings(season, store)
+		assertNoError(t, err)
+		assertLeague(t, standings, []Player{{"Cleo", 1}, {"Chris", 0}})
+	})
+
+	t.Run("only one season of a league can be open", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		store.StartSeason("monday", "spring")
+		_, err := store.StartSeason("monday", "summer")
+
+		assertStatus(t, statusFor(err), http.StatusConflict)
+
+		_, err = store.StartSeason("friday", "summer")
+		assertNoError(t, err)
+	})
+
+	t.Run("season names are unique within a league", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		store.StartSeason("monday", "spring")
+		store.CloseSeason("monday")
+		_, err := store.StartSeason("monday", "spring")
+
+		assertStatus(t, statusFor(err), http.StatusConflict)
+	})
+
+	t.Run("closing a league without an open season is not found", func(t *testing.T) {
+		store := createSeasonStore(t)
+
+		_, err := store.CloseSeason("monday")
+
+		assertStatus(t, statusFor(err), http.StatusNotFound)
+	})
+}
+
+func TestSeasonEndpoints(t *testing.T) {
+	store := createSeasonStore(t)
+	store.now = func() time.Time { return monday }
+	server := NewPlayerServer(store)
+
+	store.RecordWin("Pepper")
+	store.StartSeason("monday", "spring")
+	store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Cleo", League: "monday"})
+
+	t.Run("lists the seasons of a league", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/leagues/monday/seasons"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var seasons []Season
+		json.NewDecoder(response.Body).Decode(&seasons)
+
+		if len(seasons) != 1 || seasons[0].Name != "spring" {
+			t.Errorf("got %+v want only spring", seasons)
+		}
+	})
+
+	t.Run("returns the standings of a season by name", func(t *testing.T) {
+		for _, path := range []string{"/leagues/monday/seasons/spring", "/leagues/monday/seasons/current"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest(path))
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertLeague(t, getLeagueFromResponse(t, response.Body), []Player{{"Cleo", 1}, {"Chris", 0}})
+		}
+	})
+
+	t.Run("returns 404 for an unknown season", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/leagues/monday/seasons/winter"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("league is the all-time table without a default season", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLeagueRequest())
+
+		got := League(getLeagueFromResponse(t, response.Body))
+		if got.Find("Pepper") == nil {
+			t.Errorf("expected Pepper in the all-time league, got %v", got)
+		}
+	})
+
+	t.Run("league follows the current default season", func(t *testing.T) {
+		store.now = func() time.Time { return friday }
+		store.StartSeason(DefaultLeague, "2024")
+		store.RecordWin("Tiest")
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLeagueRequest())
+
+		assertLeague(t, getLeagueFromResponse(t, response.Body), []Player{{"Tiest", 1}})
+	})
+}
+
+func newGetRequest(path string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	return req
+}
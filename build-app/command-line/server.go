@@ -2,15 +2,22 @@ package poker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // PlayerStore stores score information about players.
 type PlayerStore interface {
-	GetPlayerScore(name string) int
-	RecordWin(name string)
-	GetLeague() League
+	GetPlayerScore(name string) (int, error)
+	RecordWin(name string) error
+	GetLeague() (League, error)
 }
 
 // Player stores a name with a number of wins.
@@ -21,45 +28,288 @@ type Player struct {
 
 // PlayerServer is a HTTP interface for player information.
 type PlayerServer struct {
-	store PlayerStore
+	store        PlayerStore
+	ratingParams RatingParams
+	tokens       TokenVerifier
+	anonymous    Role
+	idempotency  *IdempotencyStore
+	wins         *winLimiter
+	stream       *leagueStream
+	alerter      BlindAlerter
+	metrics      *Metrics
+	cache        responseCache
+	audit        *AuditLog
+	webhooks     *Webhooks
+	accessLog    *slog.Logger
+	// unwatch stops the server hearing about changes to the store.
+	unwatch []func()
+	// draining is closed when the server starts shutting down.
+	draining  chan struct{}
+	drainOnce sync.Once
+	// games counts the games being played over /ws.
+	games sync.WaitGroup
 	http.Handler
 }
 
+// ServerOption configures optional behaviour of a PlayerServer.
+type ServerOption func(*PlayerServer)
+
+// WithRatingParams sets the default parameters used to compute /ratings.
+func WithRatingParams(params RatingParams) ServerOption {
+	return func(p *PlayerServer) {
+		p.ratingParams = params
+	}
+}
+
+// WithAuth requires a bearer token checked by tokens for any request the
+// anonymous role is not allowed to make. Use RoleNone to turn away anonymous
+// clients entirely, or RoleRead to let anyone look but not touch.
+func WithAuth(tokens TokenVerifier, anonymous Role) ServerOption {
+	return func(p *PlayerServer) {
+		p.tokens = tokens
+		p.anonymous = anonymous
+	}
+}
+
+// WithIdempotency replays the original response to POST requests retried
+// with the same Idempotency-Key header instead of applying them twice.
+func WithIdempotency(store *IdempotencyStore) ServerOption {
+	return func(p *PlayerServer) {
+		p.idempotency = store
+	}
+}
+
+// WithWinInterval turns away a win for a player recorded within interval of
+// their last one, to catch accidental double taps.
+func WithWinInterval(interval time.Duration) ServerOption {
+	return func(p *PlayerServer) {
+		if interval > 0 {
+			p.wins = newWinLimiter(interval)
+		}
+	}
+}
+
+// WithBlindAlerter sets how games played over /ws announce the blinds going up.
+func WithBlindAlerter(alerter BlindAlerter) ServerOption {
+	return func(p *PlayerServer) {
+		p.alerter = alerter
+	}
+}
+
+// WithAccessLog logs every request to logger, after it has been served.
+func WithAccessLog(logger *slog.Logger) ServerOption {
+	return func(p *PlayerServer) {
+		p.accessLog = logger
+	}
+}
+
 const jsonContentType = "application/json"
 
 // NewPlayerServer creates a PlayerServer with routing configured.
-func NewPlayerServer(store PlayerStore) *PlayerServer {
+func NewPlayerServer(store PlayerStore, options ...ServerOption) *PlayerServer {
 	p := new(PlayerServer)
 
 	p.store = store
+	p.ratingParams = DefaultRatingParams
+	p.alerter = BlindAlerterFunc(Alerter)
+	p.draining = make(chan struct{})
+	p.metrics = NewMetrics()
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if notifier, ok := store.(ChangeNotifier); ok {
+		p.stream = newLeagueStream(store)
+		p.unwatch = append(p.unwatch, notifier.OnChange(p.stream.publish))
+
+		if p.webhooks != nil {
+			p.unwatch = append(p.unwatch, p.webhooks.watch(store, notifier))
+		}
+	}
 
 	router := http.NewServeMux()
-	router.Handle("/league", http.HandlerFunc(p.leagueHandler))
+	router.Handle("/healthz", http.HandlerFunc(p.healthzHandler))
+	router.Handle("/readyz", http.HandlerFunc(p.readyzHandler))
+	router.Handle("/metrics", http.HandlerFunc(p.metricsHandler))
+	router.Handle("/league", p.cached(p.leagueHandler))
+	router.Handle("/league/stream", http.HandlerFunc(p.leagueStreamHandler))
+	router.Handle("/league/import", http.HandlerFunc(p.importHandler))
+	router.Handle("/league/export", http.HandlerFunc(p.exportHandler))
+	router.Handle("/ws", http.HandlerFunc(p.webSocketHandler))
+	router.Handle("/{$}", http.HandlerFunc(p.homeHandler))
+	router.Handle("/players/{name}/profile", http.HandlerFunc(p.playerPageHandler))
+	router.Handle("/win", http.HandlerFunc(p.winFormHandler))
+	router.Handle("/login", http.HandlerFunc(p.loginHandler))
+	router.Handle("/logout", http.HandlerFunc(p.logoutHandler))
+	router.Handle("/static/", staticHandler())
 	router.Handle("/players/", http.HandlerFunc(p.playersHandler))
+	router.Handle("/players/{name}/stats", http.HandlerFunc(p.statsHandler))
+	router.Handle("/games", http.HandlerFunc(p.gamesHandler))
+	router.Handle("/ratings", http.HandlerFunc(p.ratingsHandler))
+	router.Handle("/leagues/{league}/seasons", http.HandlerFunc(p.seasonsHandler))
+	router.Handle("/leagues/{league}/seasons/{season}", p.cached(p.seasonHandler))
+	router.Handle("/admin/players/{name}", http.HandlerFunc(p.adminPlayerHandler))
+	router.Handle("/admin/players/{name}/{action}", http.HandlerFunc(p.adminActionHandler))
+	router.Handle("/admin/audit", http.HandlerFunc(p.auditHandler))
+	router.Handle("/admin/snapshot", http.HandlerFunc(p.snapshotHandler))
+	router.Handle("/admin/webhooks", http.HandlerFunc(p.webhooksHandler))
+	router.Handle("/admin/webhooks/{id}", http.HandlerFunc(p.webhookHandler))
+	router.Handle("/admin/webhooks/deliveries", http.HandlerFunc(p.deliveriesHandler))
+	router.Handle("/admin/webhooks/deliveries/{id}/redeliver", http.HandlerFunc(p.redeliverHandler))
 
 	p.Handler = router
 
+	if p.idempotency != nil {
+		p.Handler = idempotent(p.Handler, p.idempotency)
+	}
+
+	if p.tokens != nil {
+		p.Handler = authenticate(p.Handler, p.tokens, p.anonymous)
+	}
+
+	p.Handler = instrument(p.Handler, router, p.metrics, p.accessLog)
+
 	return p
 }
 
 func (p *PlayerServer) leagueHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", jsonContentType)
-	json.NewEncoder(w).Encode(p.store.GetLeague())
+	season, inSeason, err := defaultSeason(p.store)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !inSeason {
+		league, err := p.store.GetLeague()
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		p.serveStandings(w, r, league, GameFilter{})
+		return
+	}
+
+	standings, err := Standings(season, p.store.(GameStore))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	p.serveStandings(w, r, standings, season.Filter())
+}
+
+// serveStandings filters, sorts and pages a league table as the query asks,
+// working out statistics from the games matching scope when needed. Stores
+// without a history of games can't filter or sort by them.
+func (p *PlayerServer) serveStandings(w http.ResponseWriter, r *http.Request, league League, scope GameFilter) {
+	query, paged, err := parseLeagueQuery(r.URL.Query())
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var stats map[string]PlayerStats
+
+	if query.needsStats() {
+		games, ok := p.store.(GameStore)
+
+		if !ok {
+			writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep player statistics")
+			return
+		}
+
+		history, err := games.GetGames(scope)
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		stats = ComputeStats(history)
+	}
+
+	page := query.Apply(league, stats)
+
+	if !paged {
+		writeLeague(w, r, page.Players)
+		return
+	}
+
+	writeLeaguePage(w, r, page)
+}
+
+// DefaultStandings is the table of the open season of the DefaultLeague,
+// or the all-time league when no season has been started.
+func DefaultStandings(store PlayerStore) (League, error) {
+	season, ok, err := defaultSeason(store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return store.GetLeague()
+	}
+
+	return Standings(season, store.(GameStore))
+}
+
+// defaultSeason finds the open season of the DefaultLeague, with ok false
+// when there is none or the store does not keep seasons.
+func defaultSeason(store PlayerStore) (season Season, ok bool, err error) {
+	seasons, ok := store.(SeasonStore)
+	_, hasGames := store.(GameStore)
+
+	if !ok || !hasGames {
+		return Season{}, false, nil
+	}
+
+	all, err := seasons.GetSeasons(DefaultLeague)
+
+	if err != nil {
+		return Season{}, false, err
+	}
+
+	season, err = findSeason(all, CurrentSeason)
+
+	return season, err == nil, nil
 }
 
 func (p *PlayerServer) playersHandler(w http.ResponseWriter, r *http.Request) {
-	player := r.URL.Path[len("/players/"):]
+	player := strings.TrimPrefix(r.URL.Path, "/players/")
 
 	switch r.Method {
 	case http.MethodPost:
 		p.processWin(w, player)
 	case http.MethodGet:
 		p.showScore(w, player)
+	default:
+		writeMethodNotAllowed(w, r, "GET, POST")
 	}
 }
 
+// showScore writes a player's all-time wins. It doesn't follow the open
+// season the way /league does; a player's season is on the season's table.
 func (p *PlayerServer) showScore(w http.ResponseWriter, player string) {
-	score := p.store.GetPlayerScore(player)
+	player, err := canonicalName(p.store, player)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	score, err := p.store.GetPlayerScore(player)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	if score == 0 {
 		w.WriteHeader(http.StatusNotFound)
@@ -69,6 +319,222 @@ func (p *PlayerServer) showScore(w http.ResponseWriter, player string) {
 }
 
 func (p *PlayerServer) processWin(w http.ResponseWriter, player string) {
-	p.store.RecordWin(player)
+	if err := p.recordWin(player); err != nil {
+		var tooSoon WinTooSoonError
+
+		if errors.As(err, &tooSoon) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooSoon.Wait.Seconds()))))
+		}
+
+		writeError(w, err)
+		return
+	}
+
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// recordWin is the one path every front end records a win through, so the
+// same checks apply to the API and the HTML form alike.
+func (p *PlayerServer) recordWin(player string) error {
+	player, err := canonicalName(p.store, player)
+
+	if err != nil {
+		return err
+	}
+
+	release := func() {}
+
+	if p.wins != nil {
+		if release, err = p.wins.allow(player); err != nil {
+			return err
+		}
+	}
+
+	if err := p.metrics.observeWrite(writeRecordWin, p.store.RecordWin(player)); err != nil {
+		release()
+		return err
+	}
+
+	return nil
+}
+
+// serverStore records wins through the server's recordWin, for code outside
+// the server that writes to the store itself, such as TexasHoldem.
+type serverStore struct {
+	PlayerStore
+	server *PlayerServer
+}
+
+func (s serverStore) RecordWin(name string) error {
+	return s.server.recordWin(name)
+}
+
+func (p *PlayerServer) statsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, ok := p.store.(StatsStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep player statistics")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	playerStats, err := stats.GetPlayerStats(r.PathValue("name"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, playerStats)
+}
+
+func (p *PlayerServer) gamesHandler(w http.ResponseWriter, r *http.Request) {
+	games, ok := p.store.(GameStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep a history of games")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p.listGames(w, r, games)
+	case http.MethodPost:
+		p.recordGame(w, r, games)
+	default:
+		writeMethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+func (p *PlayerServer) listGames(w http.ResponseWriter, r *http.Request, store GameStore) {
+	filter, err := parseGameFilter(r.URL.Query())
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	games, err := store.GetGames(filter)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, games)
+}
+
+func (p *PlayerServer) recordGame(w http.ResponseWriter, r *http.Request, store GameStore) {
+	var game Game
+
+	if err := json.NewDecoder(r.Body).Decode(&game); err != nil {
+		writeErrorStatus(w, http.StatusBadRequest, fmt.Sprintf("problem parsing game, %v", err))
+		return
+	}
+
+	game, err := store.RecordGame(game)
+	p.metrics.observeWrite(writeRecordGame, err)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, game)
+}
+
+func (p *PlayerServer) ratingsHandler(w http.ResponseWriter, r *http.Request) {
+	ratings, ok := p.store.(RatingStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep ratings")
+		return
+	}
+
+	params, err := parseRatingParams(r.URL.Query(), p.ratingParams)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rated, err := ratings.GetRatings(params)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rated)
+}
+
+func (p *PlayerServer) seasonsHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, ok := p.store.(SeasonStore)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep seasons")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	all, err := seasons.GetSeasons(r.PathValue("league"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, all)
+}
+
+func (p *PlayerServer) seasonHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, ok := p.store.(SeasonStore)
+	games, hasGames := p.store.(GameStore)
+
+	if !ok || !hasGames {
+		writeErrorStatus(w, http.StatusNotImplemented, "this store does not keep seasons")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	all, err := seasons.GetSeasons(r.PathValue("league"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	season, err := findSeason(all, r.PathValue("season"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	standings, err := Standings(season, games)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	p.serveStandings(w, r, standings, season.Filter())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,11 +1,14 @@
 package poker
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"syscall"
 	"testing"
 )
 
@@ -97,6 +100,64 @@ func TestLeague(t *testing.T) {
 	})
 }
 
+func TestStoreErrors(t *testing.T) {
+
+	cases := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"unexpected errors are internal server errors", errors.New("disk on fire"), http.StatusInternalServerError, "Internal Server Error"},
+		{"a full disk is insufficient storage", fmt.Errorf("problem saving win to /srv/game.db.json, %w", syscall.ENOSPC), http.StatusInsufficientStorage, "Insufficient Storage"},
+		{"status errors keep their status", StatusError{http.StatusConflict, errors.New("busy")}, http.StatusConflict, "busy"},
+		{"server status errors don't leak their message", StatusError{http.StatusServiceUnavailable, errors.New("lock /srv/game.db.json.lock held")}, http.StatusServiceUnavailable, "Service Unavailable"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := NewPlayerServer(&FailingPlayerStore{c.err})
+
+			for _, request := range []*http.Request{newPostWinRequest("Pepper"), newGetScoreRequest("Pepper"), newLeagueRequest()} {
+				response := httptest.NewRecorder()
+
+				server.ServeHTTP(response, request)
+
+				assertStatus(t, response.Code, c.wantStatus)
+				assertContentType(t, response, jsonContentType)
+				assertErrorResponse(t, response.Body, ErrorResponse{c.wantStatus, c.wantMessage})
+			}
+		})
+	}
+
+	t.Run("rejects unsupported methods", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{})
+
+		request, _ := http.NewRequest(http.MethodDelete, "/players/Pepper", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+		if got := response.Header().Get("Allow"); got != "GET, POST" {
+			t.Errorf("got Allow header %q want %q", got, "GET, POST")
+		}
+	})
+}
+
+func assertErrorResponse(t *testing.T, body io.Reader, want ErrorResponse) {
+	t.Helper()
+	var got ErrorResponse
+
+	if err := json.NewDecoder(body).Decode(&got); err != nil {
+		t.Fatalf("Unable to parse error response from server, '%v'", err)
+	}
+
+	if got != want {
+		t.Errorf("got error response %+v want %+v", got, want)
+	}
+}
+
 func assertContentType(t *testing.T, response *httptest.ResponseRecorder, want string) {
 	t.Helper()
 	if response.Header().Get("content-type") != want {
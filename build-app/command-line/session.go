@@ -0,0 +1,196 @@
+package poker
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Browsers can't send bearer tokens, so the web pages sign in by pasting a
+// token into /login, which keeps it in a session cookie. Every form carries
+// a CSRF token that must match the cookie of the same name, so other sites
+// can't post them on a visitor's behalf, and the notice shown after a form is
+// handed over in a cookie read once, so a link can't fake one.
+const (
+	sessionCookie = "poker_session"
+	csrfCookie    = "poker_csrf"
+	flashCookie   = "poker_flash"
+	// csrfField is the form field holding the CSRF token.
+	csrfField = "csrf"
+)
+
+// formExpired is shown when a form is posted without the visitor's CSRF token.
+const formExpired = "The form has expired, reload the page and try again."
+
+// sessionAllowed reports whether a session cookie may stand in for a bearer
+// token on r: for reads, and for the forms, which check a CSRF token.
+// WebSocket handshakes are left out, as they can record wins without a form.
+func sessionAllowed(r *http.Request) bool {
+	if headerHasToken(r.Header, "Upgrade", "websocket") {
+		return false
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return r.URL.Path == "/win" || r.URL.Path == "/logout"
+	default:
+		return false
+	}
+}
+
+// acceptsHTML reports whether r came from a browser, which is shown an error
+// page rather than JSON.
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// setCookie sets a cookie for the whole site that scripts can't read. Other
+// sites can link to a page with it, but can't post a form with it.
+func setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// csrfToken returns the CSRF token of the visitor, giving them one if they have none.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	token, err := randomHex(16)
+
+	if err != nil {
+		return ""
+	}
+
+	setCookie(w, r, csrfCookie, token, 0)
+
+	return token
+}
+
+// checkCSRF reports whether the form posted in r carries the visitor's CSRF token.
+func checkCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue(csrfField))) == 1
+}
+
+// setFlash leaves a notice for the next page the visitor sees.
+func setFlash(w http.ResponseWriter, r *http.Request, notice string) {
+	setCookie(w, r, flashCookie, url.QueryEscape(notice), 0)
+}
+
+// takeFlash returns the notice left for this page, if any, and clears it.
+func takeFlash(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(flashCookie)
+
+	if err != nil {
+		return ""
+	}
+
+	setCookie(w, r, flashCookie, "", -1)
+	notice, _ := url.QueryUnescape(cookie.Value)
+
+	return notice
+}
+
+// pageFor fills in the parts of data every page shares.
+func (p *PlayerServer) pageFor(w http.ResponseWriter, r *http.Request, data page) page {
+	data.CSRF = csrfToken(w, r)
+	data.Sessions = p.tokens != nil
+
+	if token, ok := TokenFromContext(r.Context()); ok {
+		data.User = token.Name
+	}
+
+	return data
+}
+
+// renderDenied shows a browser why it was turned away, as an HTML page.
+func renderDenied(w http.ResponseWriter, status int, message string) {
+	renderPage(w, status, "denied", deniedPage{page: page{Error: message}, SignIn: status == http.StatusUnauthorized})
+}
+
+type deniedPage struct {
+	page
+	// SignIn offers signing in, for requests turned away for want of a token.
+	SignIn bool
+}
+
+type loginPage struct {
+	page
+}
+
+// loginHandler shows the sign in form, and signs in with the token posted to
+// it, keeping it in a session cookie.
+func (p *PlayerServer) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if p.tokens == nil {
+		renderPage(w, http.StatusNotFound, "denied", deniedPage{page: page{Error: "This server doesn't need signing in."}})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		renderPage(w, http.StatusOK, "login", loginPage{p.pageFor(w, r, page{})})
+		return
+	case http.MethodPost:
+	default:
+		writeMethodNotAllowed(w, r, "GET, POST")
+		return
+	}
+
+	if !checkCSRF(r) {
+		renderPage(w, http.StatusForbidden, "login", loginPage{p.pageFor(w, r, page{Error: formExpired})})
+		return
+	}
+
+	presented := strings.TrimSpace(r.PostFormValue("token"))
+	token, err := p.tokens.Verify(presented)
+
+	if errors.Is(err, errInvalidToken) {
+		renderPage(w, http.StatusUnauthorized, "login", loginPage{p.pageFor(w, r, page{Error: "That token is not valid."})})
+		return
+	}
+
+	if err != nil {
+		renderPage(w, statusFor(err), "login", loginPage{p.pageFor(w, r, page{Error: fmt.Sprintf("Could not sign in: %s", errorMessage(err))})})
+		return
+	}
+
+	setCookie(w, r, sessionCookie, presented, 0)
+	setFlash(w, r, fmt.Sprintf("Signed in as %s.", token.Name))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// logoutHandler forgets the session cookie.
+func (p *PlayerServer) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	if !checkCSRF(r) {
+		renderDenied(w, http.StatusForbidden, formExpired)
+		return
+	}
+
+	setCookie(w, r, sessionCookie, "", -1)
+	setFlash(w, r, "Signed out.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,37 @@
+// Keeps the leaderboard up to date from /league/stream. Without JavaScript,
+// or without a store that announces changes, the page is simply static.
+(function () {
+  var body = document.getElementById("standings");
+
+  if (!body || !window.EventSource) {
+    return;
+  }
+
+  var stream = new EventSource("/league/stream");
+
+  stream.addEventListener("league", function (event) {
+    var league = JSON.parse(event.data).league || [];
+    var rows = document.createDocumentFragment();
+
+    league.forEach(function (player, i) {
+      var row = document.createElement("tr");
+      var rank = document.createElement("td");
+      var name = document.createElement("td");
+      var link = document.createElement("a");
+      var wins = document.createElement("td");
+
+      rank.textContent = i + 1;
+      link.href = "/players/" + encodeURIComponent(player.Name) + "/profile";
+      link.textContent = player.Name;
+      name.appendChild(link);
+      wins.textContent = player.Wins;
+
+      row.append(rank, name, wins);
+      rows.appendChild(row);
+    });
+
+    if (league.length > 0) {
+      body.replaceChildren(rows);
+    }
+  });
+})();
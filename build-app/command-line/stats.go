@@ -0,0 +1,211 @@
+package poker
+
+import (
+	"cmp"
+	"sort"
+	"time"
+)
+
+// PlayerStats describes how a player has done across their recorded games.
+type PlayerStats struct {
+	Name          string                `json:"name"`
+	Played        int                   `json:"played"`
+	Wins          int                   `json:"wins"`
+	Losses        int                   `json:"losses"`
+	WinRate       float64               `json:"win_rate"`
+	CurrentStreak int                   `json:"current_streak"`
+	LongestStreak int                   `json:"longest_streak"`
+	LastPlayed    *time.Time            `json:"last_played,omitempty"`
+	HeadToHead    map[string]HeadToHead `json:"head_to_head"`
+}
+
+// HeadToHead counts the games between two players that one of them won.
+type HeadToHead struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+}
+
+// StatsStore keeps statistics about every player.
+type StatsStore interface {
+	GetPlayerStats(name string) (PlayerStats, error)
+}
+
+// statsBook keeps the statistics of every player up to date as games are recorded.
+type statsBook map[string]*PlayerStats
+
+func (b statsBook) player(name string) *PlayerStats {
+	stats, ok := b[name]
+
+	if !ok {
+		stats = &PlayerStats{Name: name, HeadToHead: map[string]HeadToHead{}}
+		b[name] = stats
+	}
+
+	return stats
+}
+
+// record adds a game to the statistics. Streaks follow the order games are
+// recorded in, so games must be recorded in the order they were played.
+func (b statsBook) record(game Game) {
+	for _, name := range game.Players {
+		stats := b.player(name)
+		stats.Played++
+
+		if stats.LastPlayed == nil || game.Time.After(*stats.LastPlayed) {
+			played := game.Time
+			stats.LastPlayed = &played
+		}
+
+		if name == game.Winner {
+			stats.Wins++
+			stats.CurrentStreak++
+			stats.LongestStreak = max(stats.LongestStreak, stats.CurrentStreak)
+		} else {
+			stats.Losses++
+			stats.CurrentStreak = 0
+
+			winner := b.player(game.Winner)
+			h2h := winner.HeadToHead[name]
+			h2h.Wins++
+			winner.HeadToHead[name] = h2h
+
+			h2h = stats.HeadToHead[game.Winner]
+			h2h.Losses++
+			stats.HeadToHead[game.Winner] = h2h
+		}
+
+		stats.WinRate = float64(stats.Wins) / float64(stats.Played)
+	}
+}
+
+// get returns a copy of the statistics of a player, with ok false if they never played.
+func (b statsBook) get(name string) (PlayerStats, bool) {
+	stats, ok := b[name]
+
+	if !ok {
+		return PlayerStats{Name: name, HeadToHead: map[string]HeadToHead{}}, false
+	}
+
+	return stats.copy(), true
+}
+
+// snapshot copies every player's statistics.
+func (b statsBook) snapshot() map[string]PlayerStats {
+	all := make(map[string]PlayerStats, len(b))
+
+	for name, stats := range b {
+		all[name] = stats.copy()
+	}
+
+	return all
+}
+
+func (s PlayerStats) copy() PlayerStats {
+	h2h := make(map[string]HeadToHead, len(s.HeadToHead))
+
+	for name, record := range s.HeadToHead {
+		h2h[name] = record
+	}
+
+	s.HeadToHead = h2h
+
+	return s
+}
+
+// ComputeStats works out every player's statistics from a history of games.
+func ComputeStats(games []Game) map[string]PlayerStats {
+	return statsFromGames(games).snapshot()
+}
+
+func statsFromGames(games []Game) statsBook {
+	book := statsBook{}
+
+	for _, game := range FilterGames(games, GameFilter{}) {
+		book.record(game)
+	}
+
+	return book
+}
+
+// playedLast reports whether the last of games was played no earlier than
+// those before it, so it can be added to their statistics as it is rather
+// than working them out again.
+func playedLast(games []Game) bool {
+	if len(games) == 0 {
+		return true
+	}
+
+	last := games[len(games)-1]
+
+	for _, game := range games[:len(games)-1] {
+		if last.Time.Before(game.Time) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortKey orders a league by one statistic.
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// DefaultSortKeys rank by wins, breaking ties by win rate, then the longest streak, then name.
+var DefaultSortKeys = []SortKey{
+	{"wins", true},
+	{"win_rate", true},
+	{"longest_streak", true},
+	{"name", false},
+}
+
+// sortFields compare two players by the named statistic.
+var sortFields = map[string]func(a, b Player, sa, sb PlayerStats) int{
+	"name":     func(a, b Player, sa, sb PlayerStats) int { return cmp.Compare(a.Name, b.Name) },
+	"wins":     func(a, b Player, sa, sb PlayerStats) int { return cmp.Compare(a.Wins, b.Wins) },
+	"played":   func(a, b Player, sa, sb PlayerStats) int { return cmp.Compare(sa.Played, sb.Played) },
+	"losses":   func(a, b Player, sa, sb PlayerStats) int { return cmp.Compare(sa.Losses, sb.Losses) },
+	"win_rate": func(a, b Player, sa, sb PlayerStats) int { return cmp.Compare(sa.WinRate, sb.WinRate) },
+	"current_streak": func(a, b Player, sa, sb PlayerStats) int {
+		return cmp.Compare(sa.CurrentStreak, sb.CurrentStreak)
+	},
+	"longest_streak": func(a, b Player, sa, sb PlayerStats) int {
+		return cmp.Compare(sa.LongestStreak, sb.LongestStreak)
+	},
+	"last_played": func(a, b Player, sa, sb PlayerStats) int {
+		return lastPlayed(sa).Compare(lastPlayed(sb))
+	},
+}
+
+func lastPlayed(stats PlayerStats) time.Time {
+	if stats.LastPlayed == nil {
+		return time.Time{}
+	}
+	return *stats.LastPlayed
+}
+
+// SortBy orders the league by each key in turn, using stats for everything but
+// the name and wins. Players without stats sort as if they had never played.
+func (l League) SortBy(stats map[string]PlayerStats, keys ...SortKey) {
+	sort.SliceStable(l, func(i, j int) bool {
+		for _, key := range keys {
+			compare, ok := sortFields[key.Field]
+
+			if !ok {
+				continue
+			}
+
+			c := compare(l[i], l[j], stats[l[i].Name], stats[l[j].Name])
+
+			if key.Descending {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,228 @@
+package poker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeStats(t *testing.T) {
+	games := []Game{
+		{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Chris"},
+		{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo", "Pepper"}, Winner: "Chris"},
+		{Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"},
+		{Time: friday.Add(time.Hour), Players: []string{"Chris", "Pepper"}, Winner: "Chris"},
+	}
+
+	stats := ComputeStats(games)
+	lastGame := friday.Add(time.Hour)
+
+	want := PlayerStats{
+		Name:          "Chris",
+		Played:        4,
+		Wins:          3,
+		Losses:        1,
+		WinRate:       0.75,
+		CurrentStreak: 1,
+		LongestStreak: 2,
+		LastPlayed:    &lastGame,
+		HeadToHead: map[string]HeadToHead{
+			"Cleo":   {Wins: 2, Losses: 1},
+			"Pepper": {Wins: 2},
+		},
+	}
+
+	if !reflect.DeepEqual(stats["Chris"], want) {
+		t.Errorf("got %+v want %+v", stats["Chris"], want)
+	}
+
+	if got := stats["Pepper"]; got.Played != 2 || got.Losses != 2 || got.WinRate != 0 {
+		t.Errorf("got %+v want two losses for Pepper", got)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	league := League{{"Pepper", 2}, {"Chris", 2}, {"Cleo", 2}, {"Tiest", 3}}
+	stats := map[string]PlayerStats{
+		"Pepper": {Played: 4, WinRate: 0.5, LongestStreak: 1},
+		"Chris":  {Played: 2, WinRate: 1, LongestStreak: 2},
+		"Cleo":   {Played: 4, WinRate: 0.5, LongestStreak: 2},
+		"Tiest":  {Played: 9, WinRate: 0.33},
+	}
+
+	t.Run("breaks ties in wins with the default keys", func(t *testing.T) {
+		sorted := append(League{}, league...)
+		sorted.SortBy(stats, DefaultSortKeys...)
+
+		assertLeague(t, sorted, []Player{{"Tiest", 3}, {"Chris", 2}, {"Cleo", 2}, {"Pepper", 2}})
+	})
+
+	t.Run("sorts by any statistic", func(t *testing.T) {
+		sorted := append(League{}, league...)
+		sorted.SortBy(stats, SortKey{"played", false}, SortKey{"name", false})
+
+		assertLeague(t, sorted, []Player{{"Chris", 2}, {"Cleo", 2}, {"Pepper", 2}, {"Tiest", 3}})
+	})
+}
+
+// statsHistoryStore keeps both the history of games and statistics about players.
+type statsHistoryStore interface {
+	GameStore
+	StatsStore
+}
+
+func TestStatsStores(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) statsHistoryStore{
+		"file system": func(t *testing.T) statsHistoryStore {
+			return createSeasonStore(t)
+		},
+		"event log": func(t *testing.T) statsHistoryStore {
+			return createEventLogStore(t, t.TempDir())
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			store.RecordGame(Game{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+			store.RecordGame(Game{Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+
+			stats, err := store.GetPlayerStats("Cleo")
+			assertNoError(t, err)
+
+			if stats.Played != 2 || stats.CurrentStreak != 2 || stats.HeadToHead["Chris"].Wins != 2 {
+				t.Errorf("got %+v want two wins in a row over Chris", stats)
+			}
+
+			_, err = store.GetPlayerStats("Apollo")
+			assertStatus(t, statusFor(err), http.StatusNotFound)
+
+			store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Chris"})
+			assertStatsMatchHistory(t, store, "Cleo", "Chris")
+		})
+	}
+
+	t.Run("event log keeps stats across compaction", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+		store.CompactEvery = 1
+
+		store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		store.Close()
+
+		store = createEventLogStore(t, dir)
+		stats, err := store.GetPlayerStats("Chris")
+		assertNoError(t, err)
+
+		if stats.Losses != 1 || stats.HeadToHead["Cleo"].Losses != 1 {
+			t.Errorf("got %+v want a loss to Cleo", stats)
+		}
+	})
+	t.Run("event log keeps stats in the order games were played across restarts", func(t *testing.T) {
+		dir := t.TempDir()
+		store := createEventLogStore(t, dir)
+		store.CompactEvery = 2
+
+		store.RecordGame(Game{Time: friday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		store.RecordGame(Game{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Chris"})
+		store.RecordGame(Game{Time: monday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		store.Close()
+
+		store = createEventLogStore(t, dir)
+		assertStatsMatchHistory(t, store, "Cleo", "Chris")
+
+		store.RecordGame(Game{Time: friday.Add(time.Hour), Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		assertStatsMatchHistory(t, store, "Cleo", "Chris")
+	})
+
+	t.Run("file system keeps stats of games recorded by another process", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+
+		other, closeOther, err := FileSystemPlayerStoreFromFile(store.path)
+		assertNoError(t, err)
+		defer closeOther()
+
+		other.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Chris"})
+
+		stats, err := store.GetPlayerStats("Chris")
+		assertNoError(t, err)
+
+		if stats.Played != 2 || stats.Wins != 1 || stats.CurrentStreak != 1 {
+			t.Errorf("got %+v want a win after a loss", stats)
+		}
+	})
+
+	t.Run("file system works stats out again after players are merged", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(Game{Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+		store.RecordGame(Game{Players: []string{"Chris", "Kris"}, Winner: "Kris"})
+
+		_, err := store.Administer(AdminAction{Action: AdminMerge, Player: "Cleo", From: []string{"Kris"}}, func(AdminResult) error { return nil })
+		assertNoError(t, err)
+
+		stats, err := store.GetPlayerStats("Cleo")
+		assertNoError(t, err)
+
+		if stats.Wins != 2 || stats.HeadToHead["Chris"].Wins != 2 {
+			t.Errorf("got %+v want both wins over Chris", stats)
+		}
+	})
+}
+
+// assertStatsMatchHistory checks the stats store keeps of players are those
+// ComputeStats works out from its history of games.
+func assertStatsMatchHistory(t *testing.T, store statsHistoryStore, players ...string) {
+	t.Helper()
+
+	games, err := store.GetGames(GameFilter{})
+	assertNoError(t, err)
+
+	want := ComputeStats(games)
+
+	for _, name := range players {
+		got, err := store.GetPlayerStats(name)
+		assertNoError(t, err)
+
+		if !reflect.DeepEqual(got, want[name]) {
+			t.Errorf("got stats %+v want %+v", got, want[name])
+		}
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	store := createSeasonStore(t)
+	store.RecordGame(Game{Time: monday, Players: []string{"Chris", "Cleo"}, Winner: "Cleo"})
+	server := NewPlayerServer(store)
+
+	t.Run("returns a player's stats", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/players/Cleo/stats"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		var stats PlayerStats
+		json.NewDecoder(response.Body).Decode(&stats)
+
+		if stats.Name != "Cleo" || stats.Wins != 1 || stats.WinRate != 1 {
+			t.Errorf("got %+v want Cleo's single win", stats)
+		}
+	})
+
+	t.Run("returns 404 for a player who never played", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/players/Apollo/stats"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("still serves scores", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetScoreRequest("Cleo"))
+
+		assertResponseBody(t, response.Body.String(), "1")
+	})
+}
@@ -1,15 +1,127 @@
 package poker
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 )
 
+const (
+	backupSuffix = ".bak"
+	tempPattern  = ".tmp-*"
+)
+
+// tape replaces the whole file at path on every write. The data is written to
+// a temporary file in the same directory, synced and renamed over the old file,
+// so a crash leaves either the previous or the new contents, never a mix.
+// The previous contents are kept next to the file as the last good copy.
 type tape struct {
-	file *os.File
+	path string
 }
 
 func (t *tape) Write(p []byte) (n int, err error) {
-	t.file.Truncate(0)
-	t.file.Seek(0, 0)
-	return t.file.Write(p)
-}
\ No newline at end of file
+	if err := keepBackup(t.path); err != nil {
+		return 0, err
+	}
+
+	if err := writeFileAtomic(t.path, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func backupPath(path string) string {
+	return path + backupSuffix
+}
+
+// keepBackup links the current file to its backup path before it gets replaced.
+func keepBackup(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	backup := backupPath(path)
+	linked := backup + ".new"
+	os.Remove(linked)
+
+	if err := os.Link(path, linked); err != nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("problem reading %s for backup, %w", path, err)
+		}
+		return writeFileAtomic(backup, data)
+	}
+
+	if err := os.Rename(linked, backup); err != nil {
+		return fmt.Errorf("problem keeping backup of %s, %w", path, err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it and renames it over path.
+// The file keeps the permissions of the one it replaces; a new file is only
+// readable by its owner.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, base+tempPattern)
+	if err != nil {
+		return fmt.Errorf("problem creating temp file for %s, %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return fmt.Errorf("problem setting permissions of temp file %s, %w", tmp.Name(), err)
+		}
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("problem writing temp file %s, %w", tmp.Name(), err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("problem syncing temp file %s, %w", tmp.Name(), err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("problem closing temp file %s, %w", tmp.Name(), err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("problem replacing %s, %w", path, err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir makes a rename inside dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("problem opening directory %s, %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("problem syncing directory %s, %w", dir, err)
+	}
+
+	return nil
+}
+
+// removeStaleTempFiles deletes temporary files left behind by an interrupted write.
+func removeStaleTempFiles(path string) {
+	matches, _ := filepath.Glob(path + tempPattern)
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
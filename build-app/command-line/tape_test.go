@@ -2,6 +2,8 @@ package poker
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -9,12 +11,11 @@ func TestTape_Write(t *testing.T) {
 	file, clean := createTempFile(t, "12345")
 	defer clean()
 
-	tape := &tape{file}
+	tape := &tape{file.Name()}
 
 	tape.Write([]byte("abc"))
 
-	file.Seek(0, 0)
-	newFileContents, _ := ioutil.ReadAll(file)
+	newFileContents, _ := ioutil.ReadFile(file.Name())
 
 	got := string(newFileContents)
 	want := "abc"
@@ -22,4 +23,38 @@ func TestTape_Write(t *testing.T) {
 	if got != want {
 		t.Errorf("got %q want %q", got, want)
 	}
-}
\ No newline at end of file
+
+	t.Run("keeps the previous contents as a backup", func(t *testing.T) {
+		backup, _ := ioutil.ReadFile(backupPath(file.Name()))
+
+		got := string(backup)
+		want := "12345"
+
+		if got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	})
+
+	t.Run("keeps the permissions of the file", func(t *testing.T) {
+		os.Chmod(file.Name(), 0o644)
+		tape.Write([]byte("def"))
+
+		info, err := os.Stat(file.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := info.Mode().Perm(); got != 0o644 {
+			t.Errorf("got mode %v want %v", got, os.FileMode(0o644))
+		}
+	})
+
+	t.Run("leaves no temp files behind", func(t *testing.T) {
+		matches, _ := filepath.Glob(file.Name() + tempPattern)
+
+		if len(matches) != 0 {
+			t.Errorf("expected no temp files but found %v", matches)
+		}
+	})
+}
@@ -10,19 +10,40 @@ type StubPlayerStore struct {
 }
 
 // GetPlayerScore returns a score from Scores.
-func (s *StubPlayerStore) GetPlayerScore(name string) int {
+func (s *StubPlayerStore) GetPlayerScore(name string) (int, error) {
 	score := s.Scores[name]
-	return score
+	return score, nil
 }
 
 // RecordWin will record a win to WinCalls.
-func (s *StubPlayerStore) RecordWin(name string) {
+func (s *StubPlayerStore) RecordWin(name string) error {
 	s.WinCalls = append(s.WinCalls, name)
+	return nil
 }
 
 // GetLeague returns League.
-func (s *StubPlayerStore) GetLeague() League {
-	return s.League
+func (s *StubPlayerStore) GetLeague() (League, error) {
+	return s.League, nil
+}
+
+// FailingPlayerStore implements PlayerStore, failing every call with Err.
+type FailingPlayerStore struct {
+	Err error
+}
+
+// GetPlayerScore returns Err.
+func (f *FailingPlayerStore) GetPlayerScore(name string) (int, error) {
+	return 0, f.Err
+}
+
+// RecordWin returns Err.
+func (f *FailingPlayerStore) RecordWin(name string) error {
+	return f.Err
+}
+
+// GetLeague returns Err.
+func (f *FailingPlayerStore) GetLeague() (League, error) {
+	return nil, f.Err
 }
 
 // AssertPlayerWin allows you to spy on the store's calls to RecordWin.
@@ -0,0 +1,99 @@
+package poker
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BlindAlerter schedules alerts for blind amounts, returning a func to cancel the alert.
+type BlindAlerter interface {
+	ScheduleAlertAt(duration time.Duration, amount int, to io.Writer) (cancel func())
+}
+
+// BlindAlerterFunc allows you to implement BlindAlerter with a function.
+type BlindAlerterFunc func(duration time.Duration, amount int, to io.Writer) func()
+
+// ScheduleAlertAt is BlindAlerterFunc implementation of BlindAlerter.
+func (a BlindAlerterFunc) ScheduleAlertAt(duration time.Duration, amount int, to io.Writer) func() {
+	return a(duration, amount, to)
+}
+
+// Alerter will schedule alerts and print them to "to".
+func Alerter(duration time.Duration, amount int, to io.Writer) func() {
+	timer := time.AfterFunc(duration, func() {
+		fmt.Fprintf(to, "Blind is now %d\n", amount)
+	})
+
+	return func() { timer.Stop() }
+}
+
+// LiveGame manages the state of a game of poker in progress, unlike a Game
+// which is the result of one that has finished.
+type LiveGame interface {
+	Start(numberOfPlayers int, alertsDestination io.Writer) error
+	Finish(winner string) error
+}
+
+// blinds are the amounts the blind goes up through during a game.
+var blinds = []int{100, 200, 300, 400, 500, 600, 800, 1000, 2000, 4000, 8000}
+
+// TexasHoldem manages a game of poker, raising the blinds as it goes on.
+type TexasHoldem struct {
+	alerter BlindAlerter
+	store   PlayerStore
+
+	lock    sync.Mutex
+	cancels []func()
+}
+
+// NewTexasHoldem returns a new game recording its winner in store.
+func NewTexasHoldem(alerter BlindAlerter, store PlayerStore) *TexasHoldem {
+	return &TexasHoldem{alerter: alerter, store: store}
+}
+
+// Start schedules the blind alerts of a game with numberOfPlayers. The more
+// players there are, the longer each blind level lasts.
+func (g *TexasHoldem) Start(numberOfPlayers int, alertsDestination io.Writer) error {
+	if numberOfPlayers < 2 {
+		return StatusError{http.StatusBadRequest, fmt.Errorf("a game needs at least 2 players, got %d", numberOfPlayers)}
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	blindIncrement := time.Duration(5+numberOfPlayers) * time.Minute
+	blindTime := 0 * time.Second
+
+	for _, blind := range blinds {
+		g.cancels = append(g.cancels, g.alerter.ScheduleAlertAt(blindTime, blind, alertsDestination))
+		blindTime += blindIncrement
+	}
+
+	return nil
+}
+
+// Finish stops the blind alerts and records the winner.
+func (g *TexasHoldem) Finish(winner string) error {
+	if err := g.store.RecordWin(winner); err != nil {
+		return err
+	}
+
+	g.Abandon()
+
+	return nil
+}
+
+// Abandon stops the blind alerts of a game that will never finish.
+func (g *TexasHoldem) Abandon() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, cancel := range g.cancels {
+		cancel()
+	}
+
+	g.cancels = nil
+}
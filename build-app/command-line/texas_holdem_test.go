@@ -0,0 +1,179 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type scheduledAlert struct {
+	at     time.Duration
+	amount int
+}
+
+func (s scheduledAlert) String() string {
+	return fmt.Sprintf("%d chips at %v", s.amount, s.at)
+}
+
+type SpyBlindAlerter struct {
+	alerts    []scheduledAlert
+	cancelled int
+}
+
+func (s *SpyBlindAlerter) ScheduleAlertAt(at time.Duration, amount int, to io.Writer) func() {
+	s.alerts = append(s.alerts, scheduledAlert{at, amount})
+	return func() { s.cancelled++ }
+}
+
+// instantAlerter announces the first blind straight away and ignores the rest.
+var instantAlerter = BlindAlerterFunc(func(at time.Duration, amount int, to io.Writer) func() {
+	if at == 0 {
+		fmt.Fprintf(to, "Blind is now %d\n", amount)
+	}
+	return func() {}
+})
+
+func TestTexasHoldem(t *testing.T) {
+
+	t.Run("schedules the blinds, more slowly with more players", func(t *testing.T) {
+		alerter := &SpyBlindAlerter{}
+		game := NewTexasHoldem(alerter, &StubPlayerStore{})
+
+		assertNoError(t, game.Start(5, io.Discard))
+
+		want := []scheduledAlert{
+			{0 * time.Minute, 100},
+			{10 * time.Minute, 200},
+			{20 * time.Minute, 300},
+			{30 * time.Minute, 400},
+		}
+
+		for i, alert := range want {
+			if alerter.alerts[i] != alert {
+				t.Errorf("alert %d: got %v want %v", i, alerter.alerts[i], alert)
+			}
+		}
+
+		if len(alerter.alerts) != len(blinds) {
+			t.Errorf("got %d alerts want %d", len(alerter.alerts), len(blinds))
+		}
+	})
+
+	t.Run("finishing records the winner and stops the alerts", func(t *testing.T) {
+		alerter := &SpyBlindAlerter{}
+		store := &StubPlayerStore{}
+		game := NewTexasHoldem(alerter, store)
+
+		game.Start(3, io.Discard)
+		assertNoError(t, game.Finish("Ruth"))
+
+		AssertPlayerWin(t, store, "Ruth")
+
+		if alerter.cancelled != len(blinds) {
+			t.Errorf("got %d alerts cancelled want %d", alerter.cancelled, len(blinds))
+		}
+	})
+
+	t.Run("a game needs two players", func(t *testing.T) {
+		game := NewTexasHoldem(&SpyBlindAlerter{}, &StubPlayerStore{})
+
+		assertStatus(t, statusFor(game.Start(1, io.Discard)), http.StatusBadRequest)
+	})
+}
+
+func assertWebSocketMessage(t *testing.T, ws *WebSocket, want string) {
+	t.Helper()
+
+	got, err := ws.ReadMessage()
+	assertNoError(t, err)
+
+	if string(got) != want {
+		t.Errorf("got message %q want %q", got, want)
+	}
+}
+
+func TestGameOverWebSocket(t *testing.T) {
+
+	t.Run("plays a game from the player count to the winner", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := httptest.NewServer(NewPlayerServer(store, WithBlindAlerter(instantAlerter)))
+		t.Cleanup(server.Close)
+
+		ws := dialTestWebSocket(t, server.URL+"/ws")
+
+		assertWebSocketMessage(t, ws, PlayerPrompt)
+
+		ws.WriteMessage([]byte("lots"))
+		assertWebSocketMessage(t, ws, BadPlayerInputMessage)
+
+		ws.WriteMessage([]byte("3"))
+		assertWebSocketMessage(t, ws, "Blind is now 100")
+		assertWebSocketMessage(t, ws, WinnerPrompt)
+
+		ws.WriteMessage([]byte(" wins"))
+		assertWebSocketMessage(t, ws, BadWinnerInputMessage)
+
+		ws.WriteMessage([]byte("Ruth wins"))
+		assertWebSocketMessage(t, ws, "Ruth wins, game over")
+
+		var closeErr WebSocketCloseError
+		if _, err := ws.ReadMessage(); !errors.As(err, &closeErr) || closeErr.Code != wsCloseNormal {
+			t.Errorf("got %v want a normal close", err)
+		}
+
+		assertPlayerScore(t, store, "Ruth", 1)
+	})
+
+	t.Run("records the winner as the API does", func(t *testing.T) {
+		store := createSeasonStore(t)
+		server := httptest.NewServer(NewPlayerServer(store, WithBlindAlerter(instantAlerter), WithWinInterval(time.Minute)))
+		t.Cleanup(server.Close)
+
+		ws := dialTestWebSocket(t, server.URL+"/ws")
+
+		assertWebSocketMessage(t, ws, PlayerPrompt)
+		ws.WriteMessage([]byte("2"))
+		assertWebSocketMessage(t, ws, "Blind is now 100")
+		assertWebSocketMessage(t, ws, WinnerPrompt)
+
+		ws.WriteMessage([]byte("Chris  van Dam wins"))
+		assertWebSocketMessage(t, ws, "Chris  van Dam wins, game over")
+		assertPlayerScore(t, store, "Chris van Dam", 1)
+
+		ws = dialTestWebSocket(t, server.URL+"/ws")
+
+		assertWebSocketMessage(t, ws, PlayerPrompt)
+		ws.WriteMessage([]byte("2"))
+		assertWebSocketMessage(t, ws, "Blind is now 100")
+		assertWebSocketMessage(t, ws, WinnerPrompt)
+
+		ws.WriteMessage([]byte("Chris van Dam wins"))
+
+		got, err := ws.ReadMessage()
+		assertNoError(t, err)
+
+		if !strings.HasPrefix(string(got), BadWinnerInputMessage) {
+			t.Errorf("got message %q want the win refused", got)
+		}
+		assertPlayerScore(t, store, "Chris van Dam", 1)
+	})
+
+	t.Run("needs a token that can record wins", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, reader, _ := tokens.Issue("dashboard", RoleRead)
+
+		server := httptest.NewServer(NewPlayerServer(createSeasonStore(t), WithAuth(tokens, RoleRead)))
+		t.Cleanup(server.Close)
+
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+		_, err := DialWebSocket(url, http.Header{"Authorization": {"Bearer " + reader}})
+
+		assertStatus(t, statusFor(err), http.StatusForbidden)
+	})
+}
@@ -0,0 +1,209 @@
+package poker
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates static
+var webFiles embed.FS
+
+var webFuncs = template.FuncMap{
+	"inc":        func(i int) int { return i + 1 },
+	"profileURL": profileURL,
+	"percent":    func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	"join":       strings.Join,
+}
+
+// webPages are the HTML pages, each rendered inside templates/layout.gohtml.
+var webPages = map[string]*template.Template{
+	"leaderboard": parsePage("leaderboard.gohtml"),
+	"player":      parsePage("player.gohtml"),
+	"login":       parsePage("login.gohtml"),
+	"denied":      parsePage("denied.gohtml"),
+}
+
+func parsePage(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(webFuncs).ParseFS(webFiles, "templates/layout.gohtml", "templates/"+name))
+}
+
+func profileURL(name string) string {
+	return "/players/" + url.PathEscape(name) + "/profile"
+}
+
+// page holds the messages shown at the top of every page, and what its forms
+// and header need to know about the visitor.
+type page struct {
+	Error  string
+	Notice string
+	// CSRF goes in every form, to be checked against the visitor's cookie.
+	CSRF string
+	// Sessions is set when the server takes tokens, to offer signing in and out.
+	Sessions bool
+	// User is the name of the token the visitor signed in with.
+	User string
+}
+
+type leaderboardPage struct {
+	page
+	League League
+	// Name is put back in the form when a win could not be recorded.
+	Name string
+}
+
+type opponent struct {
+	Name string
+	HeadToHead
+}
+
+type playerPage struct {
+	page
+	Player    Player
+	Stats     *PlayerStats
+	Opponents []opponent
+	Games     []Game
+}
+
+// recentGames is how many games are listed on a player's page.
+const recentGames = 10
+
+// renderPage renders a page in full before sending it, so a template error is
+// a clean 500, logged rather than shown.
+func renderPage(w http.ResponseWriter, status int, name string, data any) {
+	var body bytes.Buffer
+
+	if err := webPages[name].ExecuteTemplate(&body, "layout", data); err != nil {
+		slog.Error("problem rendering page", slog.String("page", name), slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	body.WriteTo(w)
+}
+
+// homeHandler shows the leaderboard, with a form to record a win.
+func (p *PlayerServer) homeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	data := leaderboardPage{}
+	data.Notice = takeFlash(w, r)
+
+	p.renderLeaderboard(w, r, http.StatusOK, data)
+}
+
+func (p *PlayerServer) renderLeaderboard(w http.ResponseWriter, r *http.Request, status int, data leaderboardPage) {
+	data.page = p.pageFor(w, r, data.page)
+	league, err := DefaultStandings(p.store)
+
+	if err != nil {
+		data.Error = errorMessage(err)
+		status = statusFor(err)
+	}
+
+	data.League = league
+	renderPage(w, status, "leaderboard", data)
+}
+
+// winFormHandler records a win from the leaderboard form, then redirects back
+// to the leaderboard so refreshing the page doesn't record it again.
+func (p *PlayerServer) winFormHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+
+	if !checkCSRF(r) {
+		p.renderLeaderboard(w, r, http.StatusForbidden, leaderboardPage{page: page{Error: formExpired}, Name: name})
+		return
+	}
+
+	if name == "" {
+		p.renderLeaderboard(w, r, http.StatusBadRequest, leaderboardPage{page: page{Error: "Enter the name of the winner."}})
+		return
+	}
+
+	if err := p.recordWin(name); err != nil {
+		var tooSoon WinTooSoonError
+
+		if errors.As(err, &tooSoon) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooSoon.Wait.Seconds()))))
+		}
+
+		p.renderLeaderboard(w, r, statusFor(err), leaderboardPage{page: page{Error: fmt.Sprintf("Could not record a win for %s: %s", name, errorMessage(err))}, Name: name})
+		return
+	}
+
+	setFlash(w, r, fmt.Sprintf("Recorded a win for %s.", name))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// playerPageHandler shows a player's wins, and their statistics and recent games when the store keeps them.
+func (p *PlayerServer) playerPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	name := r.PathValue("name")
+	data := playerPage{page: p.pageFor(w, r, page{}), Player: Player{Name: name}}
+
+	wins, err := p.store.GetPlayerScore(name)
+
+	if err != nil {
+		p.renderLeaderboard(w, r, statusFor(err), leaderboardPage{page: page{Error: errorMessage(err)}})
+		return
+	}
+
+	data.Player.Wins = wins
+
+	if stats, ok := p.store.(StatsStore); ok {
+		if playerStats, err := stats.GetPlayerStats(name); err == nil {
+			data.Stats = &playerStats
+
+			for opponentName, record := range playerStats.HeadToHead {
+				data.Opponents = append(data.Opponents, opponent{opponentName, record})
+			}
+
+			sort.Slice(data.Opponents, func(i, j int) bool { return data.Opponents[i].Name < data.Opponents[j].Name })
+		}
+	}
+
+	if games, ok := p.store.(GameStore); ok {
+		if history, err := games.GetGames(GameFilter{Player: name}); err == nil {
+			for i := len(history) - 1; i >= 0 && len(data.Games) < recentGames; i-- {
+				data.Games = append(data.Games, history[i])
+			}
+		}
+	}
+
+	if wins == 0 && data.Stats == nil {
+		p.renderLeaderboard(w, r, http.StatusNotFound, leaderboardPage{page: page{Error: fmt.Sprintf("No player called %s has played yet.", name)}})
+		return
+	}
+
+	renderPage(w, http.StatusOK, "player", data)
+}
+
+// staticHandler serves the embedded stylesheet and script.
+func staticHandler() http.Handler {
+	static, _ := fs.Sub(webFiles, "static")
+	return http.StripPrefix("/static/", http.FileServerFS(static))
+}
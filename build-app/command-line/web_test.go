@@ -0,0 +1,326 @@
+package poker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCSRF is the CSRF token forms are posted with, in both the cookie and the form.
+const testCSRF = "f00d"
+
+func newFormRequest(path string, form url.Values) *http.Request {
+	form.Set(csrfField, testCSRF)
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "text/html")
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRF})
+	return req
+}
+
+func newWinFormRequest(name string) *http.Request {
+	return newFormRequest("/win", url.Values{"name": {name}})
+}
+
+// followRedirect gets the page response redirected to, with the cookies it set.
+func followRedirect(server http.Handler, response *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	request := newGetRequest(response.Header().Get("Location"))
+
+	for _, cookie := range response.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+
+	next := httptest.NewRecorder()
+	server.ServeHTTP(next, request)
+	return next
+}
+
+func findCookie(response *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func assertBodyContains(t *testing.T, body, want string) {
+	t.Helper()
+	if !strings.Contains(body, want) {
+		t.Errorf("body did not contain %q, got %s", want, body)
+	}
+}
+
+func TestLeaderboardPage(t *testing.T) {
+
+	t.Run("lists the league with links to each player", func(t *testing.T) {
+		store := &StubPlayerStore{League: []Player{{"Cleo", 32}, {"Chris & Co", 20}}}
+		server := NewPlayerServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest("/"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, "text/html; charset=utf-8")
+		assertBodyContains(t, response.Body.String(), `<a href="/players/Cleo/profile">Cleo</a></td><td>32</td>`)
+		assertBodyContains(t, response.Body.String(), `<a href="/players/Chris%20&amp;%20Co/profile">Chris &amp; Co</a>`)
+	})
+
+	t.Run("shows only the status of a server error", func(t *testing.T) {
+		store := &FailingPlayerStore{Err: errors.New("open /srv/game.db.json: permission denied")}
+
+		for _, path := range []string{"/", "/players/Cleo/profile"} {
+			response := httptest.NewRecorder()
+			NewPlayerServer(store).ServeHTTP(response, newGetRequest(path))
+
+			assertStatus(t, response.Code, http.StatusInternalServerError)
+			assertBodyContains(t, response.Body.String(), http.StatusText(http.StatusInternalServerError))
+
+			if strings.Contains(response.Body.String(), "/srv") {
+				t.Errorf("%s: expected the error to be hidden, got %s", path, response.Body)
+			}
+		}
+	})
+
+	t.Run("serves the stylesheet and script", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{})
+
+		for _, path := range []string{"/static/style.css", "/static/leaderboard.js"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest(path))
+
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("does not serve unknown paths", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(&StubPlayerStore{}).ServeHTTP(response, newGetRequest("/nowhere"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestWinForm(t *testing.T) {
+
+	t.Run("records the win and redirects to the leaderboard", func(t *testing.T) {
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		server := NewPlayerServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newWinFormRequest(" Pepper "))
+
+		assertStatus(t, response.Code, http.StatusSeeOther)
+		AssertPlayerWin(t, store, "Pepper")
+
+		response = followRedirect(server, response)
+
+		assertBodyContains(t, response.Body.String(), "Recorded a win for Pepper.")
+
+		if flash := findCookie(response, flashCookie); flash == nil || flash.MaxAge >= 0 {
+			t.Errorf("expected the notice to be cleared once shown, got %v", flash)
+		}
+	})
+
+	t.Run("doesn't take notices from the address", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(&StubPlayerStore{}).ServeHTTP(response, newGetRequest("/?won=Mallory"))
+
+		if strings.Contains(response.Body.String(), "Mallory") {
+			t.Errorf("expected no notice, got %s", response.Body)
+		}
+	})
+
+	t.Run("turns away a form without the visitor's CSRF token", func(t *testing.T) {
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		request := newWinFormRequest("Pepper")
+		request.Header.Del("Cookie")
+		request.AddCookie(&http.Cookie{Name: csrfCookie, Value: "other"})
+
+		response := httptest.NewRecorder()
+		NewPlayerServer(store).ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+		assertBodyContains(t, response.Body.String(), formExpired)
+
+		if len(store.WinCalls) != 0 {
+			t.Errorf("got %d win calls want 0", len(store.WinCalls))
+		}
+	})
+
+	t.Run("puts the visitor's CSRF token in the form", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(&StubPlayerStore{}).ServeHTTP(response, newGetRequest("/"))
+
+		cookie := findCookie(response, csrfCookie)
+
+		if cookie == nil || !cookie.HttpOnly {
+			t.Fatalf("expected an http only CSRF cookie, got %v", cookie)
+		}
+
+		assertBodyContains(t, response.Body.String(), `name="csrf" value="`+cookie.Value+`"`)
+	})
+
+	t.Run("shows the form again without a name", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		response := httptest.NewRecorder()
+		NewPlayerServer(store).ServeHTTP(response, newWinFormRequest("  "))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertContentType(t, response, "text/html; charset=utf-8")
+		assertBodyContains(t, response.Body.String(), "Enter the name of the winner.")
+
+		if len(store.WinCalls) != 0 {
+			t.Errorf("got %d win calls want 0", len(store.WinCalls))
+		}
+	})
+
+	t.Run("is limited like the API", func(t *testing.T) {
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		server := NewPlayerServer(store, WithWinInterval(time.Minute))
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Pepper"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newWinFormRequest("Pepper"))
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertBodyContains(t, response.Body.String(), `value="Pepper"`)
+
+		if response.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("needs the record role, shown as a page", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(&StubPlayerStore{}, WithAuth(createTokenStore(t), RoleRead)).ServeHTTP(response, newWinFormRequest("Pepper"))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertContentType(t, response, "text/html; charset=utf-8")
+		assertBodyContains(t, response.Body.String(), `<a href="/login">Sign in</a>`)
+	})
+
+	t.Run("records wins once signed in", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, recorder, _ := tokens.Issue("table", RoleRecord)
+
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		server := NewPlayerServer(store, WithAuth(tokens, RoleRead))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFormRequest("/login", url.Values{"token": {recorder}}))
+		assertStatus(t, response.Code, http.StatusSeeOther)
+
+		session := findCookie(response, sessionCookie)
+
+		if session == nil || !session.HttpOnly {
+			t.Fatalf("expected an http only session cookie, got %v", session)
+		}
+
+		assertBodyContains(t, followRedirect(server, response).Body.String(), "Signed in as table.")
+
+		request := newWinFormRequest("Pepper")
+		request.AddCookie(session)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusSeeOther)
+		AssertPlayerWin(t, store, "Pepper")
+	})
+
+	t.Run("only takes the session for reads and forms", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, recorder, _ := tokens.Issue("table", RoleRecord)
+
+		store := &StubPlayerStore{Scores: map[string]int{}}
+		request := newPostWinRequest("Pepper")
+		request.AddCookie(&http.Cookie{Name: sessionCookie, Value: recorder})
+
+		response := httptest.NewRecorder()
+		NewPlayerServer(store, WithAuth(tokens, RoleRead)).ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("refuses to sign in with a bad token", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(&StubPlayerStore{}, WithAuth(createTokenStore(t), RoleRead)).ServeHTTP(response, newFormRequest("/login", url.Values{"token": {"nope"}}))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertBodyContains(t, response.Body.String(), "That token is not valid.")
+
+		if findCookie(response, sessionCookie) != nil {
+			t.Error("expected no session")
+		}
+	})
+}
+
+func TestPlayerPage(t *testing.T) {
+
+	t.Run("shows stats, head to head and recent games", func(t *testing.T) {
+		store := createSeasonStore(t)
+		store.RecordGame(Game{Players: []string{"Cleo", "Chris"}, Winner: "Cleo"})
+		store.RecordGame(Game{Players: []string{"Cleo", "Chris"}, Winner: "Chris"})
+		store.RecordGame(Game{Players: []string{"Cleo", "Chris"}, Winner: "Cleo"})
+
+		response := httptest.NewRecorder()
+		NewPlayerServer(store).ServeHTTP(response, newGetRequest("/players/Cleo/profile"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		body := response.Body.String()
+		assertBodyContains(t, body, "<dt>Wins</dt><dd>2</dd>")
+		assertBodyContains(t, body, "<dt>Win rate</dt><dd>67%</dd>")
+		assertBodyContains(t, body, `<a href="/players/Chris/profile">Chris</a></td><td>2</td><td>1</td>`)
+		assertBodyContains(t, body, "<td>Cleo, Chris</td><td>Cleo</td>")
+	})
+
+	t.Run("records a win from the player's form once signed in", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, recorder, _ := tokens.Issue("table", RoleRecord)
+
+		store := createSeasonStore(t)
+		store.RecordWin("Cleo")
+		server := NewPlayerServer(store, WithAuth(tokens, RoleRead))
+		session := &http.Cookie{Name: sessionCookie, Value: recorder}
+
+		request := newGetRequest("/players/Cleo/profile")
+		request.AddCookie(session)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		csrf := findCookie(response, csrfCookie)
+
+		if csrf == nil {
+			t.Fatal("expected a CSRF cookie")
+		}
+
+		assertBodyContains(t, response.Body.String(), `name="csrf" value="`+csrf.Value+`"`)
+
+		form := url.Values{"name": {"Cleo"}, csrfField: {csrf.Value}}
+		request, _ = http.NewRequest(http.MethodPost, "/win", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(session)
+		request.AddCookie(csrf)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusSeeOther)
+		assertPlayerScore(t, store, "Cleo", 2)
+	})
+
+	t.Run("returns 404 for a player who has never played", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(createSeasonStore(t)).ServeHTTP(response, newGetRequest("/players/Nobody/profile"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		assertBodyContains(t, response.Body.String(), "No player called Nobody has played yet.")
+	})
+}
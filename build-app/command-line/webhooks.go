@@ -0,0 +1,818 @@
+package poker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EventWinRecorded is sent for every game, or plain win, recorded.
+	EventWinRecorded = "win.recorded"
+	// EventLeaderChanged is sent when a different player tops the standings
+	// shown on /league. Drawing level with the leader isn't enough.
+	EventLeaderChanged = "leader.changed"
+	// EventSeasonClosed is sent when a season is closed, with its final standings.
+	EventSeasonClosed = "season.closed"
+
+	// DeliveryPending is a delivery waiting for its next attempt.
+	DeliveryPending = "pending"
+	// DeliveryDelivered is a delivery the receiver accepted with a 2xx status.
+	DeliveryDelivered = "delivered"
+	// DeliveryDead is a delivery given up on after its last attempt failed.
+	DeliveryDead = "dead"
+
+	// DefaultWebhookBackoff is how long a failed delivery waits before its first retry, doubling after each.
+	DefaultWebhookBackoff = 10 * time.Second
+	// DefaultWebhookAttempts is how many times a delivery is tried before it is dead-lettered.
+	DefaultWebhookAttempts = 8
+
+	// SignatureHeader carries the HMAC-SHA256 of the body, keyed with the
+	// subscription's secret, as sha256=<hex>.
+	SignatureHeader = "X-Poker-Signature"
+
+	// webhookTimeout is how long a receiver has to answer a delivery.
+	webhookTimeout = 10 * time.Second
+	// maxWebhookBackoff caps the wait between two attempts.
+	maxWebhookBackoff = time.Hour
+	// maxDeliveredKept is how many delivered deliveries are kept to look at.
+	// Pending ones are kept until they are delivered or dead.
+	maxDeliveredKept = 200
+	// maxDeadKept is how many dead deliveries are kept to look at and redeliver.
+	maxDeadKept = 1000
+	// maxQueuedChanges is how many changes to the store can wait for Run
+	// before more are dropped.
+	maxQueuedChanges = 1024
+)
+
+// WebhookEvents lists every event that can be subscribed to.
+var WebhookEvents = []string{EventWinRecorded, EventLeaderChanged, EventSeasonClosed}
+
+// WebhookSubscription sends the events listed to URL.
+type WebhookSubscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret keys the signature of every delivery. It is only shown when the
+	// subscription is created.
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// WebhookPayload is the JSON body sent to a subscriber.
+type WebhookPayload struct {
+	Delivery string    `json:"delivery"`
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Data     any       `json:"data"`
+}
+
+// WinRecorded is the data of EventWinRecorded.
+type WinRecorded struct {
+	Game Game `json:"game"`
+	// Wins is the winner's wins, counting this one.
+	Wins int `json:"wins"`
+}
+
+// LeaderChanged is the data of EventLeaderChanged.
+type LeaderChanged struct {
+	Leader Player `json:"leader"`
+	// Previous is who led before, empty if nobody had won yet.
+	Previous string `json:"previous,omitempty"`
+}
+
+// SeasonClosed is the data of EventSeasonClosed.
+type SeasonClosed struct {
+	Season Season `json:"season"`
+}
+
+// DeliveryAttempt is one try at sending a delivery.
+type DeliveryAttempt struct {
+	Time time.Time `json:"time"`
+	// Status is the receiver's response status, zero if it couldn't be reached.
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// WebhookDelivery is an event queued for one subscription, along with every attempt at sending it.
+type WebhookDelivery struct {
+	ID           string            `json:"id"`
+	Subscription string            `json:"subscription"`
+	Event        string            `json:"event"`
+	Payload      json.RawMessage   `json:"payload"`
+	State        string            `json:"state"`
+	Created      time.Time         `json:"created"`
+	NextAttempt  *time.Time        `json:"next_attempt,omitempty"`
+	Attempts     []DeliveryAttempt `json:"attempts"`
+}
+
+// webhookState is what Webhooks keeps in its file.
+type webhookState struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions"`
+	Deliveries    []WebhookDelivery     `json:"deliveries"`
+}
+
+// watchedChange is a change to a store, waiting to be turned into events.
+type watchedChange struct {
+	store  PlayerStore
+	change Change
+}
+
+// Webhooks sends events to the URLs subscribed to them. Deliveries are queued
+// in a JSON file, so those not yet made survive a restart, and retried with
+// exponential backoff until they succeed or run out of attempts.
+type Webhooks struct {
+	path   string
+	lock   sync.Mutex
+	state  webhookState
+	leader string
+	// changes wait here for Run, so the writes making them don't wait on the
+	// events they lead to. dropped counts those that didn't fit.
+	changes []watchedChange
+	dropped int
+	client  *http.Client
+	wake    chan struct{}
+	now     func() time.Time
+
+	// Backoff is how long a failed delivery waits before its first retry, doubling after each.
+	Backoff time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered.
+	MaxAttempts int
+}
+
+// NewWebhooks loads the subscriptions and queue kept in the file at path, which is created when first needed.
+func NewWebhooks(path string) (*Webhooks, error) {
+	webhooks := &Webhooks{
+		path:        path,
+		state:       webhookState{Subscriptions: []WebhookSubscription{}, Deliveries: []WebhookDelivery{}},
+		client:      &http.Client{Timeout: webhookTimeout},
+		wake:        make(chan struct{}, 1),
+		now:         time.Now,
+		Backoff:     DefaultWebhookBackoff,
+		MaxAttempts: DefaultWebhookAttempts,
+	}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return webhooks, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s, %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, &webhooks.state); err != nil {
+		return nil, fmt.Errorf("problem parsing webhooks from file %s, %v", path, err)
+	}
+
+	return webhooks, nil
+}
+
+// WithWebhooks sends webhooks for the changes made to the store, and enables
+// the /admin/webhooks endpoints to manage them. Deliveries are only made while
+// webhooks.Run is running.
+func WithWebhooks(webhooks *Webhooks) ServerOption {
+	return func(p *PlayerServer) {
+		p.webhooks = webhooks
+	}
+}
+
+// SignWebhook returns the SignatureHeader value of body for secret.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is the SignatureHeader value of body for secret.
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+// update applies change to a copy of the state and writes it back, keeping
+// the change only once it is saved.
+func (wh *Webhooks) update(change func(state *webhookState) error) error {
+	wh.lock.Lock()
+	defer wh.lock.Unlock()
+
+	state := webhookState{
+		Subscriptions: slices.Clone(wh.state.Subscriptions),
+		Deliveries:    slices.Clone(wh.state.Deliveries),
+	}
+
+	if err := change(&state); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(wh.path, data); err != nil {
+		return err
+	}
+
+	wh.state = state
+
+	return nil
+}
+
+// Subscribe sends the events listed to rawURL, signing them with secret, or
+// with a random one when it is empty.
+func (wh *Webhooks) Subscribe(rawURL string, events []string, secret string) (WebhookSubscription, error) {
+	parsed, err := url.Parse(rawURL)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return WebhookSubscription{}, StatusError{http.StatusBadRequest, fmt.Errorf("webhook URL must be http:// or https:// with a host, got %q", rawURL)}
+	}
+
+	if len(events) == 0 {
+		return WebhookSubscription{}, StatusError{http.StatusBadRequest, fmt.Errorf("subscribe to at least one of %s", strings.Join(WebhookEvents, ", "))}
+	}
+
+	for _, event := range events {
+		if !slices.Contains(WebhookEvents, event) {
+			return WebhookSubscription{}, StatusError{http.StatusBadRequest, fmt.Errorf("unknown event %q, use %s", event, strings.Join(WebhookEvents, ", "))}
+		}
+	}
+
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			return WebhookSubscription{}, err
+		}
+	}
+
+	id, err := randomHex(8)
+
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	subscription := WebhookSubscription{ID: id, URL: rawURL, Events: slices.Compact(slices.Sorted(slices.Values(events))), Secret: secret, Created: wh.now().UTC()}
+
+	err = wh.update(func(state *webhookState) error {
+		state.Subscriptions = append(state.Subscriptions, subscription)
+		return nil
+	})
+
+	return subscription, err
+}
+
+// Unsubscribe stops sending events to a subscription, dropping its pending
+// deliveries. Those already made or dead are kept to look at.
+func (wh *Webhooks) Unsubscribe(id string) error {
+	return wh.update(func(state *webhookState) error {
+		i := slices.IndexFunc(state.Subscriptions, func(s WebhookSubscription) bool { return s.ID == id })
+
+		if i < 0 {
+			return StatusError{http.StatusNotFound, fmt.Errorf("no webhook subscription %q", id)}
+		}
+
+		state.Subscriptions = slices.Delete(state.Subscriptions, i, i+1)
+		state.Deliveries = slices.DeleteFunc(state.Deliveries, func(d WebhookDelivery) bool {
+			return d.Subscription == id && d.State == DeliveryPending
+		})
+
+		return nil
+	})
+}
+
+// Subscriptions lists every subscription, without its secret.
+func (wh *Webhooks) Subscriptions() []WebhookSubscription {
+	wh.lock.Lock()
+	defer wh.lock.Unlock()
+
+	subscriptions := slices.Clone(wh.state.Subscriptions)
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	return subscriptions
+}
+
+// Deliveries lists the deliveries kept, oldest first, to the subscription
+// with the given ID and in the given state, when they aren't empty.
+func (wh *Webhooks) Deliveries(subscription, state string) []WebhookDelivery {
+	wh.lock.Lock()
+	defer wh.lock.Unlock()
+
+	deliveries := []WebhookDelivery{}
+
+	for _, delivery := range wh.state.Deliveries {
+		if (subscription == "" || delivery.Subscription == subscription) && (state == "" || delivery.State == state) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries
+}
+
+// Publish queues event, with data, for every subscription to it.
+func (wh *Webhooks) Publish(event string, data any) error {
+	wh.lock.Lock()
+	subscribed := slices.ContainsFunc(wh.state.Subscriptions, func(s WebhookSubscription) bool {
+		return slices.Contains(s.Events, event)
+	})
+	wh.lock.Unlock()
+
+	if !subscribed {
+		return nil
+	}
+
+	now := wh.now().UTC()
+
+	err := wh.update(func(state *webhookState) error {
+		for _, subscription := range state.Subscriptions {
+			if !slices.Contains(subscription.Events, event) {
+				continue
+			}
+
+			id, err := randomHex(8)
+
+			if err != nil {
+				return err
+			}
+
+			payload, err := json.Marshal(WebhookPayload{Delivery: id, Event: event, Time: now, Data: data})
+
+			if err != nil {
+				return err
+			}
+
+			state.Deliveries = append(state.Deliveries, WebhookDelivery{
+				ID:           id,
+				Subscription: subscription.ID,
+				Event:        event,
+				Payload:      payload,
+				State:        DeliveryPending,
+				Created:      now,
+				NextAttempt:  &now,
+				Attempts:     []DeliveryAttempt{},
+			})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case wh.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Redeliver tries a dead delivery once more, straight away, returning how it went.
+func (wh *Webhooks) Redeliver(id string) (WebhookDelivery, error) {
+	wh.lock.Lock()
+	i := slices.IndexFunc(wh.state.Deliveries, func(d WebhookDelivery) bool { return d.ID == id })
+	var err error
+
+	switch {
+	case i < 0:
+		err = StatusError{http.StatusNotFound, fmt.Errorf("no webhook delivery %q", id)}
+	case wh.state.Deliveries[i].State != DeliveryDead:
+		err = StatusError{http.StatusConflict, fmt.Errorf("delivery %s is %s, only dead ones can be redelivered", id, wh.state.Deliveries[i].State)}
+	case !slices.ContainsFunc(wh.state.Subscriptions, func(s WebhookSubscription) bool { return s.ID == wh.state.Deliveries[i].Subscription }):
+		err = StatusError{http.StatusConflict, fmt.Errorf("the subscription of delivery %s was deleted", id)}
+	}
+	wh.lock.Unlock()
+
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	return wh.attempt(id, true)
+}
+
+// Run turns the changes made to the store into events and makes deliveries
+// as they fall due until ctx is done. Deliveries still queued are picked up by
+// the next Run, after a restart too. Errors are passed to logf, as a failed
+// webhook shouldn't stop the server.
+func (wh *Webhooks) Run(ctx context.Context, logf func(format string, args ...any)) {
+	for {
+		next, ok := wh.process(logf)
+
+		var due <-chan time.Time
+
+		var timer *time.Timer
+
+		if ok {
+			timer = time.NewTimer(next.Sub(wh.now()))
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-wh.wake:
+		case <-due:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// process queues the events following from the changes waiting, then makes
+// the deliveries that are due.
+func (wh *Webhooks) process(logf func(format string, args ...any)) (next time.Time, ok bool) {
+	wh.lock.Lock()
+	changes, dropped := wh.changes, wh.dropped
+	wh.changes, wh.dropped = nil, 0
+	wh.lock.Unlock()
+
+	if dropped > 0 {
+		logf("webhooks: dropped %d changes to the store, the queue was full", dropped)
+	}
+
+	for _, watched := range changes {
+		if err := wh.changed(watched.store, watched.change); err != nil {
+			logf("webhooks: problem queueing events for a %s change, %v", watched.change.Type, err)
+		}
+	}
+
+	return wh.deliverDue(logf)
+}
+
+// deliverDue makes every pending delivery whose time has come, returning when
+// the next one falls due, with ok false when none is left. Each subscription
+// is sent its deliveries in order, alongside the others, so a slow or dead
+// receiver only holds up its own: they stop at the first that fails, and the
+// rest wait for the next round.
+func (wh *Webhooks) deliverDue(logf func(format string, args ...any)) (next time.Time, ok bool) {
+	wh.lock.Lock()
+	now := wh.now()
+
+	due := map[string][]string{}
+
+	for _, delivery := range wh.state.Deliveries {
+		if delivery.State == DeliveryPending && !delivery.NextAttempt.After(now) {
+			due[delivery.Subscription] = append(due[delivery.Subscription], delivery.ID)
+		}
+	}
+	wh.lock.Unlock()
+
+	var sending sync.WaitGroup
+
+	for _, ids := range due {
+		sending.Add(1)
+
+		go func() {
+			defer sending.Done()
+
+			for _, id := range ids {
+				delivery, err := wh.attempt(id, false)
+
+				if err != nil {
+					logf("webhooks: problem recording delivery %s, %v", id, err)
+				}
+
+				if delivery.State != DeliveryDelivered {
+					return
+				}
+			}
+		}()
+	}
+
+	sending.Wait()
+
+	wh.lock.Lock()
+	defer wh.lock.Unlock()
+
+	for _, delivery := range wh.state.Deliveries {
+		if delivery.State == DeliveryPending && (!ok || delivery.NextAttempt.Before(next)) {
+			next, ok = *delivery.NextAttempt, true
+		}
+	}
+
+	return next, ok
+}
+
+// attempt sends a delivery and records how it went: delivered on a 2xx
+// response, and otherwise retried after a backoff or, on the last attempt,
+// dead-lettered.
+func (wh *Webhooks) attempt(id string, last bool) (WebhookDelivery, error) {
+	wh.lock.Lock()
+	i := slices.IndexFunc(wh.state.Deliveries, func(d WebhookDelivery) bool { return d.ID == id })
+	var delivery WebhookDelivery
+	var subscription WebhookSubscription
+
+	if i >= 0 {
+		delivery = wh.state.Deliveries[i]
+		j := slices.IndexFunc(wh.state.Subscriptions, func(s WebhookSubscription) bool { return s.ID == delivery.Subscription })
+
+		if j >= 0 {
+			subscription = wh.state.Subscriptions[j]
+		}
+	}
+	wh.lock.Unlock()
+
+	if i < 0 || subscription.ID == "" {
+		return WebhookDelivery{}, StatusError{http.StatusNotFound, fmt.Errorf("no webhook delivery %q to make", id)}
+	}
+
+	attempt := wh.send(subscription, delivery)
+
+	err := wh.update(func(state *webhookState) error {
+		i := slices.IndexFunc(state.Deliveries, func(d WebhookDelivery) bool { return d.ID == id })
+
+		// The subscription was deleted while the delivery was being made.
+		if i < 0 {
+			return nil
+		}
+
+		delivery = state.Deliveries[i]
+		delivery.Attempts = append(slices.Clone(delivery.Attempts), attempt)
+		delivery.NextAttempt = nil
+
+		switch {
+		case attempt.Error == "":
+			delivery.State = DeliveryDelivered
+		case last || len(delivery.Attempts) >= wh.MaxAttempts:
+			delivery.State = DeliveryDead
+		default:
+			next := attempt.Time.Add(wh.backoff(len(delivery.Attempts)))
+			delivery.NextAttempt = &next
+		}
+
+		state.Deliveries[i] = delivery
+		state.Deliveries = trimDeliveries(state.Deliveries, DeliveryDelivered, maxDeliveredKept)
+		state.Deliveries = trimDeliveries(state.Deliveries, DeliveryDead, maxDeadKept)
+
+		return nil
+	})
+
+	return delivery, err
+}
+
+// backoff is how long to wait after the given number of failed attempts.
+func (wh *Webhooks) backoff(failures int) time.Duration {
+	wait := wh.Backoff
+
+	for range failures - 1 {
+		if wait *= 2; wait >= maxWebhookBackoff {
+			return maxWebhookBackoff
+		}
+	}
+
+	return wait
+}
+
+// trimDeliveries drops the oldest deliveries in state beyond the number kept.
+func trimDeliveries(deliveries []WebhookDelivery, state string, kept int) []WebhookDelivery {
+	count := 0
+
+	for _, delivery := range deliveries {
+		if delivery.State == state {
+			count++
+		}
+	}
+
+	return slices.DeleteFunc(deliveries, func(d WebhookDelivery) bool {
+		if d.State == state && count > kept {
+			count--
+			return true
+		}
+
+		return false
+	})
+}
+
+// send POSTs a delivery to its subscription's URL.
+func (wh *Webhooks) send(subscription WebhookSubscription, delivery WebhookDelivery) DeliveryAttempt {
+	start := wh.now()
+	attempt := DeliveryAttempt{Time: start.UTC()}
+
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	request.Header.Set("Content-Type", jsonContentType)
+	request.Header.Set("User-Agent", "poker-webhooks")
+	request.Header.Set("X-Poker-Event", delivery.Event)
+	request.Header.Set("X-Poker-Delivery", delivery.ID)
+	request.Header.Set(SignatureHeader, SignWebhook(subscription.Secret, delivery.Payload))
+
+	response, err := wh.client.Do(request)
+	attempt.DurationMS = wh.now().Sub(start).Milliseconds()
+
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	attempt.Status = response.StatusCode
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = "receiver responded " + response.Status
+	}
+
+	return attempt
+}
+
+// watch hands the changes notifier publishes for store to Run, which queues
+// the events that follow from them.
+func (wh *Webhooks) watch(store PlayerStore, notifier ChangeNotifier) (cancel func()) {
+	if standings, err := DefaultStandings(store); err == nil {
+		wh.leader = leaderOf(standings).Name
+	}
+
+	return notifier.OnChange(func(change Change) {
+		wh.lock.Lock()
+
+		if len(wh.changes) < maxQueuedChanges {
+			wh.changes = append(wh.changes, watchedChange{store, change})
+		} else {
+			wh.dropped++
+		}
+		wh.lock.Unlock()
+
+		select {
+		case wh.wake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// changed queues the events following from change. The leader is the one
+// on top of the standings when the change is handled, so a lead lost and won
+// back before then isn't announced.
+func (wh *Webhooks) changed(store PlayerStore, change Change) error {
+	var errs []error
+
+	if change.Type == ChangeGame && change.Game != nil {
+		errs = append(errs, wh.Publish(EventWinRecorded, WinRecorded{Game: *change.Game, Wins: change.Wins}))
+	}
+
+	if change.Type == ChangeSeason && change.Season != nil && !change.Season.Open() {
+		errs = append(errs, wh.Publish(EventSeasonClosed, SeasonClosed{Season: *change.Season}))
+	}
+
+	standings, err := DefaultStandings(store)
+
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	leader := leaderOf(standings)
+
+	wh.lock.Lock()
+	previous := wh.leader
+
+	// A player drawing level with the leader doesn't take the lead from them.
+	if current := standings.Find(previous); current != nil && current.Wins == leader.Wins {
+		leader = *current
+	}
+
+	wh.leader = leader.Name
+	wh.lock.Unlock()
+
+	if leader.Name != "" && leader.Name != previous {
+		errs = append(errs, wh.Publish(EventLeaderChanged, LeaderChanged{Leader: leader, Previous: previous}))
+	}
+
+	return errors.Join(errs...)
+}
+
+// leaderOf returns the player on top of standings, or nobody before anyone has won.
+func leaderOf(standings League) Player {
+	if len(standings) == 0 || standings[0].Wins == 0 {
+		return Player{}
+	}
+
+	return standings[0]
+}
+
+// webhooksEnabled writes a 501 and returns false when the server sends no webhooks.
+func (p *PlayerServer) webhooksEnabled(w http.ResponseWriter) bool {
+	if p.webhooks == nil {
+		writeErrorStatus(w, http.StatusNotImplemented, "this server does not send webhooks")
+		return false
+	}
+
+	return true
+}
+
+// webhooksHandler lists the subscriptions, or creates one from a JSON
+// WebhookSubscription giving url, events and optionally secret.
+func (p *PlayerServer) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.webhooksEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, p.webhooks.Subscriptions())
+	case http.MethodPost:
+		var subscription WebhookSubscription
+
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			writeErrorStatus(w, http.StatusBadRequest, fmt.Sprintf("problem parsing subscription, %v", err))
+			return
+		}
+
+		subscription, err := p.webhooks.Subscribe(subscription.URL, subscription.Events, subscription.Secret)
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, subscription)
+	default:
+		writeMethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+func (p *PlayerServer) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.webhooksEnabled(w) {
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, r, "DELETE")
+		return
+	}
+
+	if err := p.webhooks.Unsubscribe(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveriesHandler lists deliveries with their attempts, filtered by the
+// subscription and state query parameters: ?state=dead is the dead-letter list.
+func (p *PlayerServer) deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.webhooksEnabled(w) {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	if state != "" && state != DeliveryPending && state != DeliveryDelivered && state != DeliveryDead {
+		writeErrorStatus(w, http.StatusBadRequest, fmt.Sprintf("unknown state %q, use %s, %s or %s", state, DeliveryPending, DeliveryDelivered, DeliveryDead))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p.webhooks.Deliveries(query.Get("subscription"), state))
+}
+
+func (p *PlayerServer) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.webhooksEnabled(w) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	delivery, err := p.webhooks.Redeliver(r.PathValue("id"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, delivery)
+}
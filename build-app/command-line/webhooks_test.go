@@ -0,0 +1,550 @@
+package poker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receivedWebhook is a request as a webhookReceiver got it.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver answers deliveries with status, keeping what it was sent.
+type webhookReceiver struct {
+	*httptest.Server
+	lock     sync.Mutex
+	status   int
+	received []receivedWebhook
+	got      chan struct{}
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	t.Helper()
+
+	receiver := &webhookReceiver{status: http.StatusNoContent, got: make(chan struct{}, 100)}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.lock.Lock()
+		receiver.received = append(receiver.received, receivedWebhook{r.Header, body})
+		status := receiver.status
+		receiver.lock.Unlock()
+
+		w.WriteHeader(status)
+		receiver.got <- struct{}{}
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver
+}
+
+func (r *webhookReceiver) respond(status int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) webhooks() []receivedWebhook {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]receivedWebhook{}, r.received...)
+}
+
+func createWebhooks(t *testing.T) *Webhooks {
+	t.Helper()
+
+	webhooks, err := NewWebhooks(filepath.Join(t.TempDir(), "webhooks.json"))
+	assertNoError(t, err)
+
+	return webhooks
+}
+
+func subscribe(t *testing.T, webhooks *Webhooks, url string, events ...string) WebhookSubscription {
+	t.Helper()
+
+	subscription, err := webhooks.Subscribe(url, events, "")
+	assertNoError(t, err)
+
+	return subscription
+}
+
+func payloadOf(t *testing.T, webhook receivedWebhook) WebhookPayload {
+	t.Helper()
+
+	var payload WebhookPayload
+
+	if err := json.Unmarshal(webhook.body, &payload); err != nil {
+		t.Fatalf("problem parsing webhook %s, %v", webhook.body, err)
+	}
+
+	return payload
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"win.recorded"}`)
+	signature := SignWebhook("secret", body)
+
+	if !strings.HasPrefix(signature, "sha256=") || !VerifyWebhook("secret", body, signature) {
+		t.Errorf("expected %q to verify", signature)
+	}
+
+	if VerifyWebhook("other", body, signature) || VerifyWebhook("secret", []byte("{}"), signature) {
+		t.Error("expected a different secret or body not to verify")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+
+	t.Run("sends signed events to their subscribers", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		webhooks := createWebhooks(t)
+		subscription := subscribe(t, webhooks, receiver.URL, EventWinRecorded, EventLeaderChanged)
+
+		store := createSeasonStore(t)
+		NewPlayerServer(store, WithWebhooks(webhooks))
+
+		store.RecordWin("Cleo")
+		webhooks.process(t.Errorf)
+		store.RecordWin("Chris")
+		webhooks.process(t.Errorf)
+
+		received := receiver.webhooks()
+
+		if len(received) != 3 {
+			t.Fatalf("got %d webhooks want 3: two wins and Cleo taking the lead", len(received))
+		}
+
+		for _, webhook := range received {
+			if !VerifyWebhook(subscription.Secret, webhook.body, webhook.header.Get(SignatureHeader)) {
+				t.Errorf("signature %q doesn't verify", webhook.header.Get(SignatureHeader))
+			}
+		}
+
+		win := payloadOf(t, received[0])
+
+		if win.Event != EventWinRecorded || received[0].header.Get("X-Poker-Event") != EventWinRecorded || received[0].header.Get("X-Poker-Delivery") != win.Delivery {
+			t.Errorf("got %+v with headers %v", win, received[0].header)
+		}
+
+		if data := win.Data.(map[string]any); data["wins"] != 1.0 {
+			t.Errorf("got data %v want Cleo's first win", data)
+		}
+
+		leader := payloadOf(t, received[1])
+
+		if leader.Event != EventLeaderChanged || leader.Data.(map[string]any)["leader"].(map[string]any)["Name"] != "Cleo" {
+			t.Errorf("got %+v want Cleo taking the lead", leader)
+		}
+
+		if delivered := webhooks.Deliveries(subscription.ID, DeliveryDelivered); len(delivered) != 3 || delivered[0].Attempts[0].Status != http.StatusNoContent {
+			t.Errorf("got deliveries %+v", delivered)
+		}
+
+		store.RecordWin("Chris")
+		webhooks.process(t.Errorf)
+
+		var overtaken struct {
+			Data LeaderChanged `json:"data"`
+		}
+		json.Unmarshal(receiver.webhooks()[4].body, &overtaken)
+
+		if want := (LeaderChanged{Leader: Player{"Chris", 2}, Previous: "Cleo"}); overtaken.Data != want {
+			t.Errorf("got %+v want %+v", overtaken.Data, want)
+		}
+	})
+
+	t.Run("only sends the events subscribed to", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		webhooks := createWebhooks(t)
+		subscribe(t, webhooks, receiver.URL, EventSeasonClosed)
+
+		store := createSeasonStore(t)
+		NewPlayerServer(store, WithWebhooks(webhooks))
+
+		store.StartSeason(DefaultLeague, "spring")
+		store.RecordWin("Cleo")
+		store.CloseSeason(DefaultLeague)
+		webhooks.process(t.Errorf)
+
+		received := receiver.webhooks()
+
+		if len(received) != 1 {
+			t.Fatalf("got %d webhooks want 1", len(received))
+		}
+
+		var payload struct {
+			Event string       `json:"event"`
+			Data  SeasonClosed `json:"data"`
+		}
+		json.Unmarshal(received[0].body, &payload)
+
+		if payload.Event != EventSeasonClosed || payload.Data.Season.Name != "spring" || payload.Data.Season.Final.Find("Cleo") == nil {
+			t.Errorf("got %+v", payload)
+		}
+	})
+
+	t.Run("retries with backoff, then dead-letters", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		receiver.respond(http.StatusInternalServerError)
+
+		now := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+		webhooks := createWebhooks(t)
+		webhooks.now = func() time.Time { return now }
+		webhooks.Backoff = time.Minute
+		webhooks.MaxAttempts = 3
+
+		subscribe(t, webhooks, receiver.URL, EventWinRecorded)
+		assertNoError(t, webhooks.Publish(EventWinRecorded, WinRecorded{Game: Game{Winner: "Cleo"}, Wins: 1}))
+
+		for i, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+			next, ok := webhooks.process(t.Errorf)
+
+			if !ok || !next.Equal(now.Add(wait)) {
+				t.Fatalf("attempt %d: got next attempt %v, %v want in %v", i+1, next, ok, wait)
+			}
+
+			if _, ok := webhooks.process(t.Errorf); len(receiver.webhooks()) != i+1 || !ok {
+				t.Fatalf("attempt %d: expected nothing to be sent before the backoff", i+1)
+			}
+
+			now = now.Add(wait)
+		}
+
+		if _, ok := webhooks.process(t.Errorf); ok {
+			t.Error("expected nothing left to deliver")
+		}
+
+		dead := webhooks.Deliveries("", DeliveryDead)
+
+		if len(dead) != 1 || len(dead[0].Attempts) != 3 || dead[0].Attempts[2].Status != http.StatusInternalServerError {
+			t.Fatalf("got dead letters %+v", dead)
+		}
+
+		receiver.respond(http.StatusOK)
+
+		delivery, err := webhooks.Redeliver(dead[0].ID)
+		assertNoError(t, err)
+
+		if delivery.State != DeliveryDelivered || len(delivery.Attempts) != 4 {
+			t.Errorf("got %+v", delivery)
+		}
+
+		_, err = webhooks.Redeliver(dead[0].ID)
+		assertStatus(t, statusFor(err), http.StatusConflict)
+	})
+
+	t.Run("doesn't hold one subscriber up waiting on another", func(t *testing.T) {
+		release := make(chan struct{})
+		stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(stalled.Close)
+
+		receiver := newWebhookReceiver(t)
+		webhooks := createWebhooks(t)
+		subscribe(t, webhooks, stalled.URL, EventWinRecorded)
+		subscribe(t, webhooks, receiver.URL, EventWinRecorded)
+		assertNoError(t, webhooks.Publish(EventWinRecorded, WinRecorded{Game: Game{Winner: "Cleo"}, Wins: 1}))
+		assertNoError(t, webhooks.Publish(EventWinRecorded, WinRecorded{Game: Game{Winner: "Cleo"}, Wins: 2}))
+
+		done := make(chan struct{})
+
+		go func() {
+			webhooks.process(t.Logf)
+			close(done)
+		}()
+
+		for range 2 {
+			select {
+			case <-receiver.got:
+				continue
+			case <-time.After(5 * time.Second):
+				t.Error("expected the receiver to be sent its deliveries while the other one stalls")
+			}
+			break
+		}
+
+		close(release)
+		<-done
+	})
+
+	t.Run("keeps only the latest dead and delivered deliveries", func(t *testing.T) {
+		var deliveries []WebhookDelivery
+
+		for i := range maxDeadKept + maxDeliveredKept + 2 {
+			state := DeliveryDead
+
+			if i%2 == 1 && i < 2*maxDeliveredKept+2 {
+				state = DeliveryDelivered
+			}
+
+			deliveries = append(deliveries, WebhookDelivery{ID: fmt.Sprint(i), State: state})
+		}
+
+		deliveries = append(deliveries, WebhookDelivery{ID: "pending", State: DeliveryPending})
+
+		deliveries = trimDeliveries(deliveries, DeliveryDelivered, maxDeliveredKept)
+		deliveries = trimDeliveries(deliveries, DeliveryDead, maxDeadKept)
+
+		if len(deliveries) != maxDeadKept+maxDeliveredKept+1 {
+			t.Fatalf("got %d deliveries want %d", len(deliveries), maxDeadKept+maxDeliveredKept+1)
+		}
+
+		if deliveries[0].ID != "2" || deliveries[1].ID != "3" || deliveries[len(deliveries)-1].ID != "pending" {
+			t.Errorf("got %s, %s ... %s want the oldest dead and delivered ones dropped", deliveries[0].ID, deliveries[1].ID, deliveries[len(deliveries)-1].ID)
+		}
+	})
+
+	t.Run("keeps its queue across restarts", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+
+		webhooks, err := NewWebhooks(path)
+		assertNoError(t, err)
+
+		subscribe(t, webhooks, receiver.URL, EventWinRecorded)
+		webhooks.Publish(EventWinRecorded, WinRecorded{Game: Game{Winner: "Cleo"}, Wins: 1})
+
+		restarted, err := NewWebhooks(path)
+		assertNoError(t, err)
+
+		if pending := restarted.Deliveries("", DeliveryPending); len(pending) != 1 {
+			t.Fatalf("got %d pending deliveries want 1", len(pending))
+		}
+
+		restarted.process(t.Errorf)
+
+		if len(receiver.webhooks()) != 1 {
+			t.Errorf("expected the queued delivery to be made after the restart")
+		}
+	})
+
+	t.Run("drops pending deliveries when unsubscribing", func(t *testing.T) {
+		webhooks := createWebhooks(t)
+		subscription := subscribe(t, webhooks, "http://127.0.0.1:1/hooks", EventWinRecorded)
+		webhooks.Publish(EventWinRecorded, WinRecorded{})
+
+		assertNoError(t, webhooks.Unsubscribe(subscription.ID))
+
+		if deliveries := webhooks.Deliveries("", ""); len(deliveries) != 0 {
+			t.Errorf("got %+v want no deliveries", deliveries)
+		}
+
+		assertStatus(t, statusFor(webhooks.Unsubscribe(subscription.ID)), http.StatusNotFound)
+	})
+
+	t.Run("delivers while running", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		webhooks := createWebhooks(t)
+		subscribe(t, webhooks, receiver.URL, EventWinRecorded)
+
+		store := createSeasonStore(t)
+		NewPlayerServer(store, WithWebhooks(webhooks))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+
+		go func() {
+			webhooks.Run(ctx, t.Logf)
+			close(stopped)
+		}()
+
+		store.RecordWin("Cleo")
+
+		select {
+		case <-receiver.got:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the webhook")
+		}
+
+		cancel()
+		<-stopped
+	})
+
+	t.Run("queues events off the path of the write", func(t *testing.T) {
+		receiver := newWebhookReceiver(t)
+		webhooks := createWebhooks(t)
+		subscribe(t, webhooks, receiver.URL, EventWinRecorded)
+
+		store := createSeasonStore(t)
+		NewPlayerServer(store, WithWebhooks(webhooks))
+
+		store.RecordWin("Cleo")
+		store.RecordWin("Cleo")
+
+		if deliveries := webhooks.Deliveries("", ""); len(deliveries) != 0 {
+			t.Fatalf("got %d deliveries before the changes were handled want none", len(deliveries))
+		}
+
+		webhooks.process(t.Errorf)
+
+		received := receiver.webhooks()
+
+		if len(received) != 2 {
+			t.Fatalf("got %d webhooks want 2", len(received))
+		}
+
+		var first struct {
+			Data WinRecorded `json:"data"`
+		}
+		json.Unmarshal(received[0].body, &first)
+
+		if first.Data.Wins != 1 {
+			t.Errorf("got %d wins want 1, as of the first win", first.Data.Wins)
+		}
+	})
+
+	t.Run("logs the events it couldn't queue", func(t *testing.T) {
+		webhooks := createWebhooks(t)
+		subscribe(t, webhooks, "http://127.0.0.1:1/hooks", EventWinRecorded)
+		webhooks.path = filepath.Join(t.TempDir(), "missing", "webhooks.json")
+
+		store := createSeasonStore(t)
+		NewPlayerServer(store, WithWebhooks(webhooks))
+		store.RecordWin("Cleo")
+
+		var logged []string
+		webhooks.process(func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		})
+
+		if len(logged) != 1 || !strings.Contains(logged[0], "problem queueing events for a game change") {
+			t.Errorf("got log %q", logged)
+		}
+	})
+
+	t.Run("stops watching the store on shutdown", func(t *testing.T) {
+		store := createSeasonStore(t)
+		webhooks := createWebhooks(t)
+		players := NewPlayerServer(store, WithWebhooks(webhooks))
+
+		assertNoError(t, players.Shutdown(context.Background()))
+		store.RecordWin("Cleo")
+
+		if len(webhooks.changes) != 0 || len(store.hooks) != 0 {
+			t.Errorf("expected no changes to be heard after shutdown")
+		}
+	})
+
+	t.Run("rejects bad subscriptions", func(t *testing.T) {
+		webhooks := createWebhooks(t)
+
+		cases := map[string][]string{
+			"ftp://example.com/hooks":   {EventWinRecorded},
+			"https://example.com/none":  {},
+			"https://example.com/hooks": {"win.lost"},
+		}
+
+		for url, events := range cases {
+			_, err := webhooks.Subscribe(url, events, "")
+			assertStatus(t, statusFor(err), http.StatusBadRequest)
+		}
+	})
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+
+	newWebhookRequest := func(method, path, body string) *http.Request {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		return request
+	}
+
+	t.Run("manages subscriptions and shows their deliveries", func(t *testing.T) {
+		webhooks := createWebhooks(t)
+		server := NewPlayerServer(createSeasonStore(t), WithWebhooks(webhooks))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newWebhookRequest(http.MethodPost, "/admin/webhooks", `{"url": "`+receiver.URL+`", "events": ["win.recorded"]}`))
+		assertStatus(t, response.Code, http.StatusCreated)
+
+		var created WebhookSubscription
+		json.NewDecoder(response.Body).Decode(&created)
+
+		if created.ID == "" || created.Secret == "" {
+			t.Errorf("got %+v want an ID and a secret", created)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newWebhookRequest(http.MethodGet, "/admin/webhooks", ""))
+
+		var listed []WebhookSubscription
+		json.NewDecoder(response.Body).Decode(&listed)
+
+		if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Secret != "" {
+			t.Errorf("got %+v want the subscription without its secret", listed)
+		}
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Cleo"))
+		webhooks.process(t.Errorf)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newWebhookRequest(http.MethodGet, "/admin/webhooks/deliveries?state=delivered&subscription="+created.ID, ""))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var deliveries []WebhookDelivery
+		json.NewDecoder(response.Body).Decode(&deliveries)
+
+		if len(deliveries) != 1 || len(deliveries[0].Attempts) != 1 {
+			t.Errorf("got deliveries %+v", deliveries)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newWebhookRequest(http.MethodDelete, "/admin/webhooks/"+created.ID, ""))
+		assertStatus(t, response.Code, http.StatusNoContent)
+	})
+
+	t.Run("reports bad requests", func(t *testing.T) {
+		server := NewPlayerServer(createSeasonStore(t), WithWebhooks(createWebhooks(t)))
+
+		cases := []struct {
+			request *http.Request
+			want    int
+		}{
+			{newWebhookRequest(http.MethodPost, "/admin/webhooks", `{"url": "`+receiver.URL+`", "events": ["win.lost"]}`), http.StatusBadRequest},
+			{newWebhookRequest(http.MethodGet, "/admin/webhooks/deliveries?state=lost", ""), http.StatusBadRequest},
+			{newWebhookRequest(http.MethodDelete, "/admin/webhooks/nope", ""), http.StatusNotFound},
+			{newWebhookRequest(http.MethodPost, "/admin/webhooks/deliveries/nope/redeliver", ""), http.StatusNotFound},
+			{newWebhookRequest(http.MethodPut, "/admin/webhooks", ""), http.StatusMethodNotAllowed},
+		}
+
+		for _, c := range cases {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, c.request)
+			assertStatus(t, response.Code, c.want)
+		}
+	})
+
+	t.Run("needs the admin role", func(t *testing.T) {
+		tokens := createTokenStore(t)
+		_, recorder, _ := tokens.Issue("table", RoleRecord)
+
+		server := NewPlayerServer(createSeasonStore(t), WithAuth(tokens, RoleRead), WithWebhooks(createWebhooks(t)))
+
+		request := newWebhookRequest(http.MethodGet, "/admin/webhooks", "")
+		request.Header.Set("Authorization", "Bearer "+recorder)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("is not implemented without webhooks", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		NewPlayerServer(createSeasonStore(t)).ServeHTTP(response, newWebhookRequest(http.MethodGet, "/admin/webhooks", ""))
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	poker "go-learn/build-app/command-line"
+)
+
+// envPrefix is put in front of a flag's name, upper-cased with - as _, to
+// give the environment variable setting it: -win-interval is POKER_WIN_INTERVAL.
+const envPrefix = "POKER_"
+
+// config is everything the webserver can be configured with. Each setting
+// is taken from, in order of precedence, its flag, its environment variable,
+// the config file and finally its default.
+type config struct {
+	ConfigFile  string
+	Addr        string
+	DB          string
+	Tokens      string
+	Anonymous   string
+	Idempotency string
+	AuditLog    string
+	Webhooks    string
+	WinInterval time.Duration
+	MaxGames    int
+	AccessLog   bool
+
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	BackupMaxAge   time.Duration
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+// bind registers a flag for every setting, storing into c.
+func (c *config) bind(flags *flag.FlagSet) {
+	flags.StringVar(&c.ConfigFile, "config", "", "JSON file of settings, keyed by flag name")
+	flags.StringVar(&c.Addr, "addr", ":5000", "address to listen on")
+	flags.StringVar(&c.DB, "db", "game.db.json", "database file")
+	flags.StringVar(&c.Tokens, "tokens", "tokens.json", "file of API tokens, issued with the cli token command")
+	flags.StringVar(&c.Anonymous, "anonymous", string(poker.RoleRead), "role of requests without a token: read, record, admin, or none to require a token for everything")
+	flags.StringVar(&c.Idempotency, "idempotency", "idempotency.json", "file remembering recent Idempotency-Key headers")
+	flags.StringVar(&c.AuditLog, "audit-log", "audit.log", "append-only log of the changes made through /admin/ and imports")
+	flags.StringVar(&c.Webhooks, "webhooks", "webhooks.json", "file of webhook subscriptions and their queued deliveries")
+	flags.DurationVar(&c.WinInterval, "win-interval", 0, "least time between two wins of the same player, 0 for no limit")
+	flags.IntVar(&c.MaxGames, "max-games", 0, "most games the database file may hold before wins are turned away with 507, 0 for no limit")
+	flags.BoolVar(&c.AccessLog, "access-log", false, "log every request as JSON to stderr")
+
+	flags.StringVar(&c.BackupDir, "backup-dir", "backups", "directory of database snapshots, restored with the cli restore command")
+	flags.DurationVar(&c.BackupInterval, "backup-interval", poker.DefaultBackupInterval, "time between database snapshots, 0 to take none")
+	flags.IntVar(&c.BackupKeep, "backup-keep", poker.DefaultBackupKeep, "most snapshots to keep, 0 for no limit")
+	flags.DurationVar(&c.BackupMaxAge, "backup-max-age", poker.DefaultBackupMaxAge, "longest time to keep a snapshot, 0 for no limit")
+
+	flags.DurationVar(&c.ReadTimeout, "read-timeout", 15*time.Second, "longest time to read a request, body included")
+	flags.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", 5*time.Second, "longest time to read a request's headers")
+	flags.DurationVar(&c.WriteTimeout, "write-timeout", 30*time.Second, "longest time to write a response, streams and WebSockets excepted")
+	flags.DurationVar(&c.IdleTimeout, "idle-timeout", 2*time.Minute, "longest time to keep an idle connection open")
+	flags.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "longest time to wait for requests and games to finish when stopping")
+}
+
+// loadConfig reads the settings from args, the environment and the config file.
+func loadConfig(args []string, getenv func(string) string) (config, error) {
+	var fromFlags config
+
+	flags := flag.NewFlagSet("webserver", flag.ContinueOnError)
+	fromFlags.bind(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	var c config
+
+	settings := flag.NewFlagSet("webserver", flag.ContinueOnError)
+	c.bind(settings)
+
+	configFile := fromFlags.ConfigFile
+
+	if configFile == "" {
+		configFile = getenv(envName("config"))
+	}
+
+	if configFile != "" {
+		if err := applyConfigFile(settings, configFile); err != nil {
+			return config{}, err
+		}
+	}
+
+	var err error
+
+	settings.VisitAll(func(f *flag.Flag) {
+		if value := getenv(envName(f.Name)); value != "" && err == nil {
+			if setErr := settings.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("problem with %s, %v", envName(f.Name), setErr)
+			}
+		}
+	})
+
+	flags.Visit(func(f *flag.Flag) {
+		settings.Set(f.Name, f.Value.String())
+	})
+
+	return c, err
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyConfigFile sets the settings found in the JSON object in path, such as
+// {"addr": ":8080", "write-timeout": "1m"}.
+func applyConfigFile(settings *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("problem reading config file %s, %v", path, err)
+	}
+
+	var values map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("problem parsing config file %s, %v", path, err)
+	}
+
+	for name, raw := range values {
+		if name == "config" || settings.Lookup(name) == nil {
+			return fmt.Errorf("problem with config file %s, unknown setting %q", path, name)
+		}
+
+		var value string
+
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+
+		if err := settings.Set(name, value); err != nil {
+			return fmt.Errorf("problem with %q in config file %s, %v", name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// anonymousRole is the role of requests without a token.
+func (c config) anonymousRole() (poker.Role, error) {
+	if c.Anonymous == "none" {
+		return poker.RoleNone, nil
+	}
+
+	return poker.ParseRole(c.Anonymous)
+}
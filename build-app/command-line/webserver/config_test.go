@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	noEnv := func(string) string { return "" }
+
+	t.Run("defaults to port 5000 and game.db.json", func(t *testing.T) {
+		cfg, err := loadConfig(nil, noEnv)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Addr != ":5000" || cfg.DB != "game.db.json" || cfg.WriteTimeout != 30*time.Second || cfg.MaxGames != 0 {
+			t.Errorf("got %+v", cfg)
+		}
+	})
+
+	t.Run("flags beat the environment, which beats the config file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "webserver.json")
+		os.WriteFile(file, []byte(`{"addr": ":7000", "db": "file.db.json", "write-timeout": "1m", "win-interval": "5s", "max-games": 5000, "backup-keep": 7}`), 0666)
+
+		env := map[string]string{
+			"POKER_CONFIG": file,
+			"POKER_ADDR":   ":8000",
+			"POKER_DB":     "env.db.json",
+		}
+
+		cfg, err := loadConfig([]string{"-addr", ":9000"}, func(name string) string { return env[name] })
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := config{
+			ConfigFile:        file,
+			Addr:              ":9000",
+			DB:                "env.db.json",
+			Tokens:            "tokens.json",
+			Anonymous:         "read",
+			Idempotency:       "idempotency.json",
+			AuditLog:          "audit.log",
+			Webhooks:          "webhooks.json",
+			WinInterval:       5 * time.Second,
+			MaxGames:          5000,
+			BackupDir:         "backups",
+			BackupInterval:    time.Hour,
+			BackupKeep:        7,
+			BackupMaxAge:      30 * 24 * time.Hour,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		}
+
+		if cfg != want {
+			t.Errorf("got %+v want %+v", cfg, want)
+		}
+	})
+
+	t.Run("reads booleans from the config file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "webserver.json")
+		os.WriteFile(file, []byte(`{"access-log": true}`), 0666)
+
+		cfg, err := loadConfig([]string{"-config", file}, noEnv)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !cfg.AccessLog {
+			t.Error("expected the access log to be on")
+		}
+	})
+
+	t.Run("rejects unknown settings in the config file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "webserver.json")
+		os.WriteFile(file, []byte(`{"port": 5000}`), 0666)
+
+		if _, err := loadConfig([]string{"-config", file}, noEnv); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("rejects a bad duration from the environment", func(t *testing.T) {
+		env := func(name string) string {
+			if name == "POKER_IDLE_TIMEOUT" {
+				return "forever"
+			}
+			return ""
+		}
+
+		if _, err := loadConfig(nil, env); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
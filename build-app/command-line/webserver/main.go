@@ -1,24 +1,122 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
 	poker "go-learn/build-app/command-line"
 )
 
-const dbFileName = "game.db.json"
-
 func main() {
-	store, close, err := poker.FileSystemPlayerStoreFromFile(dbFileName)
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer close()
 
-	server := poker.NewPlayerServer(store)
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the league until SIGINT or SIGTERM, then lets requests and games
+// in progress finish before closing the store.
+func run(cfg config) error {
+	anonymous, err := cfg.anonymousRole()
+
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := poker.FileSystemPlayerStoreFromFile(cfg.DB)
+
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	store.MaxGames = cfg.MaxGames
+
+	tokens, err := poker.NewTokenStore(cfg.Tokens)
+
+	if err != nil {
+		return err
+	}
+
+	idempotency, err := poker.NewIdempotencyStore(cfg.Idempotency, poker.DefaultIdempotencyLimit, poker.DefaultIdempotencyTTL)
+
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := poker.NewWebhooks(cfg.Webhooks)
+
+	if err != nil {
+		return err
+	}
+
+	options := []poker.ServerOption{
+		poker.WithAuth(tokens, anonymous),
+		poker.WithIdempotency(idempotency),
+		poker.WithWinInterval(cfg.WinInterval),
+		poker.WithAuditLog(poker.NewAuditLog(cfg.AuditLog)),
+		poker.WithWebhooks(webhooks),
+	}
+
+	if cfg.AccessLog {
+		options = append(options, poker.WithAccessLog(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+	}
+
+	players := poker.NewPlayerServer(store, options...)
 
-	if err := http.ListenAndServe(":5000", server); err != nil {
-		log.Fatalf("could not listen on port 5000 %v", err)
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           players,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
+	server.RegisterOnShutdown(players.Drain)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go webhooks.Run(ctx, log.Printf)
+
+	if cfg.BackupInterval > 0 {
+		go poker.NewBackups(cfg.BackupDir, cfg.BackupKeep, cfg.BackupMaxAge).Run(ctx, store, cfg.BackupInterval, log.Printf)
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		log.Printf("listening on %s", cfg.Addr)
+		served <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %v for requests and games to finish", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// The games over /ws are stopped even when requests outlived the timeout.
+	return errors.Join(server.Shutdown(shutdownCtx), players.Shutdown(shutdownCtx))
 }
@@ -0,0 +1,421 @@
+package poker
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Opcodes and close codes from RFC 6455 sections 5.2 and 7.4.1.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+
+	wsCloseNormal        = 1000
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseInvalidData   = 1007
+	wsCloseTooBig        = 1009
+	wsCloseInternalError = 1011
+
+	// wsAcceptGUID is appended to the client's key to prove the server speaks WebSocket.
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// MaxWebSocketMessage is the largest message, across all its frames, a WebSocket will read.
+	MaxWebSocketMessage = 1 << 20
+)
+
+// WebSocketCloseError is returned by ReadMessage once the other end has closed the connection.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d %s", e.Code, e.Reason)
+}
+
+var errWebSocketProtocol = errors.New("websocket protocol error")
+
+// WebSocket is one end of a WebSocket connection, written to the RFC 6455
+// handshake and framing on top of net/http. Messages can be written from
+// several goroutines, but only one goroutine should read.
+type WebSocket struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+
+	writeLock sync.Mutex
+	bw        *bufio.Writer
+	closed    bool
+}
+
+// UpgradeWebSocket completes the opening handshake of a client's request. When
+// the request is not a valid handshake the error response has already been sent.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return nil, errWebSocketProtocol
+	}
+
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		writeErrorStatus(w, http.StatusUpgradeRequired, "this endpoint only speaks WebSocket")
+		return nil, errWebSocketProtocol
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeErrorStatus(w, http.StatusUpgradeRequired, "only WebSocket version 13 is supported")
+		return nil, errWebSocketProtocol
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		writeErrorStatus(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+		return nil, errWebSocketProtocol
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		writeErrorStatus(w, http.StatusInternalServerError, "this connection can't be upgraded")
+		return nil, errWebSocketProtocol
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, fmt.Errorf("problem taking over connection, %v", err)
+	}
+
+	// The server's read and write timeouts are meant for requests, not for a
+	// connection that stays open for a whole game.
+	conn.SetDeadline(time.Time{})
+
+	ws := &WebSocket{conn: conn, br: rw.Reader, bw: bufio.NewWriter(conn)}
+
+	fmt.Fprintf(ws.bw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+
+	if err := ws.bw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("problem completing websocket handshake, %v", err)
+	}
+
+	return ws, nil
+}
+
+// DialWebSocket opens a connection to the ws:// or http:// URL rawURL,
+// sending header along with the handshake. TLS is not supported.
+func DialWebSocket(rawURL string, header http.Header) (*WebSocket, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "ws" && u.Scheme != "http" {
+		return nil, fmt.Errorf("can't dial %s, only ws:// URLs are supported", rawURL)
+	}
+
+	u.Scheme = "http"
+	address := u.Host
+
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := request.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("problem sending websocket handshake, %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	response, err := http.ReadResponse(br, request)
+
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("problem reading websocket handshake, %v", err)
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		conn.Close()
+		return nil, StatusError{response.StatusCode, fmt.Errorf("websocket handshake refused, %s", strings.TrimSpace(string(body)))}
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: server sent the wrong Sec-WebSocket-Accept", errWebSocketProtocol)
+	}
+
+	return &WebSocket{conn: conn, br: br, bw: bufio.NewWriter(conn), client: true}, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma separated header name contains token, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, put back together from
+// its frames. Pings are answered and pongs ignored along the way. When the
+// other end closes the connection the close is acknowledged and a
+// WebSocketCloseError returned.
+func (ws *WebSocket) ReadMessage() ([]byte, error) {
+	var message []byte
+	var opcode byte
+
+	for {
+		fin, op, payload, err := ws.readFrame()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case wsPing:
+			ws.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return nil, ws.acknowledgeClose(payload)
+		case wsContinuation:
+			if opcode == 0 {
+				return nil, ws.fail(wsCloseProtocolError, "continuation without a message")
+			}
+			message = append(message, payload...)
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return nil, ws.fail(wsCloseProtocolError, "new message before the last one finished")
+			}
+			opcode, message = op, payload
+		default:
+			return nil, ws.fail(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if len(message) > MaxWebSocketMessage {
+			return nil, ws.fail(wsCloseTooBig, "message too big")
+		}
+
+		if !fin {
+			continue
+		}
+
+		if opcode == wsText && !utf8.Valid(message) {
+			return nil, ws.fail(wsCloseInvalidData, "text message is not valid UTF-8")
+		}
+
+		return message, nil
+	}
+}
+
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "reserved bits set")
+	}
+
+	// Clients must mask every frame they send and servers must not, RFC 6455 section 5.1.
+	if masked == ws.client {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "wrong masking")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "invalid control frame")
+	}
+
+	if length > MaxWebSocketMessage {
+		return false, 0, nil, ws.fail(wsCloseTooBig, "message too big")
+	}
+
+	var mask [4]byte
+
+	if masked {
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends data as a single text frame.
+func (ws *WebSocket) WriteMessage(data []byte) error {
+	return ws.writeFrame(wsText, data)
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closed {
+		return net.ErrClosed
+	}
+
+	header := []byte{0x80 | opcode, 0}
+	length := len(payload)
+
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if ws.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+
+		header[1] |= 0x80
+		header = append(header, mask[:]...)
+
+		masked := make([]byte, length)
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	ws.bw.Write(header)
+	ws.bw.Write(payload)
+
+	return ws.bw.Flush()
+}
+
+// CloseWith sends a close frame with code and reason, then closes the connection.
+func (ws *WebSocket) CloseWith(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	ws.writeFrame(wsClose, append(payload, reason...))
+
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closed {
+		return nil
+	}
+
+	ws.closed = true
+
+	return ws.conn.Close()
+}
+
+// Close closes the connection normally.
+func (ws *WebSocket) Close() error {
+	return ws.CloseWith(wsCloseNormal, "")
+}
+
+// acknowledgeClose echoes the other end's close frame and closes the connection.
+func (ws *WebSocket) acknowledgeClose(payload []byte) error {
+	closeErr := WebSocketCloseError{Code: 1005}
+
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+
+	if closeErr.Code == 1005 {
+		ws.CloseWith(wsCloseNormal, "")
+	} else {
+		ws.CloseWith(closeErr.Code, "")
+	}
+
+	return closeErr
+}
+
+// fail closes the connection after a protocol violation by the other end.
+func (ws *WebSocket) fail(code int, reason string) error {
+	ws.CloseWith(code, reason)
+	return fmt.Errorf("%w: %s", errWebSocketProtocol, reason)
+}
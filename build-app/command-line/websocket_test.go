@@ -0,0 +1,131 @@
+package poker
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer sends every message it receives straight back.
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := UpgradeWebSocket(w, r)
+
+		if err != nil {
+			return
+		}
+
+		for {
+			message, err := ws.ReadMessage()
+
+			if err != nil {
+				return
+			}
+
+			ws.WriteMessage(message)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func dialTestWebSocket(t *testing.T, url string) *WebSocket {
+	t.Helper()
+
+	ws, err := DialWebSocket("ws"+strings.TrimPrefix(url, "http"), nil)
+	assertNoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	return ws
+}
+
+// writeTestFrame writes a single frame the way a client would, letting tests
+// send fragments and frames WebSocket never sends itself.
+func writeTestFrame(ws *WebSocket, fin, masked bool, opcode byte, payload []byte) {
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+
+	frame := []byte{head, byte(len(payload))}
+
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	ws.conn.Write(frame)
+}
+
+func TestWebSocket(t *testing.T) {
+
+	t.Run("echoes messages of every length encoding", func(t *testing.T) {
+		ws := dialTestWebSocket(t, echoServer(t).URL)
+
+		for _, size := range []int{0, 5, 125, 126, 65535, 70000} {
+			want := bytes.Repeat([]byte("a"), size)
+			assertNoError(t, ws.WriteMessage(want))
+
+			got, err := ws.ReadMessage()
+			assertNoError(t, err)
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("got a message of %d bytes want %d", len(got), size)
+			}
+		}
+	})
+
+	t.Run("puts fragmented messages back together around pings", func(t *testing.T) {
+		ws := dialTestWebSocket(t, echoServer(t).URL)
+
+		writeTestFrame(ws, false, true, wsText, []byte("hel"))
+		writeTestFrame(ws, true, true, wsPing, []byte("are you there"))
+		writeTestFrame(ws, true, true, wsContinuation, []byte("lo"))
+
+		got, err := ws.ReadMessage()
+		assertNoError(t, err)
+
+		if string(got) != "hello" {
+			t.Errorf("got %q want hello", got)
+		}
+	})
+
+	t.Run("closes the connection when a client does not mask", func(t *testing.T) {
+		ws := dialTestWebSocket(t, echoServer(t).URL)
+
+		writeTestFrame(ws, true, false, wsText, []byte("hello"))
+
+		_, err := ws.ReadMessage()
+
+		var closeErr WebSocketCloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != wsCloseProtocolError {
+			t.Errorf("got %v want a close with code %d", err, wsCloseProtocolError)
+		}
+	})
+
+	t.Run("rejects requests that are not a handshake", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		UpgradeWebSocket(response, newGetRequest("/ws"))
+
+		assertStatus(t, response.Code, http.StatusUpgradeRequired)
+	})
+
+	t.Run("computes the accept key from the RFC", func(t *testing.T) {
+		if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("got %q", got)
+		}
+	})
+}